@@ -2,9 +2,12 @@ package main
 
 import (
 	"github.com/pmarchini/giogo/internal/cli"
+	"github.com/pmarchini/giogo/internal/core"
 )
 
 // main is the entry point of the application
 func main() {
+	// giogo re-executes itself to set up the process of the command before exec
+	core.ExecShim()
 	cli.Execute()
 }
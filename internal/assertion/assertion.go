@@ -0,0 +1,188 @@
+package assertion
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/utils"
+)
+
+// ExitCodeAssertionFailed is the exit code of giogo when the command succeeded but a resource assertion failed
+const ExitCodeAssertionFailed = 4
+
+// Kind tells how the measured and expected values of an assertion are formatted
+type Kind int
+
+const (
+	KindBytes Kind = iota
+	KindDuration
+	KindCount
+)
+
+// Assertion is an upper bound on a figure of the final cgroup stats
+type Assertion struct {
+	Name string
+	Kind Kind
+	Max  uint64
+	// Measure extracts the figure from the final stats, durations are in microseconds.
+	// It returns false when the stats do not hold the figure, which fails the assertion.
+	Measure func(stats *core.Stats) (uint64, bool)
+}
+
+// trimOperator drops the optional <= prefix, so both --assert-cpu-time=30s and --assert-cpu-time<=30s read the same
+func trimOperator(value string) string {
+	return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(value), "<="))
+}
+
+// NewBytesAssertion creates an assertion bounding a size, in the same notation as memory limits (e.g., 512m)
+func NewBytesAssertion(name, value string, measure func(stats *core.Stats) (uint64, bool)) (*Assertion, error) {
+	bound, err := utils.BytesStringToBytes(trimOperator(value))
+	if err != nil {
+		return nil, fmt.Errorf("unparsable %s assertion %q: %v", name, value, err)
+	}
+	return &Assertion{Name: name, Kind: KindBytes, Max: bound, Measure: measure}, nil
+}
+
+// NewDurationAssertion creates an assertion bounding a duration (e.g., 30s)
+func NewDurationAssertion(name, value string, measure func(stats *core.Stats) (uint64, bool)) (*Assertion, error) {
+	bound, err := time.ParseDuration(trimOperator(value))
+	if err != nil {
+		return nil, fmt.Errorf("unparsable %s assertion %q: %v", name, value, err)
+	}
+	if bound < 0 {
+		return nil, fmt.Errorf("%s assertion must not be negative", name)
+	}
+	return &Assertion{Name: name, Kind: KindDuration, Max: uint64(bound.Microseconds()), Measure: measure}, nil
+}
+
+// PeakMemory measures the peak memory usage of the group, unavailable without memory.peak (Linux 5.19)
+func PeakMemory(stats *core.Stats) (uint64, bool) { return stats.Memory.Peak, stats.Memory.Peak > 0 }
+
+// CPUTime measures the CPU time consumed by the group
+func CPUTime(stats *core.Stats) (uint64, bool) { return stats.CPU.UsageUsec, true }
+
+// IORead measures the bytes read by the group across every device
+func IORead(stats *core.Stats) (uint64, bool) {
+	read, _ := core.IOTotals(stats.IO)
+	return read, true
+}
+
+// IOWrite measures the bytes written by the group across every device
+func IOWrite(stats *core.Stats) (uint64, bool) {
+	_, written := core.IOTotals(stats.IO)
+	return written, true
+}
+
+// NoThrottling asserts the group was never throttled: no CPU period over quota and no memory.high event
+func NoThrottling() *Assertion {
+	return &Assertion{
+		Name: "throttling events",
+		Kind: KindCount,
+		Measure: func(stats *core.Stats) (uint64, bool) {
+			return stats.CPU.ThrottledPeriods + stats.Memory.Events.High, true
+		},
+	}
+}
+
+func (a *Assertion) format(value uint64) string {
+	switch a.Kind {
+	case KindBytes:
+		return utils.FormatBytes(value)
+	case KindDuration:
+		return (time.Duration(value) * time.Microsecond).Round(time.Millisecond).String()
+	default:
+		return fmt.Sprintf("%d", value)
+	}
+}
+
+// Outcome is the evaluation of an assertion
+type Outcome struct {
+	Assertion *Assertion
+	Measured  uint64
+	// Unavailable tells the figure could not be measured, an assertion never passes by default
+	Unavailable bool
+}
+
+// Passed tells whether the measured value is within the bound
+func (o *Outcome) Passed() bool {
+	return !o.Unavailable && o.Measured <= o.Assertion.Max
+}
+
+// String formats the outcome for the report
+func (o *Outcome) String() string {
+	status := "PASS"
+	if !o.Passed() {
+		status = "FAIL"
+	}
+	measured := o.Assertion.format(o.Measured)
+	if o.Unavailable {
+		measured = "unavailable"
+	}
+	return fmt.Sprintf("%s %s %s <= %s", status, o.Assertion.Name, measured, o.Assertion.format(o.Assertion.Max))
+}
+
+// AssertionError is returned when at least one assertion failed
+type AssertionError struct {
+	Failed, Total int
+}
+
+func (e *AssertionError) Error() string {
+	return fmt.Sprintf("%d of %d resource assertions failed", e.Failed, e.Total)
+}
+
+// ExitCode is the exit code of giogo when an assertion failed
+func (e *AssertionError) ExitCode() int {
+	return ExitCodeAssertionFailed
+}
+
+// Checker evaluates the assertions against the final stats of the cgroup, before it is deleted.
+// A failed assertion only fails the run when the command itself succeeded, the report is printed either way.
+type Checker struct {
+	Assertions []*Assertion
+	// Output is where the report is written, stderr when nil so the command output is left untouched
+	Output io.Writer
+}
+
+// Evaluate evaluates the assertions against the stats
+func (c *Checker) Evaluate(stats *core.Stats) []Outcome {
+	var outcomes []Outcome
+	for _, a := range c.Assertions {
+		measured, ok := a.Measure(stats)
+		outcomes = append(outcomes, Outcome{Assertion: a, Measured: measured, Unavailable: !ok})
+	}
+	return outcomes
+}
+
+// Report evaluates the assertions and writes the report
+func (c *Checker) Report(result *core.Result) error {
+	if result.Stats == nil {
+		return fmt.Errorf("cannot evaluate the resource assertions: the cgroup stats are unavailable")
+	}
+	w := c.Output
+	if w == nil {
+		w = os.Stderr
+	}
+
+	var b strings.Builder
+	b.WriteString("giogo assertions:\n")
+	failed := 0
+	outcomes := c.Evaluate(result.Stats)
+	for i := range outcomes {
+		if !outcomes[i].Passed() {
+			failed++
+		}
+		fmt.Fprintf(&b, "  %s\n", outcomes[i].String())
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return &AssertionError{Failed: failed, Total: len(outcomes)}
+	}
+	return nil
+}
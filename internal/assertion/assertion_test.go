@@ -0,0 +1,103 @@
+package assertion_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pmarchini/giogo/internal/assertion"
+	"github.com/pmarchini/giogo/internal/core"
+)
+
+func TestNewAssertions(t *testing.T) {
+	for _, value := range []string{"512m", "<=512m", " <= 512m"} {
+		a, err := assertion.NewBytesAssertion("peak memory", value, assertion.PeakMemory)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", value, err)
+		}
+		if a.Max != 512*1024*1024 {
+			t.Errorf("expected 512m for %q, got %d", value, a.Max)
+		}
+	}
+
+	a, err := assertion.NewDurationAssertion("cpu time", "<=30s", assertion.CPUTime)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.Max != 30000000 {
+		t.Errorf("expected 30s in microseconds, got %d", a.Max)
+	}
+
+	for _, value := range []string{"", "lots", "<="} {
+		if _, err := assertion.NewBytesAssertion("io write", value, assertion.IOWrite); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+	for _, value := range []string{"30", "-1s"} {
+		if _, err := assertion.NewDurationAssertion("cpu time", value, assertion.CPUTime); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
+
+func TestCheckerReport(t *testing.T) {
+	peak, _ := assertion.NewBytesAssertion("peak memory", "1m", assertion.PeakMemory)
+	cpuTime, _ := assertion.NewDurationAssertion("cpu time", "1s", assertion.CPUTime)
+	ioWrite, _ := assertion.NewBytesAssertion("io write", "1k", assertion.IOWrite)
+	stats := &core.Stats{
+		CPU:    core.CPUStats{UsageUsec: 1500000},
+		Memory: core.MemoryStats{Peak: 512 * 1024},
+		IO:     []core.IOStats{{WBytes: 512}, {WBytes: 256}},
+	}
+
+	var out bytes.Buffer
+	checker := &assertion.Checker{Assertions: []*assertion.Assertion{peak, cpuTime, ioWrite, assertion.NoThrottling()}, Output: &out}
+	err := checker.Report(&core.Result{Stats: stats})
+
+	var assertionErr *assertion.AssertionError
+	if !errors.As(err, &assertionErr) {
+		t.Fatalf("expected an AssertionError, got %v", err)
+	}
+	if assertionErr.Failed != 1 || assertionErr.Total != 4 {
+		t.Errorf("expected 1 of 4 failed, got %d of %d", assertionErr.Failed, assertionErr.Total)
+	}
+	if assertionErr.ExitCode() != assertion.ExitCodeAssertionFailed {
+		t.Errorf("expected exit code %d, got %d", assertion.ExitCodeAssertionFailed, assertionErr.ExitCode())
+	}
+
+	expected := "giogo assertions:\n" +
+		"  PASS peak memory 512.0k <= 1.0m\n" +
+		"  FAIL cpu time 1.5s <= 1s\n" +
+		"  PASS io write 768 <= 1.0k\n" +
+		"  PASS throttling events 0 <= 0\n"
+	if out.String() != expected {
+		t.Errorf("expected report:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	stats.CPU.UsageUsec = 500000
+	stats.CPU.ThrottledPeriods = 2
+	out.Reset()
+	if err := checker.Report(&core.Result{Stats: stats}); err == nil {
+		t.Errorf("expected throttling to fail the assertions")
+	}
+
+	stats.CPU.ThrottledPeriods = 0
+	if err := checker.Report(&core.Result{Stats: stats}); err != nil {
+		t.Errorf("expected every assertion to pass, got %v", err)
+	}
+
+	if err := checker.Report(&core.Result{}); err == nil {
+		t.Errorf("expected an error without stats")
+	}
+
+	// Kernels before 5.19 have no memory.peak
+	stats.Memory.Peak = 0
+	out.Reset()
+	if err := checker.Report(&core.Result{Stats: stats}); err == nil {
+		t.Errorf("expected an unavailable peak memory to fail the assertions")
+	}
+	if !strings.Contains(out.String(), "FAIL peak memory unavailable <= 1.0m") {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+}
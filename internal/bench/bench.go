@@ -0,0 +1,251 @@
+package bench
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/utils"
+)
+
+// DefaultRuns is the default number of measured runs
+const DefaultRuns = 10
+
+// Sample is the measure of one run
+type Sample struct {
+	Run          int    `json:"run"`
+	WallTimeUsec uint64 `json:"wall_time_usec"`
+	CPUTimeUsec  uint64 `json:"cpu_time_usec"`
+	PeakMemory   uint64 `json:"peak_memory_bytes"`
+}
+
+// Collector is a reporter keeping the result of the last run
+type Collector struct {
+	Result *core.Result
+}
+
+// Report keeps the result of the run
+func (c *Collector) Report(result *core.Result) error {
+	c.Result = result
+	return nil
+}
+
+// Benchmark runs a command repeatedly, each run in a fresh cgroup.
+// Runs are sequential, so they never compete with each other for the resources of the machine.
+type Benchmark struct {
+	Command []string
+	Runs    int
+	Warmup  int
+	// Prepare, when set, is a shell command run before every run, outside of the cgroup (e.g., to drop the page cache)
+	Prepare string
+	// Run runs the command once in a fresh cgroup, reporting its result to the collector
+	Run func(collector *Collector) error
+	// Progress is where the progress is written, stderr when nil
+	Progress io.Writer
+}
+
+// Execute runs the warmup runs, which are discarded, then the measured runs.
+// The benchmark stops at the first failed run, as the figures of a failed run are not comparable.
+func (b *Benchmark) Execute() (*Report, error) {
+	if b.Runs < 1 {
+		return nil, fmt.Errorf("the number of runs must be at least 1, got %d", b.Runs)
+	}
+	if b.Warmup < 0 {
+		return nil, fmt.Errorf("the number of warmup runs must not be negative, got %d", b.Warmup)
+	}
+	progress := b.Progress
+	if progress == nil {
+		progress = os.Stderr
+	}
+
+	var samples []Sample
+	var resources specs.LinuxResources
+	for i := 1; i <= b.Warmup+b.Runs; i++ {
+		label := fmt.Sprintf("run %d/%d", i-b.Warmup, b.Runs)
+		if i <= b.Warmup {
+			label = fmt.Sprintf("warmup %d/%d", i, b.Warmup)
+		}
+		if b.Prepare != "" {
+			prepare := exec.Command("sh", "-c", b.Prepare)
+			prepare.Stdout = progress
+			prepare.Stderr = progress
+			if err := prepare.Run(); err != nil {
+				return nil, fmt.Errorf("prepare command failed before %s: %v", label, err)
+			}
+		}
+		fmt.Fprintf(progress, "giogo bench: %s\n", label)
+
+		collector := &Collector{}
+		if err := b.Run(collector); err != nil {
+			return nil, fmt.Errorf("%s failed: %w", label, err)
+		}
+		if i <= b.Warmup {
+			continue
+		}
+		if collector.Result == nil || collector.Result.Stats == nil {
+			return nil, fmt.Errorf("%s: the cgroup stats are unavailable", label)
+		}
+		stats := collector.Result.Stats
+		resources = collector.Result.Resources
+		samples = append(samples, Sample{
+			Run:          i - b.Warmup,
+			WallTimeUsec: uint64(collector.Result.WallTime.Microseconds()),
+			CPUTimeUsec:  stats.CPU.UsageUsec,
+			PeakMemory:   stats.Memory.Peak,
+		})
+	}
+	return NewReport(b.Command, resources, b.Warmup, samples), nil
+}
+
+// Statistics summarizes the values of a metric over the runs
+type Statistics struct {
+	Mean   float64 `json:"mean"`
+	Stddev float64 `json:"stddev"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	P50    float64 `json:"p50"`
+	P90    float64 `json:"p90"`
+	P95    float64 `json:"p95"`
+	P99    float64 `json:"p99"`
+}
+
+// Summarize computes the statistics of values, the standard deviation is the sample one
+func Summarize(values []float64) Statistics {
+	if len(values) == 0 {
+		return Statistics{}
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	mean := sum / float64(len(sorted))
+	var squares float64
+	for _, v := range sorted {
+		squares += (v - mean) * (v - mean)
+	}
+	var stddev float64
+	if len(sorted) > 1 {
+		stddev = math.Sqrt(squares / float64(len(sorted)-1))
+	}
+
+	return Statistics{
+		Mean:   mean,
+		Stddev: stddev,
+		Min:    sorted[0],
+		Max:    sorted[len(sorted)-1],
+		P50:    utils.Percentile(sorted, 50),
+		P90:    utils.Percentile(sorted, 90),
+		P95:    utils.Percentile(sorted, 95),
+		P99:    utils.Percentile(sorted, 99),
+	}
+}
+
+// Unit is how the values of a metric are formatted
+type Unit string
+
+const (
+	UnitBytes Unit = "bytes"
+	UnitUsec  Unit = "usec"
+)
+
+// Metric holds the statistics of a measured figure
+type Metric struct {
+	Name       string     `json:"name"`
+	Unit       Unit       `json:"unit"`
+	Statistics Statistics `json:"statistics"`
+}
+
+// Report is the outcome of a benchmark
+type Report struct {
+	Command   []string             `json:"command"`
+	Resources specs.LinuxResources `json:"resources"`
+	Runs      int                  `json:"runs"`
+	Warmup    int                  `json:"warmup"`
+	Metrics   []Metric             `json:"metrics"`
+	Samples   []Sample             `json:"samples"`
+}
+
+// NewReport computes the statistics of the samples
+func NewReport(command []string, resources specs.LinuxResources, warmup int, samples []Sample) *Report {
+	var wallTimes, cpuTimes, peaks []float64
+	for _, s := range samples {
+		wallTimes = append(wallTimes, float64(s.WallTimeUsec))
+		cpuTimes = append(cpuTimes, float64(s.CPUTimeUsec))
+		peaks = append(peaks, float64(s.PeakMemory))
+	}
+	return &Report{
+		Command:   command,
+		Resources: resources,
+		Runs:      len(samples),
+		Warmup:    warmup,
+		Metrics: []Metric{
+			{Name: "wall time", Unit: UnitUsec, Statistics: Summarize(wallTimes)},
+			{Name: "cpu time", Unit: UnitUsec, Statistics: Summarize(cpuTimes)},
+			{Name: "peak memory", Unit: UnitBytes, Statistics: Summarize(peaks)},
+		},
+		Samples: samples,
+	}
+}
+
+// WriteText writes the statistics as a table
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%d runs, %d warmup\n", r.Runs, r.Warmup)
+	fmt.Fprintf(tw, "metric\tmean\tstddev\tmin\tp50\tp90\tp95\tp99\tmax\n")
+	for _, m := range r.Metrics {
+		s := m.Statistics
+		fmt.Fprintf(tw, "%s", m.Name)
+		for _, v := range []float64{s.Mean, s.Stddev, s.Min, s.P50, s.P90, s.P95, s.P99, s.Max} {
+			fmt.Fprintf(tw, "\t%s", formatValue(m.Unit, v))
+		}
+		fmt.Fprintf(tw, "\n")
+	}
+	return tw.Flush()
+}
+
+// WriteJSON writes the statistics and the raw samples as JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteCSV writes the raw samples as CSV, one line per run
+func (r *Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"run", "wall_time_usec", "cpu_time_usec", "peak_memory_bytes"})
+	for _, s := range r.Samples {
+		writer.Write([]string{
+			strconv.Itoa(s.Run),
+			strconv.FormatUint(s.WallTimeUsec, 10),
+			strconv.FormatUint(s.CPUTimeUsec, 10),
+			strconv.FormatUint(s.PeakMemory, 10),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func formatValue(unit Unit, value float64) string {
+	if unit == UnitBytes {
+		return utils.FormatBytes(uint64(math.Round(value)))
+	}
+	d := time.Duration(value * float64(time.Microsecond))
+	if d >= 10*time.Millisecond {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Microsecond).String()
+}
@@ -0,0 +1,138 @@
+package bench_test
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pmarchini/giogo/internal/bench"
+	"github.com/pmarchini/giogo/internal/core"
+)
+
+func TestSummarize(t *testing.T) {
+	stats := bench.Summarize([]float64{5, 1, 4, 2, 3})
+	expected := bench.Statistics{Mean: 3, Stddev: math.Sqrt(2.5), Min: 1, Max: 5, P50: 3, P90: 4.6, P95: 4.8, P99: 4.96}
+	for name, values := range map[string][2]float64{
+		"mean":   {stats.Mean, expected.Mean},
+		"stddev": {stats.Stddev, expected.Stddev},
+		"min":    {stats.Min, expected.Min},
+		"max":    {stats.Max, expected.Max},
+		"p50":    {stats.P50, expected.P50},
+		"p90":    {stats.P90, expected.P90},
+		"p95":    {stats.P95, expected.P95},
+		"p99":    {stats.P99, expected.P99},
+	} {
+		if math.Abs(values[0]-values[1]) > 1e-9 {
+			t.Errorf("expected %s %v, got %v", name, values[1], values[0])
+		}
+	}
+
+	single := bench.Summarize([]float64{7})
+	if single.Stddev != 0 || single.P99 != 7 {
+		t.Errorf("unexpected statistics of a single value: %+v", single)
+	}
+	if empty := bench.Summarize(nil); empty != (bench.Statistics{}) {
+		t.Errorf("expected empty statistics, got %+v", empty)
+	}
+}
+
+func TestBenchmarkExecute(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "prepared")
+	runs := 0
+	var progress bytes.Buffer
+	b := &bench.Benchmark{
+		Command: []string{"true"},
+		Runs:    3,
+		Warmup:  2,
+		Prepare: "echo x >> " + marker,
+		Run: func(collector *bench.Collector) error {
+			runs++
+			return collector.Report(&core.Result{
+				WallTime: time.Duration(runs) * time.Second,
+				Stats: &core.Stats{
+					CPU:    core.CPUStats{UsageUsec: uint64(runs) * 1000},
+					Memory: core.MemoryStats{Peak: uint64(runs) * 1024},
+				},
+			})
+		},
+		Progress: &progress,
+	}
+
+	report, err := b.Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if runs != 5 {
+		t.Errorf("expected 5 runs, got %d", runs)
+	}
+	if report.Runs != 3 || report.Warmup != 2 || len(report.Samples) != 3 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	// The warmup runs are discarded
+	first := report.Samples[0]
+	if first.Run != 1 || first.WallTimeUsec != 3000000 || first.CPUTimeUsec != 3000 || first.PeakMemory != 3072 {
+		t.Errorf("unexpected first sample: %+v", first)
+	}
+	if report.Metrics[0].Name != "wall time" || report.Metrics[0].Statistics.Mean != 4000000 {
+		t.Errorf("unexpected wall time statistics: %+v", report.Metrics[0])
+	}
+	if !strings.Contains(progress.String(), "giogo bench: warmup 2/2\ngiogo bench: run 1/3\n") {
+		t.Errorf("unexpected progress: %q", progress.String())
+	}
+	prepared, err := os.ReadFile(marker)
+	if err != nil || strings.Count(string(prepared), "x") != 5 {
+		t.Errorf("expected the prepare command before each of the 5 runs, got %q (%v)", prepared, err)
+	}
+
+	failure := errors.New("exit status 1")
+	b.Prepare = ""
+	b.Run = func(collector *bench.Collector) error { return failure }
+	if _, err := b.Execute(); !errors.Is(err, failure) {
+		t.Errorf("expected the run error, got %v", err)
+	}
+
+	b.Runs = 0
+	if _, err := b.Execute(); err == nil {
+		t.Errorf("expected error without runs")
+	}
+}
+
+func TestReportWrite(t *testing.T) {
+	report := bench.NewReport([]string{"make"}, specs.LinuxResources{}, 1, []bench.Sample{
+		{Run: 1, WallTimeUsec: 1500000, CPUTimeUsec: 500, PeakMemory: 2048},
+		{Run: 2, WallTimeUsec: 2500000, CPUTimeUsec: 700, PeakMemory: 4096},
+	})
+
+	var csv bytes.Buffer
+	if err := report.WriteCSV(&csv); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedCSV := "run,wall_time_usec,cpu_time_usec,peak_memory_bytes\n1,1500000,500,2048\n2,2500000,700,4096\n"
+	if csv.String() != expectedCSV {
+		t.Errorf("expected CSV:\n%s\ngot:\n%s", expectedCSV, csv.String())
+	}
+
+	var text bytes.Buffer
+	if err := report.WriteText(&text); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, expected := range []string{"2 runs, 1 warmup", "wall time    2s", "cpu time     600µs", "peak memory  3.0k"} {
+		if !strings.Contains(text.String(), expected) {
+			t.Errorf("expected %q in:\n%s", expected, text.String())
+		}
+	}
+
+	var js bytes.Buffer
+	if err := report.WriteJSON(&js); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(js.String(), `"wall_time_usec": 1500000`) || !strings.Contains(js.String(), `"p95"`) {
+		t.Errorf("unexpected JSON:\n%s", js.String())
+	}
+}
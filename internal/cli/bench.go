@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pmarchini/giogo/internal/bench"
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/executor"
+	"github.com/spf13/cobra"
+)
+
+// NewBenchCommand creates the bench subcommand, which runs a command repeatedly under the same limits
+func NewBenchCommand() *cobra.Command {
+	var runs, warmup int
+	var prepare, exportJSON, exportCSV string
+	cmd := &cobra.Command{
+		Use:   "bench [flags] -- command [args...]",
+		Short: "Run a command repeatedly in fresh cgroups and report wall time, CPU time and peak memory statistics",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			limiters, identity, err := limitsFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+
+			b := &bench.Benchmark{
+				Command: args,
+				Runs:    runs,
+				Warmup:  warmup,
+				Prepare: prepare,
+				Run: func(collector *bench.Collector) error {
+					exec := executor.NewExecutor(limiters)
+					exec.Identity = identity
+					exec.Reporters = []core.Reporter{collector}
+					return exec.RunCommand(args)
+				},
+				Progress: cmd.ErrOrStderr(),
+			}
+			report, err := b.Execute()
+			if err != nil {
+				return err
+			}
+			return writeBenchReport(report, cmd.OutOrStdout(), exportJSON, exportCSV)
+		},
+	}
+	cmd.Flags().IntVarP(&runs, "runs", "n", bench.DefaultRuns, "Number of measured runs")
+	cmd.Flags().IntVar(&warmup, "warmup", 0, "Number of runs made before the measured ones, and discarded")
+	cmd.Flags().StringVar(&prepare, "prepare", "", "Shell command run before every run, outside of the cgroup (e.g., to drop the page cache)")
+	cmd.Flags().StringVar(&exportJSON, "export-json", "", "Write the statistics and the raw samples to this JSON file")
+	cmd.Flags().StringVar(&exportCSV, "export-csv", "", "Write the raw samples to this CSV file")
+	addLimitFlags(cmd)
+	return cmd
+}
+
+// writeBenchReport prints the statistics of the benchmark and exports them
+func writeBenchReport(report *bench.Report, stdout io.Writer, exportJSON, exportCSV string) error {
+	if err := report.WriteText(stdout); err != nil {
+		return err
+	}
+	for _, export := range []struct {
+		path  string
+		write func(io.Writer) error
+	}{
+		{exportJSON, report.WriteJSON},
+		{exportCSV, report.WriteCSV},
+	} {
+		if export.path == "" {
+			continue
+		}
+		f, err := os.Create(export.path)
+		if err != nil {
+			return fmt.Errorf("error exporting the benchmark: %v", err)
+		}
+		if err := export.write(f); err != nil {
+			f.Close()
+			return fmt.Errorf("error exporting the benchmark: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("error exporting the benchmark: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package cli_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pmarchini/giogo/internal/cli"
+)
+
+func TestBenchCommand_InvalidFlags(t *testing.T) {
+	for _, args := range [][]string{
+		{"--runs=0", "--", "true"},
+		{"--warmup=-1", "--", "true"},
+		{"--cpuset=3-1", "--", "true"},
+		{"--cpu=2", "--", "true"},
+	} {
+		cmd := cli.NewBenchCommand()
+		cmd.SetOut(new(bytes.Buffer))
+		cmd.SetErr(new(bytes.Buffer))
+		cmd.SetArgs(args)
+		if err := cmd.Execute(); err == nil {
+			t.Errorf("expected error for %v", args)
+		}
+	}
+}
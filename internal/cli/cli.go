@@ -1,41 +1,252 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/pmarchini/giogo/internal/assertion"
+	"github.com/pmarchini/giogo/internal/core"
 	"github.com/pmarchini/giogo/internal/executor"
+	"github.com/pmarchini/giogo/internal/history"
 	"github.com/pmarchini/giogo/internal/limiter"
+	"github.com/pmarchini/giogo/internal/metrics"
+	"github.com/pmarchini/giogo/internal/monitor"
+	"github.com/pmarchini/giogo/internal/recommend"
+	"github.com/pmarchini/giogo/internal/record"
+	"github.com/pmarchini/giogo/internal/summary"
+	"github.com/pmarchini/giogo/internal/utils"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	ram        string
-	cpu        string
-	ioReadMax  string
-	ioWriteMax string
+	ram                  string
+	cpu                  string
+	cpuset               string
+	profilePath          string
+	ioReadMax            string
+	ioWriteMax           string
+	rlimits              []string
+	nice                 string
+	ioniceClass          string
+	ioniceLevel          string
+	oomScoreAdj          string
+	runAsUser            string
+	runAsGroup           string
+	dropPrivs            bool
+	cpuTimeMax           string
+	ioReadTotalMax       string
+	ioWriteTotalMax      string
+	ioBudgetDevices      []string
+	onBudgetExceeded     string
+	graceSignal          string
+	gracePeriod          time.Duration
+	summaryFormat        string
+	summaryFile          string
+	statsInterval        time.Duration
+	statsFormat          string
+	statsFile            string
+	metricsListen        string
+	metricsTextfile      string
+	labelValues          []string
+	psiTriggers          []string
+	eventsFormat         string
+	eventsFile           string
+	oomSnapshotDir       string
+	oomSnapshotThreshold int
+	detectLeaks          string
+	leakWindow           time.Duration
+	estimateWSS          bool
+	wssInterval          time.Duration
+	wssMaxPressure       float64
+	trackProcesses       bool
+	recordPath           string
+	recordInterval       time.Duration
+	assertPeakMemory     string
+	assertCPUTime        string
+	assertIORead         string
+	assertIOWrite        string
+	assertNoThrottling   bool
+	recommendLimits      bool
+	historyPath          string
 )
 
 func SetupRootCommand(rootCmd *cobra.Command) {
 	rootCmd.Use = "giogo [flags] -- command [args...]"
 	rootCmd.Short = "Giogo runs commands with specified cgroup resource limits"
 	rootCmd.RunE = runCommand
-	rootCmd.Args = cobra.MinimumNArgs(1)
+	rootCmd.Args = cobra.MatchAll(cobra.MinimumNArgs(1), requireDash)
+	// A command named completion must keep running under giogo
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+
+	rootCmd.AddCommand(NewReportCommand())
+	rootCmd.AddCommand(NewCompareCommand())
+	rootCmd.AddCommand(NewBenchCommand())
+	rootCmd.AddCommand(NewMatrixCommand())
+	rootCmd.AddCommand(NewProbeCommand())
+	rootCmd.AddCommand(NewRecommendCommand())
+	rootCmd.AddCommand(NewPSCommand())
+	rootCmd.AddCommand(NewTopCommand())
+	rootCmd.AddCommand(NewFreezeCommand())
+	rootCmd.AddCommand(NewThawCommand())
+	rootCmd.AddCommand(NewKillCommand())
+	rootCmd.AddCommand(NewSetCommand())
+	rootCmd.AddCommand(NewHistoryCommand())
 
 	// Define flags
-	rootCmd.Flags().StringVar(&ram, "ram", "", "Memory limit (e.g., 128m, 1g)")
-	rootCmd.Flags().StringVar(&cpu, "cpu", "", "CPU limit as a fraction between 0 and 1 (e.g., 0.5)")
-	rootCmd.Flags().StringVar(&ioReadMax, "io-read-max", limiter.UnlimitedIOValue, "IO read max bandwidth (e.g., 128k, 1m)")
-	rootCmd.Flags().StringVar(&ioWriteMax, "io-write-max", limiter.UnlimitedIOValue, "IO write max bandwidth (e.g., 128k, 1m)")
+	addLimitFlags(rootCmd)
+	rootCmd.Flags().StringVar(&cpuTimeMax, "cpu-time-max", "", "Total CPU time budget of the command (e.g., 90s, 10m)")
+	rootCmd.Flags().StringVar(&ioReadTotalMax, "io-read-total-max", "", "Total IO read budget of the command (e.g., 512m, 10g)")
+	rootCmd.Flags().StringVar(&ioWriteTotalMax, "io-write-total-max", "", "Total IO write budget of the command (e.g., 512m, 10g)")
+	rootCmd.Flags().StringSliceVar(&ioBudgetDevices, "io-budget-devices", nil, "Block devices counted by the IO budgets, as names or major:minor (e.g., sda,259:0), every physical disk when not set")
+	rootCmd.Flags().StringVar(&onBudgetExceeded, "on-budget-exceeded", string(limiter.BudgetActionKill), "Action taken when a budget is exceeded (freeze, kill, warn)")
+	rootCmd.Flags().StringVar(&graceSignal, "budget-grace-signal", "", "Signal sent before killing a group that exceeded a budget (e.g., TERM)")
+	rootCmd.Flags().DurationVar(&gracePeriod, "budget-grace-period", 10*time.Second, "Time left to exit after the budget grace signal")
+	rootCmd.Flags().StringVar(&summaryFormat, "summary", "", "Print a resource usage summary when the command exits (text, json)")
+	rootCmd.Flags().Lookup("summary").NoOptDefVal = string(summary.FormatText)
+	rootCmd.Flags().StringVar(&summaryFile, "summary-file", "", "Write the summary to this file instead of stderr")
+	rootCmd.Flags().DurationVar(&statsInterval, "stats-interval", 0, "Sample the cgroup usage at this interval while the command runs (e.g., 1s)")
+	rootCmd.Flags().StringVar(&statsFormat, "stats-format", string(monitor.FormatJSONLines), "Format of the live statistics (jsonl, csv)")
+	rootCmd.Flags().StringVar(&statsFile, "stats-file", "", "Write the live statistics to this file instead of stderr")
+	rootCmd.Flags().StringVar(&eventsFormat, "events", "", "Report memory, pids and cgroup events such as OOM kills as they happen (text, jsonl)")
+	rootCmd.Flags().Lookup("events").NoOptDefVal = string(monitor.EventFormatText)
+	rootCmd.Flags().StringVar(&eventsFile, "events-file", "", "Write the events to this file instead of stderr")
+	rootCmd.Flags().StringVar(&oomSnapshotDir, "oom-snapshot-dir", "", "Capture memory diagnostics in a timestamped directory under this one when the group is close to or hits an OOM")
+	rootCmd.Flags().IntVar(&oomSnapshotThreshold, "oom-snapshot-threshold", monitor.DefaultOOMSnapshotThreshold, "Share of the memory limit, in percent, that triggers an OOM snapshot (0 to only react to memory events)")
+	rootCmd.Flags().StringVar(&detectLeaks, "detect-leaks", "", "Warn when the memory usage, without the file cache, grows steadily (text, jsonl)")
+	rootCmd.Flags().Lookup("detect-leaks").NoOptDefVal = string(monitor.EventFormatText)
+	rootCmd.Flags().DurationVar(&leakWindow, "leak-window", monitor.DefaultLeakWindow, "Time span over which a steady memory growth is a suspected leak")
+	rootCmd.Flags().BoolVar(&estimateWSS, "estimate-wss", false, "Estimate the working set of the command with proactive reclaim, see the summary and the live statistics")
+	rootCmd.Flags().DurationVar(&wssInterval, "wss-interval", monitor.DefaultWSSInterval, "Time between two proactive reclaims of the working set estimation")
+	rootCmd.Flags().Float64Var(&wssMaxPressure, "wss-max-pressure", monitor.DefaultWSSMaxPressure, "Memory pressure, the some avg10 percentage, above which proactive reclaim pauses")
+	rootCmd.Flags().BoolVar(&trackProcesses, "processes", false, "Track the processes of the group and list them in the summary, the JSON live statistics and the recording")
+	rootCmd.Flags().StringVar(&recordPath, "record", "", "Record the cgroup stats, events and limits of the run to this file (e.g., run.giogo), see giogo report")
+	rootCmd.Flags().DurationVar(&recordInterval, "record-interval", record.DefaultInterval, "Time between two samples of the recording")
+	rootCmd.Flags().StringVar(&assertPeakMemory, "assert-peak-memory", "", "Fail when the peak memory usage exceeds this size (e.g., --assert-peak-memory<=512m)")
+	rootCmd.Flags().StringVar(&assertCPUTime, "assert-cpu-time", "", "Fail when the CPU time exceeds this duration (e.g., --assert-cpu-time<=30s)")
+	rootCmd.Flags().StringVar(&assertIORead, "assert-io-read", "", "Fail when the bytes read exceed this size (e.g., --assert-io-read<=1g)")
+	rootCmd.Flags().StringVar(&assertIOWrite, "assert-io-write", "", "Fail when the bytes written exceed this size (e.g., --assert-io-write<=1g)")
+	rootCmd.Flags().BoolVar(&assertNoThrottling, "assert-no-throttling", false, "Fail when the CPU was throttled or memory.high was hit")
+	rootCmd.Flags().BoolVar(&recommendLimits, "recommend", false, "Sample the usage of the command and propose limits when it exits, see giogo recommend")
+	rootCmd.Flags().StringArrayVar(&psiTriggers, "psi-trigger", nil, "Run a command, or print an event, when the group stalls on a resource (e.g., memory:some:150ms/1s=./dump.sh), repeatable")
+	rootCmd.Flags().StringVar(&metricsListen, "metrics-listen", "", "Serve Prometheus metrics of the group on this address or unix socket (e.g., 127.0.0.1:9200, unix:/run/giogo.sock)")
+	rootCmd.Flags().StringVar(&metricsTextfile, "metrics-textfile", "", "Write the final metrics to this node_exporter textfile collector file (e.g., /var/lib/node_exporter/giogo.prom)")
+	rootCmd.Flags().StringArrayVar(&labelValues, "label", nil, "Label attached to the run as key=value, repeatable")
+	rootCmd.Flags().StringVar(&historyPath, "history", "", "Record the run, its labels, limits, exit reason and final stats in this history file, see giogo history")
+	rootCmd.Flags().Lookup("history").NoOptDefVal = history.DefaultPath
+}
+
+// addLimitFlags defines the limits and the identity of the command, shared by the commands running it
+func addLimitFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVar(&profilePath, "profile", "", "Read flags from this profile, one name = value per line, flags given on the command line take precedence")
+	flags.StringVar(&ram, "ram", "", "Memory limit (e.g., 128m, 1g)")
+	flags.StringVar(&cpu, "cpu", "", "CPU limit as a fraction between 0 and 1 (e.g., 0.5)")
+	flags.StringVar(&cpuset, "cpuset", "", "Pin the command to these CPUs (e.g., 0-3, 0,2)")
+	flags.StringVar(&ioReadMax, "io-read-max", limiter.UnlimitedIOValue, "IO read max bandwidth (e.g., 128k, 1m)")
+	flags.StringVar(&ioWriteMax, "io-write-max", limiter.UnlimitedIOValue, "IO write max bandwidth (e.g., 128k, 1m)")
+	flags.StringArrayVar(&rlimits, "rlimit", nil, "Per-process rlimit as NAME=soft[:hard] (NOFILE, CORE, FSIZE, STACK, AS), repeatable")
+	flags.StringVar(&nice, "nice", "", "Nice value of the command, between -20 and 19")
+	flags.StringVar(&ioniceClass, "ionice-class", "", "IO scheduling class (none, realtime, best-effort, idle)")
+	flags.StringVar(&ioniceLevel, "ionice-level", "", "IO scheduling level between 0 and 7 (realtime and best-effort classes)")
+	flags.StringVar(&oomScoreAdj, "oom-score-adj", "", "OOM score adjustment of the command, between -1000 and 1000")
+	flags.StringVar(&runAsUser, "user", "", "Run the command as this user (name or uid) after the cgroup setup")
+	flags.StringVar(&runAsGroup, "group", "", "Run the command with this primary group (name or gid), requires --user")
+	flags.BoolVar(&dropPrivs, "drop-privileges", false, "Run the command as the user who invoked sudo (SUDO_UID/SUDO_GID)")
+}
+
+// ApplyProfile sets the flags of cmd read from the profile at path, flags given on the command line take precedence
+func ApplyProfile(cmd *cobra.Command, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error reading profile: %v", err)
+	}
+	defer f.Close()
+	settings, err := recommend.ParseProfile(f)
+	if err != nil {
+		return fmt.Errorf("error reading profile %s: %v", path, err)
+	}
+	for _, setting := range settings {
+		flag := cmd.Flags().Lookup(setting.Flag)
+		if flag == nil || flag.Name == "profile" {
+			return fmt.Errorf("unknown flag %q in profile %s", setting.Flag, path)
+		}
+		if flag.Changed {
+			continue
+		}
+		if err := cmd.Flags().Set(setting.Flag, setting.Value); err != nil {
+			return fmt.Errorf("invalid %s in profile %s: %v", setting.Flag, path, err)
+		}
+	}
+	return nil
+}
+
+// requireDash rejects a command not separated from the flags by --: a bare first argument is matched against the
+// subcommands, so a command sharing a name with one of them would not run
+func requireDash(cmd *cobra.Command, args []string) error {
+	if cmd.ArgsLenAtDash() != 0 {
+		return fmt.Errorf("unknown command %q, separate the command to run from the flags with --, e.g. giogo --ram=1g -- %s", args[0], strings.Join(args, " "))
+	}
+	return nil
+}
+
+// limitsFromFlags creates the limiters and resolves the identity defined by the limit flags of cmd, and its profile
+func limitsFromFlags(cmd *cobra.Command) ([]limiter.ResourceLimiter, *core.Identity, error) {
+	if profilePath != "" {
+		if err := ApplyProfile(cmd, profilePath); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	limiters, err := CreateLimiters(cpu, ram, ioReadMax, ioWriteMax)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cpuset != "" {
+		cpusetLimiter, err := limiter.NewCpusetLimiter(cpuset)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid cpuset value: %v", err)
+		}
+		limiters = append(limiters, cpusetLimiter)
+	}
+
+	processLimiters, err := CreateProcessLimiters(ProcessOptions{
+		Rlimits:     rlimits,
+		Nice:        nice,
+		IONiceClass: ioniceClass,
+		IONiceLevel: ioniceLevel,
+		OOMScoreAdj: oomScoreAdj,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	limiters = append(limiters, processLimiters...)
+
+	identity, err := ResolveIdentity(runAsUser, runAsGroup, dropPrivs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return limiters, identity, nil
 }
 
 func Execute() {
 	var rootCmd = &cobra.Command{}
 	SetupRootCommand(rootCmd)
+	rootCmd.SetArgs(NormalizeAssertionArgs(os.Args[1:]))
+	// The error is printed once, to stderr, so that it never mixes with the output of a subcommand
+	rootCmd.SilenceErrors = true
 
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
+		// Errors such as an exceeded budget carry their own exit code
+		var exitCoder interface{ ExitCode() int }
+		if errors.As(err, &exitCoder) {
+			os.Exit(exitCoder.ExitCode())
+		}
 		os.Exit(1)
 	}
 }
@@ -92,13 +303,481 @@ func CreateLimiters(cpu, ram, ioReadMax, ioWriteMax string) ([]limiter.ResourceL
 	return limiters, nil
 }
 
+// ProcessOptions holds the per-process settings applied to the launched command
+type ProcessOptions struct {
+	Rlimits                  []string
+	Nice                     string
+	IONiceClass, IONiceLevel string
+	OOMScoreAdj              string
+}
+
+// CreateProcessLimiters creates the limiters that act on the launched process instead of the cgroup
+func CreateProcessLimiters(opts ProcessOptions) ([]limiter.ResourceLimiter, error) {
+	var limiters []limiter.ResourceLimiter
+
+	if len(opts.Rlimits) > 0 {
+		rlimitLimiter, err := limiter.NewRlimitLimiter(opts.Rlimits)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rlimit value: %v", err)
+		}
+		limiters = append(limiters, rlimitLimiter)
+	}
+
+	if opts.Nice != "" {
+		niceLimiter, err := limiter.NewNiceLimiter(opts.Nice)
+		if err != nil {
+			return nil, fmt.Errorf("invalid nice value: %v", err)
+		}
+		limiters = append(limiters, niceLimiter)
+	}
+
+	if opts.IONiceClass != "" || opts.IONiceLevel != "" {
+		ioniceLimiter, err := limiter.NewIONiceLimiter(&limiter.IONiceLimiterInitializer{
+			Class: opts.IONiceClass,
+			Level: opts.IONiceLevel,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid ionice value: %v", err)
+		}
+		if len(ioniceLimiter.UnsupportedDevices) > 0 {
+			fmt.Fprintf(os.Stderr, "warning: the ionice class has no effect on devices without the BFQ scheduler: %s\n", strings.Join(ioniceLimiter.UnsupportedDevices, ", "))
+		}
+		limiters = append(limiters, ioniceLimiter)
+	}
+
+	if opts.OOMScoreAdj != "" {
+		oomLimiter, err := limiter.NewOOMScoreAdjLimiter(opts.OOMScoreAdj)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OOM score adjustment: %v", err)
+		}
+		limiters = append(limiters, oomLimiter)
+	}
+
+	return limiters, nil
+}
+
+// BudgetOptions holds the total usage budgets enforced while the command runs
+type BudgetOptions struct {
+	CPUTimeMax                      string
+	IOReadTotalMax, IOWriteTotalMax string
+	// IOBudgetDevices are the devices the IO budgets count, every device when empty
+	IOBudgetDevices  []string
+	OnBudgetExceeded string
+	GraceSignal      string
+	GracePeriod      time.Duration
+}
+
+// CreateBudgetLimiters creates the limiters that terminate the group once a total usage budget is spent
+func CreateBudgetLimiters(opts BudgetOptions) ([]limiter.ResourceLimiter, error) {
+	var limiters []limiter.ResourceLimiter
+
+	policy := limiter.BudgetPolicy{
+		Action: limiter.BudgetActionKill,
+		Grace:  limiter.Grace{Period: opts.GracePeriod},
+	}
+	if opts.OnBudgetExceeded != "" {
+		action, err := limiter.ParseBudgetAction(opts.OnBudgetExceeded)
+		if err != nil {
+			return nil, err
+		}
+		policy.Action = action
+	}
+	if opts.GraceSignal != "" {
+		sig, err := utils.ParseSignal(opts.GraceSignal)
+		if err != nil {
+			return nil, fmt.Errorf("invalid budget grace signal: %v", err)
+		}
+		policy.Grace.Signal = sig
+	}
+
+	if opts.CPUTimeMax != "" {
+		cpuTimeLimiter, err := limiter.NewCPUTimeLimiter(opts.CPUTimeMax, policy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPU time value: %v", err)
+		}
+		limiters = append(limiters, cpuTimeLimiter)
+	}
+
+	if opts.IOReadTotalMax != "" || opts.IOWriteTotalMax != "" {
+		ioBudgetLimiter, err := limiter.NewIOBudgetLimiter(&limiter.IOBudgetLimiterInitializer{
+			ReadTotalMax:  opts.IOReadTotalMax,
+			WriteTotalMax: opts.IOWriteTotalMax,
+			Devices:       opts.IOBudgetDevices,
+			Policy:        policy,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid IO budget value: %v", err)
+		}
+		limiters = append(limiters, ioBudgetLimiter)
+	}
+
+	return limiters, nil
+}
+
+// MonitorOptions holds the settings of the watchers observing the cgroup while the command runs
+type MonitorOptions struct {
+	StatsInterval time.Duration
+	StatsFormat   string
+	StatsFile     string
+	PSITriggers   []string
+	EventsFormat  string
+	EventsFile    string
+	// OOMSnapshotDir enables the OOM snapshots, OOMSnapshotThreshold is a percentage of the memory limit
+	OOMSnapshotDir       string
+	OOMSnapshotThreshold int
+	// LeaksFormat enables the leak detection, whose trend spans LeakWindow
+	LeaksFormat string
+	LeakWindow  time.Duration
+	// EstimateWSS enables the working set estimation, reclaiming every WSSInterval unless the pressure exceeds WSSMaxPressure
+	EstimateWSS    bool
+	WSSInterval    time.Duration
+	WSSMaxPressure float64
+	// TrackProcesses reads the processes of the group along with its stats
+	TrackProcesses bool
+	// TrackIO names the block devices in the stats and measures the bandwidths achieved on them
+	TrackIO       bool
+	MetricsListen string
+	// Name is the name of the run
+	Name   string
+	Labels []core.Label
+}
+
+// CreateWatchers creates the watchers that observe the cgroup while the command runs
+func CreateWatchers(opts MonitorOptions) ([]core.Watcher, error) {
+	var watchers []core.Watcher
+
+	if opts.StatsInterval < 0 {
+		return nil, fmt.Errorf("invalid stats interval: %v", opts.StatsInterval)
+	}
+	if opts.StatsInterval > 0 {
+		format, err := monitor.ParseFormat(opts.StatsFormat)
+		if err != nil {
+			return nil, err
+		}
+		watchers = append(watchers, &monitor.StatsWriter{
+			Interval: opts.StatsInterval,
+			Format:   format,
+			Path:     opts.StatsFile,
+		})
+	}
+
+	if opts.EventsFormat != "" || opts.EventsFile != "" {
+		format := monitor.EventFormatText
+		if opts.EventsFile != "" {
+			// A file is meant to be processed, so it defaults to JSON Lines
+			format = monitor.EventFormatJSONLines
+		}
+		if opts.EventsFormat != "" {
+			var err error
+			format, err = monitor.ParseEventFormat(opts.EventsFormat)
+			if err != nil {
+				return nil, err
+			}
+		}
+		watchers = append(watchers, &monitor.EventWatcher{Format: format, Path: opts.EventsFile, Labels: opts.Labels})
+	}
+
+	var snapshotter *monitor.OOMSnapshotter
+	if opts.OOMSnapshotDir != "" {
+		if opts.OOMSnapshotThreshold < 0 || opts.OOMSnapshotThreshold > 100 {
+			return nil, fmt.Errorf("OOM snapshot threshold %d out of range [0, 100]", opts.OOMSnapshotThreshold)
+		}
+		snapshotter = &monitor.OOMSnapshotter{
+			Dir:       opts.OOMSnapshotDir,
+			Name:      opts.Name,
+			Threshold: opts.OOMSnapshotThreshold,
+		}
+		watchers = append(watchers, snapshotter)
+	}
+
+	if opts.LeaksFormat != "" {
+		format, err := monitor.ParseEventFormat(opts.LeaksFormat)
+		if err != nil {
+			return nil, err
+		}
+		// A zero window is the default one
+		if opts.LeakWindow < 0 || (opts.LeakWindow > 0 && opts.LeakWindow < monitor.MinLeakWindow) {
+			return nil, fmt.Errorf("invalid leak window: %v, expected at least %v", opts.LeakWindow, monitor.MinLeakWindow)
+		}
+		// A suspected leak takes a snapshot early, long before the group is close to its limit
+		watchers = append(watchers, &monitor.LeakDetector{Window: opts.LeakWindow, Format: format, Snapshotter: snapshotter})
+	}
+
+	if opts.EstimateWSS {
+		if opts.WSSInterval <= 0 {
+			return nil, fmt.Errorf("invalid working set estimation interval: %v", opts.WSSInterval)
+		}
+		if opts.WSSMaxPressure <= 0 || opts.WSSMaxPressure > 100 {
+			return nil, fmt.Errorf("working set estimation max pressure %v out of range (0, 100]", opts.WSSMaxPressure)
+		}
+		watchers = append(watchers, &monitor.WSSEstimator{Interval: opts.WSSInterval, MaxPressure: opts.WSSMaxPressure})
+	}
+
+	if opts.TrackProcesses {
+		watchers = append(watchers, &monitor.ProcessTracker{})
+	}
+
+	if opts.TrackIO {
+		// The bandwidths of every sample of the live statistics cover the interval since the previous one
+		watchers = append(watchers, &monitor.IOTracker{Interval: opts.StatsInterval})
+	}
+
+	for _, value := range opts.PSITriggers {
+		trigger, err := monitor.ParsePSITrigger(value)
+		if err != nil {
+			return nil, err
+		}
+		watchers = append(watchers, trigger)
+	}
+
+	if opts.MetricsListen != "" {
+		if err := metrics.ValidateLabels(opts.Labels); err != nil {
+			return nil, err
+		}
+		// Listen right away so an unavailable address is reported before the command starts
+		listener, err := metrics.Listen(opts.MetricsListen)
+		if err != nil {
+			return nil, fmt.Errorf("error listening for metrics: %v", err)
+		}
+		watchers = append(watchers, &metrics.Server{
+			Listener: listener,
+			Name:     opts.Name,
+			Labels:   opts.Labels,
+		})
+	}
+
+	return watchers, nil
+}
+
+// CreateRecorder creates the recorder of the run, it is both a watcher and a reporter
+func CreateRecorder(path string, interval time.Duration) (*record.Recorder, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("record interval must be positive, got %v", interval)
+	}
+	return &record.Recorder{Path: path, Interval: interval}, nil
+}
+
+// NormalizeAssertionArgs rewrites --assert-NAME<=VALUE to --assert-NAME=VALUE, flag names cannot hold the operator.
+// The arguments of the command, after --, are left untouched.
+func NormalizeAssertionArgs(args []string) []string {
+	normalized := make([]string, 0, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			return append(normalized, args[i:]...)
+		}
+		if strings.HasPrefix(arg, "--assert-") {
+			if name, value, found := strings.Cut(arg, "<="); found && !strings.Contains(name, "=") {
+				arg = name + "=" + value
+			}
+		}
+		normalized = append(normalized, arg)
+	}
+	return normalized
+}
+
+// AssertionOptions holds the resource assertions evaluated on the final stats of the cgroup
+type AssertionOptions struct {
+	PeakMemory   string
+	CPUTime      string
+	IORead       string
+	IOWrite      string
+	NoThrottling bool
+}
+
+// CreateAssertionChecker creates the checker of the resource assertions, nil when there is none
+func CreateAssertionChecker(opts AssertionOptions) (*assertion.Checker, error) {
+	var assertions []*assertion.Assertion
+	for _, bytesAssertion := range []struct {
+		name, value string
+		measure     func(*core.Stats) (uint64, bool)
+	}{
+		{"peak memory", opts.PeakMemory, assertion.PeakMemory},
+		{"io read", opts.IORead, assertion.IORead},
+		{"io write", opts.IOWrite, assertion.IOWrite},
+	} {
+		if bytesAssertion.value == "" {
+			continue
+		}
+		a, err := assertion.NewBytesAssertion(bytesAssertion.name, bytesAssertion.value, bytesAssertion.measure)
+		if err != nil {
+			return nil, err
+		}
+		assertions = append(assertions, a)
+	}
+	if opts.CPUTime != "" {
+		a, err := assertion.NewDurationAssertion("cpu time", opts.CPUTime, assertion.CPUTime)
+		if err != nil {
+			return nil, err
+		}
+		assertions = append(assertions, a)
+	}
+	if opts.NoThrottling {
+		assertions = append(assertions, assertion.NoThrottling())
+	}
+
+	if len(assertions) == 0 {
+		return nil, nil
+	}
+	return &assertion.Checker{Assertions: assertions}, nil
+}
+
+// ReportOptions holds the settings of the reporters receiving the final usage of the cgroup
+type ReportOptions struct {
+	SummaryFormat   string
+	SummaryFile     string
+	MetricsTextfile string
+	// Assertions, when set, are evaluated before the run is recorded in the history
+	Assertions *assertion.Checker
+	// HistoryPath is the history the run is recorded in
+	HistoryPath string
+	Labels      []core.Label
+}
+
+// CreateReporters creates the reporters that receive the final usage of the cgroup
+func CreateReporters(opts ReportOptions) ([]core.Reporter, error) {
+	var reporters []core.Reporter
+
+	if opts.SummaryFormat != "" || opts.SummaryFile != "" {
+		format := summary.FormatText
+		if opts.SummaryFormat != "" {
+			var err error
+			format, err = summary.ParseFormat(opts.SummaryFormat)
+			if err != nil {
+				return nil, err
+			}
+		}
+		reporters = append(reporters, &summary.Reporter{Format: format, Path: opts.SummaryFile})
+	}
+
+	if opts.MetricsTextfile != "" {
+		if err := metrics.ValidateLabels(opts.Labels); err != nil {
+			return nil, err
+		}
+		reporters = append(reporters, &metrics.Textfile{Path: opts.MetricsTextfile, Labels: opts.Labels})
+	}
+
+	if opts.Assertions != nil {
+		reporters = append(reporters, opts.Assertions)
+	}
+
+	if opts.HistoryPath != "" {
+		reporters = append(reporters, &history.Reporter{Path: opts.HistoryPath, User: history.CurrentUser(), Labels: opts.Labels})
+	}
+
+	return reporters, nil
+}
+
+// ResolveIdentity returns the identity the command runs as, nil when privileges are not dropped
+func ResolveIdentity(userName, groupName string, sudo bool) (*core.Identity, error) {
+	if userName != "" && sudo {
+		return nil, fmt.Errorf("--user and --drop-privileges are mutually exclusive")
+	}
+	if groupName != "" && userName == "" {
+		return nil, fmt.Errorf("--group requires --user")
+	}
+	if userName != "" {
+		return core.ResolveIdentity(userName, groupName)
+	}
+	if sudo {
+		return core.SudoIdentity()
+	}
+	return nil, nil
+}
+
 func runCommand(cmd *cobra.Command, args []string) error {
-	limiters, err := CreateLimiters(cpu, ram, ioReadMax, ioWriteMax)
+	limiters, identity, err := limitsFromFlags(cmd)
 	if err != nil {
 		return err
 	}
 
+	budgetLimiters, err := CreateBudgetLimiters(BudgetOptions{
+		CPUTimeMax:       cpuTimeMax,
+		IOReadTotalMax:   ioReadTotalMax,
+		IOWriteTotalMax:  ioWriteTotalMax,
+		IOBudgetDevices:  ioBudgetDevices,
+		OnBudgetExceeded: onBudgetExceeded,
+		GraceSignal:      graceSignal,
+		GracePeriod:      gracePeriod,
+	})
+	if err != nil {
+		return err
+	}
+	limiters = append(limiters, budgetLimiters...)
+
+	labels, err := core.ParseLabels(labelValues)
+	if err != nil {
+		return err
+	}
+
+	checker, err := CreateAssertionChecker(AssertionOptions{
+		PeakMemory:   assertPeakMemory,
+		CPUTime:      assertCPUTime,
+		IORead:       assertIORead,
+		IOWrite:      assertIOWrite,
+		NoThrottling: assertNoThrottling,
+	})
+	if err != nil {
+		return err
+	}
+
+	reporters, err := CreateReporters(ReportOptions{
+		SummaryFormat:   summaryFormat,
+		SummaryFile:     summaryFile,
+		MetricsTextfile: metricsTextfile,
+		Assertions:      checker,
+		HistoryPath:     historyPath,
+		Labels:          labels,
+	})
+	if err != nil {
+		return err
+	}
+
+	// The achieved bandwidths only show in the live statistics and the summary
+	trackIO := statsInterval > 0 || summaryFormat != "" || summaryFile != ""
+	watchers, err := CreateWatchers(MonitorOptions{
+		StatsInterval:        statsInterval,
+		StatsFormat:          statsFormat,
+		StatsFile:            statsFile,
+		PSITriggers:          psiTriggers,
+		EventsFormat:         eventsFormat,
+		EventsFile:           eventsFile,
+		OOMSnapshotDir:       oomSnapshotDir,
+		OOMSnapshotThreshold: oomSnapshotThreshold,
+		LeaksFormat:          detectLeaks,
+		LeakWindow:           leakWindow,
+		EstimateWSS:          estimateWSS,
+		WSSInterval:          wssInterval,
+		WSSMaxPressure:       wssMaxPressure,
+		TrackProcesses:       trackProcesses,
+		TrackIO:              trackIO,
+		MetricsListen:        metricsListen,
+		Name:                 core.GenerateCgroupPath(),
+		Labels:               labels,
+	})
+	if err != nil {
+		return err
+	}
+
+	if recommendLimits {
+		recommender := &recommend.Recommender{Headroom: recommend.DefaultHeadroom}
+		watchers = append(watchers, recommender)
+		reporters = append(reporters, recommender)
+	}
+
+	if recordPath != "" {
+		recorder, err := CreateRecorder(recordPath, recordInterval)
+		if err != nil {
+			return err
+		}
+		watchers = append(watchers, recorder)
+		reporters = append(reporters, recorder)
+	}
+
 	exec := executor.NewExecutor(limiters)
+	exec.Identity = identity
+	exec.Watchers = watchers
+	exec.Reporters = reporters
+	exec.Labels = labels
 	if err := exec.RunCommand(args); err != nil {
 		return err
 	}
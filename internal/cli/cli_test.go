@@ -2,10 +2,18 @@ package cli_test
 
 import (
 	"bytes"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/pmarchini/giogo/internal/assertion"
 	"github.com/pmarchini/giogo/internal/cli"
+	"github.com/pmarchini/giogo/internal/core"
 	"github.com/pmarchini/giogo/internal/limiter"
+	"github.com/pmarchini/giogo/internal/metrics"
+	"github.com/pmarchini/giogo/internal/monitor"
+	"github.com/pmarchini/giogo/internal/summary"
 	"github.com/pmarchini/giogo/internal/utils"
 	"github.com/spf13/cobra"
 )
@@ -42,6 +50,20 @@ func TestExecuteCommand(t *testing.T) {
 	}
 }
 
+func TestExecuteCommandWithoutDash(t *testing.T) {
+	buf := new(bytes.Buffer)
+	rootCmd := &cobra.Command{}
+	cli.SetupRootCommand(rootCmd)
+	rootCmd.SetOut(buf)
+	rootCmd.SetErr(buf)
+	rootCmd.SetArgs([]string{"--ram=128m", "echo", "hello"})
+
+	err := rootCmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "-- echo hello") {
+		t.Fatalf("Expected an error asking for --, got %v", err)
+	}
+}
+
 // Test IO limits
 func TestExecuteIOLimits(t *testing.T) {
 	buf := new(bytes.Buffer)
@@ -149,3 +171,331 @@ func TestCreateLimiters_IOLimitsAndRAM(t *testing.T) {
 		t.Errorf("expected memory limiter to be the one provided by the user, got %v", memLimiter.Limit)
 	}
 }
+
+func TestCreateProcessLimiters_Rlimits(t *testing.T) {
+	limiters, err := cli.CreateProcessLimiters(cli.ProcessOptions{
+		Rlimits: []string{"NOFILE=1024:4096", "CORE=0"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(limiters) != 1 {
+		t.Fatalf("expected 1 limiter, got %d", len(limiters))
+	}
+	rlimitLimiter, ok := limiters[0].(*limiter.RlimitLimiter)
+	if !ok {
+		t.Fatalf("unexpected limiter type: %T", limiters[0])
+	}
+	if len(rlimitLimiter.Rlimits) != 2 {
+		t.Errorf("expected 2 rlimits, got %d", len(rlimitLimiter.Rlimits))
+	}
+
+	if _, err := cli.CreateProcessLimiters(cli.ProcessOptions{Rlimits: []string{"NOFILE"}}); err == nil {
+		t.Errorf("expected error for invalid rlimit")
+	}
+}
+
+func TestCreateProcessLimiters_Scheduling(t *testing.T) {
+	limiters, err := cli.CreateProcessLimiters(cli.ProcessOptions{
+		Nice:        "19",
+		OOMScoreAdj: "500",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(limiters) != 2 {
+		t.Fatalf("expected 2 limiters, got %d", len(limiters))
+	}
+	if _, ok := limiters[0].(*limiter.NiceLimiter); !ok {
+		t.Errorf("unexpected limiter type: %T", limiters[0])
+	}
+	if _, ok := limiters[1].(*limiter.OOMScoreAdjLimiter); !ok {
+		t.Errorf("unexpected limiter type: %T", limiters[1])
+	}
+
+	if _, err := cli.CreateProcessLimiters(cli.ProcessOptions{IONiceClass: "idle", IONiceLevel: "3"}); err == nil {
+		t.Errorf("expected error for ionice level with idle class")
+	}
+}
+
+func TestResolveIdentity(t *testing.T) {
+	identity, err := cli.ResolveIdentity("", "", false)
+	if err != nil || identity != nil {
+		t.Errorf("expected no identity without flags, got %v (%v)", identity, err)
+	}
+	if _, err := cli.ResolveIdentity("root", "", true); err == nil {
+		t.Errorf("expected error when combining --user and --drop-privileges")
+	}
+	if _, err := cli.ResolveIdentity("", "root", false); err == nil {
+		t.Errorf("expected error for --group without --user")
+	}
+	identity, err = cli.ResolveIdentity("root", "root", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if identity.UID != 0 || identity.GID != 0 {
+		t.Errorf("unexpected identity: %+v", identity)
+	}
+}
+
+func TestCreateBudgetLimiters(t *testing.T) {
+	limiters, err := cli.CreateBudgetLimiters(cli.BudgetOptions{
+		CPUTimeMax:  "10m",
+		GraceSignal: "TERM",
+		GracePeriod: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(limiters) != 1 {
+		t.Fatalf("expected 1 limiter, got %d", len(limiters))
+	}
+	cpuTimeLimiter, ok := limiters[0].(*limiter.CPUTimeLimiter)
+	if !ok {
+		t.Fatalf("unexpected limiter type: %T", limiters[0])
+	}
+	if cpuTimeLimiter.Budget != 10*time.Minute || cpuTimeLimiter.Policy.Grace.Signal != syscall.SIGTERM || cpuTimeLimiter.Policy.Grace.Period != 5*time.Second {
+		t.Errorf("unexpected CPU time limiter: %+v", cpuTimeLimiter)
+	}
+
+	if cpuTimeLimiter.Policy.Action != limiter.BudgetActionKill {
+		t.Errorf("expected kill to be the default budget action, got %q", cpuTimeLimiter.Policy.Action)
+	}
+
+	if _, err := cli.CreateBudgetLimiters(cli.BudgetOptions{CPUTimeMax: "10m", GraceSignal: "NOPE"}); err == nil {
+		t.Errorf("expected error for invalid grace signal")
+	}
+	if _, err := cli.CreateBudgetLimiters(cli.BudgetOptions{CPUTimeMax: "10m", OnBudgetExceeded: "pause"}); err == nil {
+		t.Errorf("expected error for invalid budget action")
+	}
+}
+
+func TestCreateReporters(t *testing.T) {
+	reporters, err := cli.CreateReporters(cli.ReportOptions{})
+	if err != nil || len(reporters) != 0 {
+		t.Errorf("expected no reporters without summary flags, got %v (%v)", reporters, err)
+	}
+
+	reporters, err = cli.CreateReporters(cli.ReportOptions{SummaryFile: "/tmp/summary.txt"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(reporters) != 1 {
+		t.Fatalf("expected 1 reporter, got %d", len(reporters))
+	}
+	if r, ok := reporters[0].(*summary.Reporter); !ok || r.Format != summary.FormatText || r.Path != "/tmp/summary.txt" {
+		t.Errorf("unexpected reporter: %+v", reporters[0])
+	}
+
+	// The assertions are evaluated first so that a failure is recorded in the history
+	checker := &assertion.Checker{}
+	reporters, err = cli.CreateReporters(cli.ReportOptions{HistoryPath: "/tmp/history.jsonl", Assertions: checker})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(reporters) != 2 || reporters[0] != checker {
+		t.Errorf("expected the assertions before the history, got %v", reporters)
+	}
+
+	if _, err := cli.CreateReporters(cli.ReportOptions{SummaryFormat: "xml"}); err == nil {
+		t.Errorf("expected error for invalid summary format")
+	}
+}
+
+func TestCreateAssertionChecker(t *testing.T) {
+	checker, err := cli.CreateAssertionChecker(cli.AssertionOptions{})
+	if err != nil || checker != nil {
+		t.Errorf("expected no checker without assertions, got %v (%v)", checker, err)
+	}
+
+	checker, err = cli.CreateAssertionChecker(cli.AssertionOptions{PeakMemory: "<=512m", CPUTime: "30s", IOWrite: "1g", NoThrottling: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for _, a := range checker.Assertions {
+		names = append(names, a.Name)
+	}
+	if strings.Join(names, ",") != "peak memory,io write,cpu time,throttling events" {
+		t.Errorf("unexpected assertions: %v", names)
+	}
+
+	if _, err := cli.CreateAssertionChecker(cli.AssertionOptions{CPUTime: "soon"}); err == nil {
+		t.Errorf("expected error for invalid cpu time assertion")
+	}
+}
+
+func TestNormalizeAssertionArgs(t *testing.T) {
+	args := cli.NormalizeAssertionArgs([]string{"--assert-peak-memory<=512m", "--assert-cpu-time=<=30s", "--ram=1g", "--", "--assert-io-write<=1g"})
+	expected := []string{"--assert-peak-memory=512m", "--assert-cpu-time=<=30s", "--ram=1g", "--", "--assert-io-write<=1g"}
+	if strings.Join(args, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+}
+
+func TestCreateWatchers(t *testing.T) {
+	watchers, err := cli.CreateWatchers(cli.MonitorOptions{})
+	if err != nil || len(watchers) != 0 {
+		t.Errorf("expected no watchers by default, got %v (%v)", watchers, err)
+	}
+
+	watchers, err = cli.CreateWatchers(cli.MonitorOptions{StatsInterval: time.Second, StatsFormat: "csv"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(watchers) != 1 {
+		t.Fatalf("expected 1 watcher, got %d", len(watchers))
+	}
+	if w, ok := watchers[0].(*monitor.StatsWriter); !ok || w.Format != monitor.FormatCSV || w.Interval != time.Second {
+		t.Errorf("unexpected watcher: %+v", watchers[0])
+	}
+
+	if _, err := cli.CreateWatchers(cli.MonitorOptions{StatsInterval: time.Second, StatsFormat: "xml"}); err == nil {
+		t.Errorf("expected error for invalid stats format")
+	}
+}
+
+func TestCreateWatchers_Metrics(t *testing.T) {
+	labels := []core.Label{{Name: "team", Value: "ci"}}
+	watchers, err := cli.CreateWatchers(cli.MonitorOptions{MetricsListen: "127.0.0.1:0", Name: "giogo-cgroup-1", Labels: labels})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(watchers) != 1 {
+		t.Fatalf("expected 1 watcher, got %d", len(watchers))
+	}
+	server, ok := watchers[0].(*metrics.Server)
+	if !ok || server.Name != "giogo-cgroup-1" {
+		t.Fatalf("unexpected watcher: %+v", watchers[0])
+	}
+	server.Listener.Close()
+
+	reserved := []core.Label{{Name: "run", Value: "x"}}
+	if _, err := cli.CreateWatchers(cli.MonitorOptions{MetricsListen: "127.0.0.1:0", Labels: reserved}); err == nil {
+		t.Errorf("expected error for reserved label")
+	}
+	if _, err := cli.CreateReporters(cli.ReportOptions{MetricsTextfile: "/tmp/giogo.prom", Labels: reserved}); err == nil {
+		t.Errorf("expected error for reserved label")
+	}
+}
+
+func TestCreateWatchers_PSITriggers(t *testing.T) {
+	watchers, err := cli.CreateWatchers(cli.MonitorOptions{PSITriggers: []string{"memory:some:150ms/1s", "io:full:1s/2s=true"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(watchers) != 2 {
+		t.Fatalf("expected 2 watchers, got %d", len(watchers))
+	}
+	if trigger, ok := watchers[1].(*monitor.PSITrigger); !ok || trigger.Resource != "io" || trigger.Command != "true" {
+		t.Errorf("unexpected watcher: %+v", watchers[1])
+	}
+
+	if _, err := cli.CreateWatchers(cli.MonitorOptions{PSITriggers: []string{"memory:some"}}); err == nil {
+		t.Errorf("expected error for invalid PSI trigger")
+	}
+}
+
+func TestCreateWatchers_Events(t *testing.T) {
+	watchers, err := cli.CreateWatchers(cli.MonitorOptions{EventsFormat: "text"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w, ok := watchers[0].(*monitor.EventWatcher); !ok || w.Format != monitor.EventFormatText || w.Path != "" {
+		t.Errorf("unexpected watcher: %+v", watchers[0])
+	}
+
+	// An events file defaults to JSON Lines
+	watchers, err = cli.CreateWatchers(cli.MonitorOptions{EventsFile: "/tmp/events.jsonl"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w, ok := watchers[0].(*monitor.EventWatcher); !ok || w.Format != monitor.EventFormatJSONLines {
+		t.Errorf("unexpected watcher: %+v", watchers[0])
+	}
+
+	if _, err := cli.CreateWatchers(cli.MonitorOptions{EventsFormat: "xml"}); err == nil {
+		t.Errorf("expected error for invalid events format")
+	}
+}
+
+func TestCreateWatchers_OOMSnapshots(t *testing.T) {
+	watchers, err := cli.CreateWatchers(cli.MonitorOptions{OOMSnapshotDir: "/var/tmp", OOMSnapshotThreshold: 80, Name: "giogo-cgroup-1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w, ok := watchers[0].(*monitor.OOMSnapshotter); !ok || w.Dir != "/var/tmp" || w.Threshold != 80 || w.Name != "giogo-cgroup-1" {
+		t.Errorf("unexpected watcher: %+v", watchers[0])
+	}
+
+	if _, err := cli.CreateWatchers(cli.MonitorOptions{OOMSnapshotDir: "/var/tmp", OOMSnapshotThreshold: 120}); err == nil {
+		t.Errorf("expected error for out of range threshold")
+	}
+}
+
+func TestCreateWatchers_Leaks(t *testing.T) {
+	watchers, err := cli.CreateWatchers(cli.MonitorOptions{OOMSnapshotDir: "/var/tmp", LeaksFormat: "jsonl", LeakWindow: time.Minute})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(watchers) != 2 {
+		t.Fatalf("expected 2 watchers, got %d", len(watchers))
+	}
+	w, ok := watchers[1].(*monitor.LeakDetector)
+	if !ok || w.Format != monitor.EventFormatJSONLines || w.Window != time.Minute || w.Snapshotter != watchers[0] {
+		t.Errorf("unexpected watcher: %+v", watchers[1])
+	}
+
+	if _, err := cli.CreateWatchers(cli.MonitorOptions{LeaksFormat: "xml"}); err == nil {
+		t.Errorf("expected error for invalid format")
+	}
+	if _, err := cli.CreateWatchers(cli.MonitorOptions{LeaksFormat: "text", LeakWindow: 10 * time.Nanosecond}); err == nil {
+		t.Errorf("expected an error for a window too short to sample")
+	}
+	if _, err := cli.CreateWatchers(cli.MonitorOptions{LeaksFormat: "text", LeakWindow: -time.Minute}); err == nil {
+		t.Errorf("expected error for negative window")
+	}
+}
+
+func TestCreateWatchers_WSS(t *testing.T) {
+	watchers, err := cli.CreateWatchers(cli.MonitorOptions{EstimateWSS: true, WSSInterval: time.Second, WSSMaxPressure: 2.5})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w, ok := watchers[0].(*monitor.WSSEstimator); !ok || w.Interval != time.Second || w.MaxPressure != 2.5 {
+		t.Errorf("unexpected watcher: %+v", watchers[0])
+	}
+
+	for _, opts := range []cli.MonitorOptions{
+		{EstimateWSS: true, WSSInterval: 0, WSSMaxPressure: 1},
+		{EstimateWSS: true, WSSInterval: time.Second, WSSMaxPressure: 0},
+		{EstimateWSS: true, WSSInterval: time.Second, WSSMaxPressure: 101},
+	} {
+		if _, err := cli.CreateWatchers(opts); err == nil {
+			t.Errorf("expected error for %+v", opts)
+		}
+	}
+}
+
+func TestCreateWatchers_Processes(t *testing.T) {
+	watchers, err := cli.CreateWatchers(cli.MonitorOptions{TrackProcesses: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := watchers[0].(*monitor.ProcessTracker); !ok || len(watchers) != 1 {
+		t.Errorf("unexpected watchers: %+v", watchers)
+	}
+}
+
+func TestCreateWatchers_IO(t *testing.T) {
+	watchers, err := cli.CreateWatchers(cli.MonitorOptions{TrackIO: true, StatsInterval: 5 * time.Second, StatsFormat: "jsonl"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(watchers) != 2 {
+		t.Fatalf("expected 2 watchers, got %d", len(watchers))
+	}
+	if tracker, ok := watchers[1].(*monitor.IOTracker); !ok || tracker.Interval != 5*time.Second {
+		t.Errorf("expected an IO tracker sampling with the live statistics, got %+v", watchers[1])
+	}
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/pmarchini/giogo/internal/compare"
+	"github.com/pmarchini/giogo/internal/record"
+	"github.com/spf13/cobra"
+)
+
+// NewCompareCommand creates the compare subcommand, which diffs the metrics of two recordings
+func NewCompareCommand() *cobra.Command {
+	var threshold float64
+	var format string
+	cmd := &cobra.Command{
+		Use:   "compare BEFORE AFTER",
+		Short: "Compare two recordings made with --record and fail on regressions",
+		Args:  cobra.ExactArgs(2),
+		// A regression is a result, not a usage error
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			outputFormat, err := compare.ParseFormat(format)
+			if err != nil {
+				return err
+			}
+			if threshold < 0 {
+				return fmt.Errorf("threshold must not be negative, got %v", threshold)
+			}
+			comparison, err := CompareRecordings(args[0], args[1], threshold)
+			if err != nil {
+				return err
+			}
+			if err := comparison.Write(cmd.OutOrStdout(), outputFormat); err != nil {
+				return err
+			}
+			if regressions := comparison.Regressions(); len(regressions) > 0 {
+				return &compare.RegressionError{Regressions: regressions, Threshold: threshold}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().Float64Var(&threshold, "threshold", compare.DefaultThreshold, "Increase, in percent, beyond which a metric regressed")
+	cmd.Flags().StringVar(&format, "format", string(compare.FormatText), "Output format (text, markdown, json)")
+	return cmd
+}
+
+// CompareRecordings compares the metrics of the recordings stored at the given paths
+func CompareRecordings(beforePath, afterPath string, threshold float64) (*compare.Comparison, error) {
+	var metrics [2][]compare.Metric
+	for i, path := range []string{beforePath, afterPath} {
+		rec, err := record.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading recording %s: %v", path, err)
+		}
+		metrics[i], err = compare.Metrics(rec)
+		if err != nil {
+			return nil, fmt.Errorf("error reading recording %s: %v", path, err)
+		}
+	}
+	return &compare.Comparison{
+		Before:    beforePath,
+		After:     afterPath,
+		Threshold: threshold,
+		Diffs:     compare.Compare(metrics[0], metrics[1], threshold),
+	}, nil
+}
@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/limiter"
+	"github.com/spf13/cobra"
+)
+
+// LoadGroup returns the manager of the group of a running giogo command, given its name or its cgroup directory
+func LoadGroup(name string) (core.CgroupManager, error) {
+	dir, err := ResolveGroupDir(name)
+	if err != nil {
+		return nil, err
+	}
+	return core.LoadGroup(dir)
+}
+
+// FreezeGroup stops every process of a running group
+func FreezeGroup(name string) error {
+	manager, err := LoadGroup(name)
+	if err != nil {
+		return err
+	}
+	if err := manager.Freeze(); err != nil {
+		return fmt.Errorf("error freezing %s: %v", name, err)
+	}
+	return nil
+}
+
+// ThawGroup resumes the processes of a frozen group
+func ThawGroup(name string) error {
+	manager, err := LoadGroup(name)
+	if err != nil {
+		return err
+	}
+	if err := manager.Thaw(); err != nil {
+		return fmt.Errorf("error thawing %s: %v", name, err)
+	}
+	return nil
+}
+
+// KillGroup kills every process of a running group
+func KillGroup(name string) error {
+	manager, err := LoadGroup(name)
+	if err != nil {
+		return err
+	}
+	if err := manager.Kill(); err != nil {
+		return fmt.Errorf("error killing %s: %v", name, err)
+	}
+	return nil
+}
+
+// SetGroupLimits changes the limits of a running group, the empty ones are left as they are
+func SetGroupLimits(name, cpu, ram, ioReadMax, ioWriteMax string) error {
+	// Unlike CreateLimiters, an IO limit does not bring a memory limit: the group already runs
+	limiters, err := CreateLimiters(cpu, ram, "", "")
+	if err != nil {
+		return err
+	}
+	if ioReadMax != "" || ioWriteMax != "" {
+		ioInit := limiter.IOLimiterInitializer{ReadThrottle: limiter.UnlimitedIOValue, WriteThrottle: limiter.UnlimitedIOValue}
+		if ioReadMax != "" {
+			ioInit.ReadThrottle = ioReadMax
+		}
+		if ioWriteMax != "" {
+			ioInit.WriteThrottle = ioWriteMax
+		}
+		ioLimiter, err := limiter.NewIOLimiter(&ioInit)
+		if err != nil {
+			return fmt.Errorf("invalid IO value: %v", err)
+		}
+		limiters = append(limiters, ioLimiter)
+	}
+	if len(limiters) == 0 {
+		return fmt.Errorf("no limit to set, expected --cpu, --ram, --io-read-max or --io-write-max")
+	}
+
+	var resources specs.LinuxResources
+	for _, l := range limiters {
+		l.Apply(&resources)
+	}
+	manager, err := LoadGroup(name)
+	if err != nil {
+		return err
+	}
+	if err := manager.Update(resources); err != nil {
+		return fmt.Errorf("error setting the limits of %s: %v", name, err)
+	}
+	return nil
+}
+
+// SelectGroups returns the names of the running giogo groups carrying every label of the selector, sorted
+func SelectGroups(selector []core.Label) ([]string, error) {
+	names, err := core.ListGroups()
+	if err != nil {
+		return nil, err
+	}
+	var selected []string
+	for _, name := range names {
+		labels, err := core.ReadLabels(core.SystemdSlicePath(core.AddSliceSuffix(name)))
+		if err != nil {
+			// The group may have finished since it was listed
+			continue
+		}
+		if core.MatchLabels(labels, selector) {
+			selected = append(selected, name)
+		}
+	}
+	return selected, nil
+}
+
+// groupNames returns the groups a subcommand acts on, the one named in args or the ones selected by --label
+func groupNames(args, labelValues []string) ([]string, error) {
+	if len(args) > 0 && len(labelValues) > 0 {
+		return nil, fmt.Errorf("expected either a NAME or --label, not both")
+	}
+	if len(args) > 0 {
+		return args, nil
+	}
+	if len(labelValues) == 0 {
+		return nil, fmt.Errorf("expected a NAME or --label")
+	}
+	selector, err := core.ParseLabels(labelValues)
+	if err != nil {
+		return nil, err
+	}
+	names, err := SelectGroups(selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no running giogo group with labels %s", strings.Join(labelValues, ", "))
+	}
+	return names, nil
+}
+
+// forEachGroup runs action on every group, going on after a failure so that one finished group does not spare the others
+func forEachGroup(names []string, action func(name string) error) error {
+	var errs []error
+	for _, name := range names {
+		if err := action(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// newGroupCommand creates a subcommand acting on a running group, or on every running group selected by label
+func newGroupCommand(use, short string, action func(name string) error) *cobra.Command {
+	var labels []string
+	cmd := &cobra.Command{
+		Use:   use + " NAME | --label key=value...",
+		Short: short,
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			names, err := groupNames(args, labels)
+			if err != nil {
+				return err
+			}
+			return forEachGroup(names, action)
+		},
+	}
+	cmd.Flags().StringArrayVar(&labels, "label", nil, "Act on every running group with this label, as key=value, repeatable")
+	return cmd
+}
+
+// NewFreezeCommand creates the freeze subcommand
+func NewFreezeCommand() *cobra.Command {
+	return newGroupCommand("freeze", "Stop every process of a running giogo group until it is thawed", FreezeGroup)
+}
+
+// NewThawCommand creates the thaw subcommand
+func NewThawCommand() *cobra.Command {
+	return newGroupCommand("thaw", "Resume the processes of a frozen giogo group", ThawGroup)
+}
+
+// NewKillCommand creates the kill subcommand
+func NewKillCommand() *cobra.Command {
+	return newGroupCommand("kill", "Kill every process of a running giogo group", KillGroup)
+}
+
+// NewSetCommand creates the set subcommand, which changes the limits of a running group
+func NewSetCommand() *cobra.Command {
+	var cpu, ram, ioReadMax, ioWriteMax string
+	cmd := newGroupCommand("set", "Change the limits of a running giogo group", func(name string) error {
+		return SetGroupLimits(name, cpu, ram, ioReadMax, ioWriteMax)
+	})
+	cmd.Use = "set NAME | --label key=value... [--cpu=VALUE] [--ram=VALUE] [--io-read-max=VALUE] [--io-write-max=VALUE]"
+	cmd.Flags().StringVar(&cpu, "cpu", "", "CPU limit as a fraction between 0 and 1 (e.g., 0.5)")
+	cmd.Flags().StringVar(&ram, "ram", "", "Memory limit (e.g., 128m, 1g)")
+	cmd.Flags().StringVar(&ioReadMax, "io-read-max", "", "IO read max bandwidth (e.g., 128k, 1m)")
+	cmd.Flags().StringVar(&ioWriteMax, "io-write-max", "", "IO write max bandwidth (e.g., 128k, 1m)")
+	return cmd
+}
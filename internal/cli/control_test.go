@@ -0,0 +1,39 @@
+package cli_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/pmarchini/giogo/internal/cli"
+	"github.com/spf13/cobra"
+)
+
+func TestGroupCommands_InvalidArgs(t *testing.T) {
+	for _, test := range []struct {
+		cmd  *cobra.Command
+		args []string
+		err  string
+	}{
+		{cli.NewFreezeCommand(), []string{"giogo-cgroup-does-not-exist"}, "no running giogo group"},
+		{cli.NewThawCommand(), []string{"giogo-cgroup-does-not-exist"}, "no running giogo group"},
+		{cli.NewKillCommand(), []string{}, "expected a NAME or --label"},
+		{cli.NewKillCommand(), []string{"a", "b"}, "accepts at most 1 arg"},
+		{cli.NewFreezeCommand(), []string{"--label=team=infra", "giogo-cgroup-does-not-exist"}, "not both"},
+		{cli.NewThawCommand(), []string{"--label=team"}, "invalid label"},
+		{cli.NewKillCommand(), []string{"--label=team=infra-does-not-exist"}, "no running giogo group with labels team=infra-does-not-exist"},
+		{cli.NewSetCommand(), []string{"--ram=1g", "--label=team=infra-does-not-exist"}, "no running giogo group with labels"},
+		{cli.NewSetCommand(), []string{"giogo-cgroup-does-not-exist"}, "no limit to set"},
+		{cli.NewSetCommand(), []string{"--cpu=2", "giogo-cgroup-does-not-exist"}, "invalid"},
+		{cli.NewSetCommand(), []string{"--io-write-max=fast", "giogo-cgroup-does-not-exist"}, "invalid IO value"},
+		{cli.NewSetCommand(), []string{"--ram=1g", "giogo-cgroup-does-not-exist"}, "no running giogo group"},
+	} {
+		test.cmd.SetOut(new(bytes.Buffer))
+		test.cmd.SetErr(new(bytes.Buffer))
+		test.cmd.SetArgs(test.args)
+		err := test.cmd.Execute()
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s %v: expected an error containing %q, got %v", test.cmd.Name(), test.args, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/history"
+	"github.com/spf13/cobra"
+)
+
+// historyOptions holds the flags selecting runs of the history
+type historyOptions struct {
+	path, since, until, user, command, reason, format string
+	labels                                            []string
+}
+
+func addHistoryFlags(cmd *cobra.Command, opts *historyOptions) {
+	cmd.Flags().StringVar(&opts.path, "file", history.DefaultPath, "History file written with --history")
+	cmd.Flags().StringVar(&opts.since, "since", "", "Only runs started since this date (2006-01-02), RFC 3339 time or duration ago (e.g., 720h)")
+	cmd.Flags().StringVar(&opts.until, "until", "", "Only runs started before this date, RFC 3339 time or duration ago")
+	cmd.Flags().StringArrayVar(&opts.labels, "label", nil, "Only runs with this label, as key=value, repeatable")
+	cmd.Flags().StringVar(&opts.user, "user", "", "Only runs started by this user")
+	cmd.Flags().StringVar(&opts.command, "command", "", "Only runs whose command line contains this text")
+	cmd.Flags().StringVar(&opts.reason, "reason", "", "Only runs that ended for this reason (success, failure, oom_killed, budget_exceeded, assertion_failed, killed)")
+	cmd.Flags().StringVar(&opts.format, "format", "text", "Output format (text, json)")
+}
+
+// selectRuns reads the history and returns the runs selected by the flags
+func (opts *historyOptions) selectRuns(now time.Time) ([]history.Run, error) {
+	if opts.format != "text" && opts.format != "json" {
+		return nil, fmt.Errorf("invalid format %q, expected text or json", opts.format)
+	}
+	var filter history.Filter
+	var err error
+	if opts.since != "" {
+		if filter.Since, err = history.ParseTime(opts.since, now); err != nil {
+			return nil, fmt.Errorf("invalid --since: %v", err)
+		}
+	}
+	if opts.until != "" {
+		if filter.Until, err = history.ParseTime(opts.until, now); err != nil {
+			return nil, fmt.Errorf("invalid --until: %v", err)
+		}
+	}
+	if filter.Labels, err = core.ParseLabels(opts.labels); err != nil {
+		return nil, err
+	}
+	filter.User, filter.Command, filter.Reason = opts.user, opts.command, opts.reason
+
+	runs, err := history.ReadFile(opts.path)
+	if err != nil {
+		return nil, err
+	}
+	return history.Select(runs, filter), nil
+}
+
+// NewHistoryCommand creates the history subcommand, which lists the runs recorded with --history
+func NewHistoryCommand() *cobra.Command {
+	var opts historyOptions
+	var last int
+	cmd := &cobra.Command{
+		Use:   "history [flags]",
+		Short: "List the runs recorded with --history, with their exit reason and usage",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if last < 0 {
+				return fmt.Errorf("last must not be negative, got %d", last)
+			}
+			runs, err := opts.selectRuns(time.Now())
+			if err != nil {
+				return err
+			}
+			if last > 0 && len(runs) > last {
+				runs = runs[len(runs)-last:]
+			}
+			if opts.format == "json" {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				if runs == nil {
+					runs = []history.Run{}
+				}
+				return encoder.Encode(runs)
+			}
+			return history.WriteRunsText(cmd.OutOrStdout(), runs)
+		},
+	}
+	addHistoryFlags(cmd, &opts)
+	cmd.Flags().IntVarP(&last, "last", "n", 0, "Only the last N selected runs")
+	return cmd
+}
+
+// newReportUsageCommand creates the report usage subcommand, which aggregates the usage of the runs of the history
+func newReportUsageCommand() *cobra.Command {
+	var opts historyOptions
+	var by, window string
+	cmd := &cobra.Command{
+		Use:   "usage [flags]",
+		Short: "Sum the usage of the runs recorded with --history by label, user or command, over time windows",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			groupBy, err := history.ParseGroupBy(by)
+			if err != nil {
+				return err
+			}
+			w, err := history.ParseWindow(window)
+			if err != nil {
+				return err
+			}
+			runs, err := opts.selectRuns(time.Now())
+			if err != nil {
+				return err
+			}
+			usages := history.Aggregate(runs, groupBy, w)
+			if opts.format == "json" {
+				return history.WriteUsageJSON(cmd.OutOrStdout(), usages)
+			}
+			return history.WriteUsageText(cmd.OutOrStdout(), usages)
+		},
+	}
+	addHistoryFlags(cmd, &opts)
+	cmd.Flags().StringVar(&by, "by", "label", "Group the runs by label (every key=value), label:KEY (the values of a label), user or command")
+	cmd.Flags().StringVar(&window, "window", string(history.WindowAll), "Sum the usage per day, week, month or over all the runs (all)")
+	return cmd
+}
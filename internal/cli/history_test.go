@@ -0,0 +1,104 @@
+package cli_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/cli"
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/history"
+)
+
+func writeHistory(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	reporters, err := cli.CreateReporters(cli.ReportOptions{HistoryPath: path, Labels: []core.Label{{Name: "team", Value: "infra"}}})
+	if err != nil || len(reporters) != 1 {
+		t.Fatalf("expected a history reporter, got %v (%v)", reporters, err)
+	}
+	start := time.Now().Add(-time.Hour)
+	for _, result := range []*core.Result{
+		{Name: "giogo-cgroup-1", Command: []string{"make", "nightly"}, Start: start, Stats: &core.Stats{CPU: core.CPUStats{UsageUsec: 2000000}}},
+		{Name: "giogo-cgroup-2", Command: []string{"make", "lint"}, Start: start.Add(time.Minute), ExitCode: 1, Stats: &core.Stats{CPU: core.CPUStats{UsageUsec: 1000000}}},
+	} {
+		if err := reporters[0].Report(result); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	return path
+}
+
+func TestHistoryCommand(t *testing.T) {
+	path := writeHistory(t)
+
+	out := new(bytes.Buffer)
+	cmd := cli.NewHistoryCommand()
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"--file", path, "--since", "24h", "--label", "team=infra", "--command", "nightly"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "START") || !strings.Contains(lines[1], "giogo-cgroup-1") || !strings.Contains(lines[1], "team=infra") {
+		t.Errorf("unexpected history:\n%s", out.String())
+	}
+
+	out.Reset()
+	cmd = cli.NewHistoryCommand()
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"--file", path, "--format=json", "--last=1"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var runs []history.Run
+	if err := json.Unmarshal(out.Bytes(), &runs); err != nil || len(runs) != 1 || runs[0].ExitReason != history.ReasonFailure {
+		t.Errorf("unexpected JSON %s (%v)", out.String(), err)
+	}
+}
+
+func TestReportUsageCommand(t *testing.T) {
+	path := writeHistory(t)
+
+	out := new(bytes.Buffer)
+	cmd := cli.NewReportCommand()
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"usage", "--file", path, "--by", "label:team", "--window", "month", "--format", "json"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var usages []history.Usage
+	if err := json.Unmarshal(out.Bytes(), &usages); err != nil || len(usages) != 1 {
+		t.Fatalf("unexpected JSON %s (%v)", out.String(), err)
+	}
+	if usage := usages[0]; usage.Group != "infra" || usage.Runs != 2 || usage.Failures != 1 || usage.CPUUsec != 3000000 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+}
+
+func TestHistoryCommands_InvalidArgs(t *testing.T) {
+	path := writeHistory(t)
+	for _, args := range [][]string{
+		{"history", "--file", path, "--since", "yesterday"},
+		{"history", "--file", path, "--format", "csv"},
+		{"history", "--file", path, "--label", "team"},
+		{"history", "--file", path, "--last=-1"},
+		{"usage", "--file", path, "--by", "host"},
+		{"usage", "--file", path, "--window", "year"},
+	} {
+		cmd := cli.NewHistoryCommand()
+		if args[0] == "usage" {
+			cmd = cli.NewReportCommand()
+		} else {
+			args = args[1:]
+		}
+		cmd.SetOut(new(bytes.Buffer))
+		cmd.SetErr(new(bytes.Buffer))
+		cmd.SetArgs(args)
+		if err := cmd.Execute(); err == nil {
+			t.Errorf("expected an error for %v", args)
+		}
+	}
+}
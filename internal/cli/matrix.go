@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pmarchini/giogo/internal/bench"
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/executor"
+	"github.com/pmarchini/giogo/internal/limiter"
+	"github.com/pmarchini/giogo/internal/matrix"
+	"github.com/spf13/cobra"
+)
+
+// NewMatrixCommand creates the matrix subcommand, which runs a command under every combination of limit values
+func NewMatrixCommand() *cobra.Command {
+	var cpus, rams, ioReads, ioWrites, cpusets []string
+	var parallel int
+	var format, output string
+	cmd := &cobra.Command{
+		Use:   "matrix [flags] -- command [args...]",
+		Short: "Run a command once per combination of limit values and tabulate how it behaved",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			outputFormat, err := matrix.ParseFormat(format)
+			if err != nil {
+				return err
+			}
+			if parallel < 1 {
+				return fmt.Errorf("parallel must be at least 1, got %d", parallel)
+			}
+
+			parameters := []matrix.Parameter{
+				{Flag: "cpu", Values: cpus},
+				{Flag: matrix.CpusetFlag, Values: cpusets},
+				{Flag: "ram", Values: rams},
+				{Flag: "io-read-max", Values: ioReads},
+				{Flag: "io-write-max", Values: ioWrites},
+			}
+			combinations := matrix.Expand(parameters)
+			// Every combination is checked before the first run
+			limiters := make([][]limiter.ResourceLimiter, len(combinations))
+			for i, c := range combinations {
+				limiters[i], err = CreateMatrixLimiters(c)
+				if err != nil {
+					return fmt.Errorf("invalid combination %s: %v", c, err)
+				}
+			}
+
+			m := &matrix.Matrix{
+				Command:      args,
+				Combinations: combinations,
+				Parallel:     parallel,
+				Run: func(index int, c matrix.Combination) (*core.Result, error) {
+					collector := &bench.Collector{}
+					exec := executor.NewExecutor(limiters[index])
+					exec.Reporters = []core.Reporter{collector}
+					exec.Name = core.GenerateRunCgroupPath(index + 1)
+					err := exec.RunCommand(args)
+					return collector.Result, err
+				},
+				Progress: cmd.ErrOrStderr(),
+			}
+			table := &matrix.Table{Rows: m.Execute()}
+			for _, p := range parameters {
+				if len(p.Values) > 0 {
+					table.Flags = append(table.Flags, p.Flag)
+				}
+			}
+
+			if output == "" {
+				return table.Write(cmd.OutOrStdout(), outputFormat)
+			}
+			f, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("error writing matrix: %v", err)
+			}
+			if err := table.Write(f, outputFormat); err != nil {
+				f.Close()
+				return fmt.Errorf("error writing matrix: %v", err)
+			}
+			return f.Close()
+		},
+	}
+	cmd.Flags().StringSliceVar(&cpus, "cpu", nil, "CPU limits to sweep, comma separated (e.g., 0.25,0.5,1)")
+	cmd.Flags().StringSliceVar(&rams, "ram", nil, "Memory limits to sweep, comma separated (e.g., 256m,512m,1g)")
+	cmd.Flags().StringSliceVar(&ioReads, "io-read-max", nil, "IO read max bandwidths to sweep, comma separated (e.g., 1m,10m)")
+	cmd.Flags().StringSliceVar(&ioWrites, "io-write-max", nil, "IO write max bandwidths to sweep, comma separated (e.g., 1m,10m)")
+	cmd.Flags().StringArrayVar(&cpusets, "cpuset", nil, "Cpuset to sweep (e.g., 0-1), repeatable as CPU lists hold commas")
+	cmd.Flags().IntVar(&parallel, "parallel", 1, "Maximum number of concurrent runs, only combinations with disjoint cpusets run concurrently")
+	cmd.Flags().StringVar(&format, "format", string(matrix.FormatText), "Output format of the table (text, csv, json)")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write the table to this file instead of stdout")
+	return cmd
+}
+
+// CreateMatrixLimiters creates the limiters of a combination of the matrix
+func CreateMatrixLimiters(c matrix.Combination) ([]limiter.ResourceLimiter, error) {
+	ioRead, ioWrite := c.Value("io-read-max"), c.Value("io-write-max")
+	if ioRead == "" {
+		ioRead = limiter.UnlimitedIOValue
+	}
+	if ioWrite == "" {
+		ioWrite = limiter.UnlimitedIOValue
+	}
+	limiters, err := CreateLimiters(c.Value("cpu"), c.Value("ram"), ioRead, ioWrite)
+	if err != nil {
+		return nil, err
+	}
+	if value := c.Value(matrix.CpusetFlag); value != "" {
+		cpusetLimiter, err := limiter.NewCpusetLimiter(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpuset value: %v", err)
+		}
+		limiters = append(limiters, cpusetLimiter)
+	}
+	return limiters, nil
+}
@@ -0,0 +1,39 @@
+package cli_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pmarchini/giogo/internal/cli"
+	"github.com/pmarchini/giogo/internal/matrix"
+)
+
+func TestCreateMatrixLimiters(t *testing.T) {
+	limiters, err := cli.CreateMatrixLimiters(matrix.Combination{{Flag: "cpu", Value: "0.5"}, {Flag: "cpuset", Value: "0"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var resources specs.LinuxResources
+	for _, l := range limiters {
+		l.Apply(&resources)
+	}
+	if resources.CPU == nil || resources.CPU.Cpus != "0" || *resources.CPU.Quota != 50000 {
+		t.Errorf("unexpected CPU resources: %+v", resources.CPU)
+	}
+
+	if _, err := cli.CreateMatrixLimiters(matrix.Combination{{Flag: "ram", Value: "lots"}}); err == nil {
+		t.Errorf("expected error for an invalid memory limit")
+	}
+}
+
+func TestMatrixCommand_InvalidCombination(t *testing.T) {
+	cmd := cli.NewMatrixCommand()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"--cpu=0.5,2", "--", "true"})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "--cpu=2") {
+		t.Errorf("expected the invalid combination to be reported before any run, got %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/bench"
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/executor"
+	"github.com/pmarchini/giogo/internal/limiter"
+	"github.com/pmarchini/giogo/internal/probe"
+	"github.com/pmarchini/giogo/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// NewProbeCommand creates the probe subcommand, which searches the smallest limits a command passes with
+func NewProbeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "probe",
+		Short: "Search the smallest memory or CPU limit a command still passes with",
+	}
+	cmd.AddCommand(newProbeMemoryCommand())
+	cmd.AddCommand(newProbeCPUCommand())
+	return cmd
+}
+
+func newProbeMemoryCommand() *cobra.Command {
+	var minValue, maxValue, precision string
+	var margin float64
+	cmd := &cobra.Command{
+		Use:   "memory [flags] -- command [args...]",
+		Short: "Search the smallest memory limit a command passes with, an OOM kill or a nonzero exit fails the run",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var bounds [3]uint64
+			for i, value := range []string{minValue, maxValue, precision} {
+				bytes, err := utils.BytesStringToBytes(value)
+				if err != nil {
+					return fmt.Errorf("invalid memory value %q: %v", value, err)
+				}
+				bounds[i] = bytes
+			}
+			if margin < 0 {
+				return fmt.Errorf("margin must not be negative, got %v", margin)
+			}
+
+			p := &probe.Probe{
+				Min:       float64(bounds[0]),
+				Max:       float64(bounds[1]),
+				Precision: float64(bounds[2]),
+				Try: func(value float64) (bool, string, error) {
+					return tryProbe(args, []limiter.ResourceLimiter{&limiter.MemoryLimiter{Limit: uint64(value)}}, nil)
+				},
+				Format: func(value float64) string {
+					return "--ram=" + utils.FormatBytes(uint64(value))
+				},
+				Progress: cmd.ErrOrStderr(),
+			}
+			smallest, _, err := p.Execute()
+			if err != nil {
+				return err
+			}
+			// Round the recommendation up to the MiB
+			const mib = 1024 * 1024
+			recommended := uint64(math.Ceil(probe.WithMargin(smallest, margin)/mib)) * mib
+			return writeProbeResult(cmd.OutOrStdout(), "memory", utils.FormatBytes(uint64(smallest)), margin, fmt.Sprintf("--ram=%dm", recommended/mib))
+		},
+	}
+	cmd.Flags().StringVar(&minValue, "min", "64m", "Smallest memory limit tried")
+	cmd.Flags().StringVar(&maxValue, "max", "4g", "Largest memory limit tried, the command must pass with it")
+	cmd.Flags().StringVar(&precision, "precision", "1m", "Stop the search once the range is this narrow")
+	cmd.Flags().Float64Var(&margin, "margin", probe.DefaultMargin, "Safety margin added to the smallest passing limit, in percent")
+	return cmd
+}
+
+func newProbeCPUCommand() *cobra.Command {
+	var minValue, maxValue, precision, margin float64
+	var deadline time.Duration
+	cmd := &cobra.Command{
+		Use:   "cpu --deadline=DURATION [flags] -- command [args...]",
+		Short: "Search the lowest CPU fraction a command finishes within the deadline with",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if deadline <= 0 {
+				return fmt.Errorf("--deadline is required")
+			}
+			if maxValue > 1 {
+				return fmt.Errorf("the maximum CPU fraction must not be above 1, got %v", maxValue)
+			}
+			if margin < 0 {
+				return fmt.Errorf("margin must not be negative, got %v", margin)
+			}
+
+			p := &probe.Probe{
+				Min:       minValue,
+				Max:       maxValue,
+				Precision: precision,
+				Try: func(value float64) (bool, string, error) {
+					return tryProbe(args, []limiter.ResourceLimiter{&limiter.CPULimiter{Fraction: value}}, &probe.Deadline{Duration: deadline})
+				},
+				Format: func(value float64) string {
+					return "--cpu=" + strconv.FormatFloat(value, 'f', -1, 64)
+				},
+				Progress: cmd.ErrOrStderr(),
+			}
+			smallest, _, err := p.Execute()
+			if err != nil {
+				return err
+			}
+			// Round the recommendation up to the hundredth, a CPU limit cannot go above 1
+			recommended := math.Min(math.Ceil(probe.WithMargin(smallest, margin)*100-1e-9)/100, 1)
+			return writeProbeResult(cmd.OutOrStdout(), "CPU", strconv.FormatFloat(smallest, 'f', -1, 64), margin, "--cpu="+strconv.FormatFloat(recommended, 'f', -1, 64))
+		},
+	}
+	cmd.Flags().Float64Var(&minValue, "min", 0.01, "Lowest CPU fraction tried")
+	cmd.Flags().Float64Var(&maxValue, "max", 1, "Highest CPU fraction tried, the command must finish in time with it")
+	cmd.Flags().Float64Var(&precision, "precision", 0.01, "Stop the search once the range is this narrow")
+	cmd.Flags().DurationVar(&deadline, "deadline", 0, "Time the command must finish within, it is killed past it (e.g., 30s)")
+	cmd.Flags().Float64Var(&margin, "margin", probe.DefaultMargin, "Safety margin added to the lowest passing fraction, in percent")
+	return cmd
+}
+
+// tryProbe runs the command once under the limiters and tells whether it passed
+func tryProbe(args []string, limiters []limiter.ResourceLimiter, watcher core.Watcher) (bool, string, error) {
+	collector := &bench.Collector{}
+	exec := executor.NewExecutor(limiters)
+	exec.Reporters = []core.Reporter{collector}
+	if watcher != nil {
+		exec.Watchers = []core.Watcher{watcher}
+	}
+	err := exec.RunCommand(args)
+	if collector.Result == nil {
+		// The group could not be set up and the command never ran: the run tells nothing about the limit,
+		// so the probe is aborted rather than counting it as a failure under this limit
+		return false, "", fmt.Errorf("error setting up the run, the limit was not tried: %v", err)
+	}
+	reason := probe.Failure(collector.Result)
+	return reason == "", reason, nil
+}
+
+func writeProbeResult(w io.Writer, resource, smallest string, margin float64, recommended string) error {
+	_, err := fmt.Fprintf(w, "smallest passing %s limit: %s\nrecommended with a %s%% margin: %s\n",
+		resource, smallest, strconv.FormatFloat(margin, 'f', -1, 64), recommended)
+	return err
+}
@@ -0,0 +1,25 @@
+package cli_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pmarchini/giogo/internal/cli"
+)
+
+func TestProbeCommand_InvalidFlags(t *testing.T) {
+	for _, args := range [][]string{
+		{"memory", "--min=lots", "--", "true"},
+		{"memory", "--margin=-5", "--", "true"},
+		{"cpu", "--", "true"},
+		{"cpu", "--deadline=1s", "--max=2", "--", "true"},
+	} {
+		cmd := cli.NewProbeCommand()
+		cmd.SetOut(new(bytes.Buffer))
+		cmd.SetErr(new(bytes.Buffer))
+		cmd.SetArgs(args)
+		if err := cmd.Execute(); err == nil {
+			t.Errorf("expected error for %v", args)
+		}
+	}
+}
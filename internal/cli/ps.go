@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/monitor"
+	"github.com/spf13/cobra"
+)
+
+// NewPSCommand creates the ps subcommand, which lists the processes of a running giogo group
+func NewPSCommand() *cobra.Command {
+	var sortColumn, format string
+	var labels []string
+	var flat bool
+	cmd := &cobra.Command{
+		Use:   "ps NAME | --label key=value...",
+		Short: "List the processes of a running giogo group (e.g., giogo-cgroup-1234) with their CPU time, memory and IO",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			order, err := monitor.ParseProcessSort(sortColumn)
+			if err != nil {
+				return err
+			}
+			if format != "text" && format != "json" {
+				return fmt.Errorf("invalid format %q, expected text or json", format)
+			}
+			names, err := groupNames(args, labels)
+			if err != nil {
+				return err
+			}
+			if len(names) > 1 {
+				return fmt.Errorf("the labels select %d groups (%s), expected one", len(names), strings.Join(names, ", "))
+			}
+			dir, err := ResolveGroupDir(names[0])
+			if err != nil {
+				return err
+			}
+			processes, err := monitor.ReadGroupProcesses(dir, "/proc")
+			if err != nil {
+				return fmt.Errorf("error listing the processes of %s: %v", names[0], err)
+			}
+			if format == "json" {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				// The processes are in the order of the table, without the indentation of the tree
+				return encoder.Encode(monitor.SortProcesses(processes, order, flat))
+			}
+			return monitor.WriteProcessTable(cmd.OutOrStdout(), processes, order, flat)
+		},
+	}
+	cmd.Flags().StringVar(&sortColumn, "sort", string(monitor.ProcessColumnPID), "Column the processes are sorted by, a leading - or + forces a descending or ascending order (pid, ppid, threads, cpu, rss, pss, swap, read, write, command)")
+	cmd.Flags().StringArrayVar(&labels, "label", nil, "List the processes of the running group with this label, as key=value, repeatable")
+	cmd.Flags().BoolVar(&flat, "flat", false, "List the processes without the tree, so the order applies to all of them")
+	cmd.Flags().StringVar(&format, "format", "text", "Output format (text, json)")
+	return cmd
+}
+
+// ResolveGroupDir returns the cgroup directory of a giogo run, given its name or the absolute path of the cgroup
+func ResolveGroupDir(name string) (string, error) {
+	dir := name
+	if !filepath.IsAbs(name) {
+		dir = core.SystemdSlicePath(core.AddSliceSuffix(name))
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("no running giogo group %s (%s not found)", name, dir)
+	}
+	return dir, nil
+}
@@ -0,0 +1,66 @@
+package cli_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pmarchini/giogo/internal/cli"
+	"github.com/pmarchini/giogo/internal/core"
+)
+
+func TestPSCommand(t *testing.T) {
+	// An absolute path stands for the cgroup of the run
+	cgroupDir := t.TempDir()
+	pid := strconv.Itoa(os.Getpid())
+	if err := os.WriteFile(filepath.Join(cgroupDir, "cgroup.procs"), []byte(pid+"\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out := new(bytes.Buffer)
+	cmd := cli.NewPSCommand()
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"--sort=-rss", cgroupDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "PID") || strings.Fields(lines[1])[0] != pid {
+		t.Errorf("unexpected table:\n%s", out.String())
+	}
+
+	out.Reset()
+	cmd = cli.NewPSCommand()
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"--format=json", cgroupDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var processes []core.ProcessStats
+	if err := json.Unmarshal(out.Bytes(), &processes); err != nil || len(processes) != 1 || processes[0].PID != os.Getpid() {
+		t.Errorf("unexpected JSON %s (%v)", out.String(), err)
+	}
+}
+
+func TestPSCommand_InvalidArgs(t *testing.T) {
+	for _, args := range [][]string{
+		{"--sort=memory", t.TempDir()},
+		{"--format=csv", t.TempDir()},
+		{"giogo-cgroup-does-not-exist"},
+		{},
+		{"--label=team=infra", "giogo-cgroup-does-not-exist"},
+		{"--label=team=infra-does-not-exist"},
+	} {
+		cmd := cli.NewPSCommand()
+		cmd.SetOut(new(bytes.Buffer))
+		cmd.SetErr(new(bytes.Buffer))
+		cmd.SetArgs(args)
+		if err := cmd.Execute(); err == nil {
+			t.Errorf("expected error for %v", args)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/executor"
+	"github.com/pmarchini/giogo/internal/recommend"
+	"github.com/pmarchini/giogo/internal/record"
+	"github.com/spf13/cobra"
+)
+
+// NewRecommendCommand creates the recommend subcommand, which runs a command without limits and proposes limits from its usage
+func NewRecommendCommand() *cobra.Command {
+	var interval time.Duration
+	var headroom, percentile float64
+	var profileOut, from string
+	cmd := &cobra.Command{
+		Use:   "recommend [flags] -- command [args...]",
+		Short: "Run a command without limits, sample its usage and propose limits as giogo flags, a profile and Kubernetes resources",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if interval <= 0 {
+				return fmt.Errorf("interval must be positive, got %v", interval)
+			}
+			if headroom < 0 {
+				return fmt.Errorf("headroom must not be negative, got %v", headroom)
+			}
+			if percentile <= 0 || percentile > 100 {
+				return fmt.Errorf("percentile must be between 0 and 100, got %v", percentile)
+			}
+
+			if from != "" {
+				if len(args) > 0 {
+					return fmt.Errorf("--from and a command are mutually exclusive")
+				}
+				return RecommendFromRecording(cmd, from, headroom, percentile, profileOut)
+			}
+			if len(args) == 0 {
+				return fmt.Errorf("requires a command, or a recording with --from")
+			}
+
+			recommender := &recommend.Recommender{
+				Interval:    interval,
+				Headroom:    headroom,
+				Percentile:  percentile,
+				Output:      cmd.OutOrStdout(),
+				ProfilePath: profileOut,
+			}
+			exec := executor.NewExecutor(nil)
+			exec.Watchers = []core.Watcher{recommender}
+			exec.Reporters = []core.Reporter{recommender}
+			return exec.RunCommand(args)
+		},
+	}
+	cmd.Flags().DurationVar(&interval, "interval", recommend.DefaultInterval, "Time between two samples of the usage")
+	cmd.Flags().Float64Var(&headroom, "headroom", recommend.DefaultHeadroom, "Headroom added to the observed usage, in percent")
+	cmd.Flags().Float64Var(&percentile, "percentile", recommend.DefaultPercentile, "Percentile of the CPU and IO usage over the samples the limits are based on")
+	cmd.Flags().StringVar(&profileOut, "profile-out", "", "Write the recommended limits to this profile, to be read with --profile")
+	cmd.Flags().StringVar(&from, "from", "", "Recommend limits from a recording made with --record instead of running a command")
+	return cmd
+}
+
+// RecommendFromRecording proposes limits from the samples of a recording
+func RecommendFromRecording(cmd *cobra.Command, path string, headroom, percentile float64, profileOut string) error {
+	rec, err := record.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading recording %s: %v", path, err)
+	}
+	observed, err := recommend.Observe(rec.Samples, percentile)
+	if err != nil {
+		return fmt.Errorf("cannot recommend limits from %s: %v", path, err)
+	}
+	var command []string
+	if rec.Run != nil {
+		command = rec.Run.Command
+	}
+	recommendation := recommend.New(command, observed, headroom)
+	if err := recommendation.WriteText(cmd.OutOrStdout()); err != nil {
+		return err
+	}
+	if profileOut != "" {
+		return recommend.WriteProfileFile(profileOut, recommendation)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package cli_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/cli"
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/record"
+	"github.com/spf13/cobra"
+)
+
+func TestApplyProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "build.profile")
+	if err := os.WriteFile(path, []byte("# build\ncpu = 0.5\nram = 1g\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rootCmd := &cobra.Command{}
+	cli.SetupRootCommand(rootCmd)
+	if err := rootCmd.ParseFlags([]string{"--ram=2g"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cli.ApplyProfile(rootCmd, path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The command line takes precedence over the profile
+	if value := rootCmd.Flags().Lookup("cpu").Value.String(); value != "0.5" {
+		t.Errorf("expected the CPU limit of the profile, got %q", value)
+	}
+	if value := rootCmd.Flags().Lookup("ram").Value.String(); value != "2g" {
+		t.Errorf("expected the memory limit of the command line, got %q", value)
+	}
+
+	for _, invalid := range []string{"colour = blue\n", "profile = other.profile\n", "oom-snapshot-threshold = lots\n"} {
+		if err := os.WriteFile(path, []byte(invalid), 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		rootCmd := &cobra.Command{}
+		cli.SetupRootCommand(rootCmd)
+		if err := cli.ApplyProfile(rootCmd, path); err == nil {
+			t.Errorf("expected error for profile %q", invalid)
+		}
+	}
+}
+
+func TestRecommendCommand_FromRecording(t *testing.T) {
+	dir := t.TempDir()
+	recordingPath := filepath.Join(dir, "run.giogo")
+	f, err := os.Create(recordingPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gz := gzip.NewWriter(f)
+	encoder := json.NewEncoder(gz)
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, entry := range []record.Entry{
+		{Type: record.EntryHeader, Time: start, Version: record.Version},
+		{Type: record.EntrySample, Time: start, Stats: &core.Stats{}},
+		{Type: record.EntrySample, Time: start.Add(time.Second), Stats: &core.Stats{CPU: core.CPUStats{UsageUsec: 400000}, Memory: core.MemoryStats{Peak: 100 * 1024 * 1024}}},
+		{Type: record.EntryResult, Time: start.Add(time.Second), Result: &record.Run{Command: []string{"make"}}},
+	} {
+		if err := encoder.Encode(&entry); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	gz.Close()
+	f.Close()
+
+	profilePath := filepath.Join(dir, "make.profile")
+	buf := new(bytes.Buffer)
+	cmd := cli.NewRecommendCommand()
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"--from", recordingPath, "--headroom=50", "--profile-out", profilePath})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "giogo --cpu=0.6 --ram=150m -- make") {
+		t.Errorf("unexpected recommendation:\n%s", buf.String())
+	}
+	profile, err := os.ReadFile(profilePath)
+	if err != nil || !strings.Contains(string(profile), "ram = 150m\n") {
+		t.Errorf("unexpected profile %q (%v)", profile, err)
+	}
+
+	cmd = cli.NewRecommendCommand()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"--from", recordingPath, "--", "make"})
+	if err := cmd.Execute(); err == nil {
+		t.Errorf("expected error for --from and a command")
+	}
+
+	cmd = cli.NewRecommendCommand()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"--interval=-1s", "--", "make"})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "interval must be positive") {
+		t.Errorf("expected error for a negative interval, got %v", err)
+	}
+}
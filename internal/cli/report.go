@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pmarchini/giogo/internal/record"
+	"github.com/pmarchini/giogo/internal/report"
+	"github.com/spf13/cobra"
+)
+
+// NewReportCommand creates the report subcommand, which renders a recording as an HTML page,
+// and its usage subcommand, which sums the usage of the runs of the history
+func NewReportCommand() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "report RECORDING",
+		Short: "Render a recording made with --record as a self-contained HTML report",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return writeReport(args[0], output, cmd.OutOrStdout())
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write the report to this file instead of stdout")
+	cmd.AddCommand(newReportUsageCommand())
+	return cmd
+}
+
+func writeReport(recordingPath, output string, stdout io.Writer) error {
+	rec, err := record.ReadFile(recordingPath)
+	if err != nil {
+		return fmt.Errorf("error reading recording: %v", err)
+	}
+
+	if output == "" {
+		return report.WriteHTML(stdout, rec)
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("error creating report: %v", err)
+	}
+	if err := report.WriteHTML(f, rec); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing report: %v", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,108 @@
+package cli_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/cli"
+	"github.com/pmarchini/giogo/internal/compare"
+	"github.com/pmarchini/giogo/internal/core"
+)
+
+func TestReportCommand(t *testing.T) {
+	dir := t.TempDir()
+	recordingPath := filepath.Join(dir, "run.giogo")
+	recorder, err := cli.CreateRecorder(recordingPath, time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = recorder.Report(&core.Result{Name: "giogo-cgroup-1", Command: []string{"make"}, Start: time.Now(), Stats: &core.Stats{}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reportPath := filepath.Join(dir, "report.html")
+	cmd := cli.NewReportCommand()
+	cmd.SetArgs([]string{recordingPath, "-o", reportPath})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(content), "giogo report for giogo-cgroup-1") {
+		t.Errorf("unexpected report:\n%s", content)
+	}
+
+	// Without -o the report goes to stdout
+	buf := new(bytes.Buffer)
+	cmd = cli.NewReportCommand()
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{recordingPath})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "<!DOCTYPE html>") {
+		t.Errorf("expected the report on stdout")
+	}
+
+	cmd = cli.NewReportCommand()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{filepath.Join(dir, "missing.giogo")})
+	if err := cmd.Execute(); err == nil {
+		t.Errorf("expected error for a missing recording")
+	}
+}
+
+func TestCreateRecorder(t *testing.T) {
+	if _, err := cli.CreateRecorder("run.giogo", 0); err == nil {
+		t.Errorf("expected error for a zero interval")
+	}
+}
+
+func writeRecording(t *testing.T, path string, stats *core.Stats) {
+	t.Helper()
+	recorder, err := cli.CreateRecorder(path, time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := recorder.Report(&core.Result{Start: time.Now(), WallTime: time.Second, Stats: stats}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCompareCommand(t *testing.T) {
+	dir := t.TempDir()
+	before, after := filepath.Join(dir, "before.giogo"), filepath.Join(dir, "after.giogo")
+	writeRecording(t, before, &core.Stats{CPU: core.CPUStats{UsageUsec: 1000000}, Memory: core.MemoryStats{Peak: 1000}})
+	writeRecording(t, after, &core.Stats{CPU: core.CPUStats{UsageUsec: 1010000}, Memory: core.MemoryStats{Peak: 1500}})
+
+	buf := new(bytes.Buffer)
+	cmd := cli.NewCompareCommand()
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetArgs([]string{before, after, "--format=markdown"})
+	err := cmd.Execute()
+	var regression *compare.RegressionError
+	if !errors.As(err, &regression) || len(regression.Regressions) != 1 || regression.Regressions[0].Name != "memory peak" {
+		t.Fatalf("expected a memory regression, got %v", err)
+	}
+	if !strings.Contains(buf.String(), "| memory peak |") {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+
+	// A higher threshold accepts the change
+	cmd = cli.NewCompareCommand()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetArgs([]string{before, after, "--threshold=60"})
+	if err := cmd.Execute(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/monitor"
+	"github.com/pmarchini/giogo/internal/top"
+	"github.com/spf13/cobra"
+)
+
+// NewTopCommand creates the top subcommand, a live view of the running giogo groups
+func NewTopCommand() *cobra.Command {
+	var interval time.Duration
+	var labels []string
+	cmd := &cobra.Command{
+		Use:   "top",
+		Short: "Show the running giogo groups live, their usage against their limits, and freeze, thaw, kill or adjust them",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if interval <= 0 {
+				return fmt.Errorf("interval must be positive, got %v", interval)
+			}
+			selector, err := core.ParseLabels(labels)
+			if err != nil {
+				return err
+			}
+			sampler := &top.Sampler{List: core.ListGroups, Load: LoadGroup}
+			if len(selector) > 0 {
+				sampler.List = func() ([]string, error) { return SelectGroups(selector) }
+			}
+			model := &top.Model{
+				Controller: groupController{},
+				ReadProcesses: func(dir string) ([]core.ProcessStats, error) {
+					return monitor.ReadGroupProcesses(dir, "/proc")
+				},
+			}
+			return top.Run(os.Stdin, os.Stdout, sampler, model, interval)
+		},
+	}
+	cmd.Flags().DurationVar(&interval, "interval", top.DefaultInterval, "Time between two refreshes")
+	cmd.Flags().StringArrayVar(&labels, "label", nil, "Only show the groups with this label, as key=value, repeatable")
+	return cmd
+}
+
+// groupController acts on the groups selected in top like the freeze, thaw, kill and set subcommands
+type groupController struct{}
+
+func (groupController) Freeze(name string) error { return FreezeGroup(name) }
+func (groupController) Thaw(name string) error   { return ThawGroup(name) }
+func (groupController) Kill(name string) error   { return KillGroup(name) }
+
+func (groupController) SetLimit(name, flag, value string) error {
+	if value == "" {
+		return fmt.Errorf("no value given for %s", flag)
+	}
+	switch flag {
+	case "cpu":
+		return SetGroupLimits(name, value, "", "", "")
+	case "ram":
+		return SetGroupLimits(name, "", value, "", "")
+	case "io-read-max":
+		return SetGroupLimits(name, "", "", value, "")
+	case "io-write-max":
+		return SetGroupLimits(name, "", "", "", value)
+	}
+	return fmt.Errorf("unknown limit %s", flag)
+}
@@ -0,0 +1,234 @@
+package compare
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/record"
+	"github.com/pmarchini/giogo/internal/utils"
+)
+
+// ExitCodeRegression is the exit code of giogo compare when a metric regressed beyond the threshold
+const ExitCodeRegression = 3
+
+// DefaultThreshold is the default significance threshold, in percent
+const DefaultThreshold = 5.0
+
+// A metric that was 0 before regressed when it grew above these floors, below them the growth is noise
+const (
+	MinRegressionUsec  = 10 * 1000
+	MinRegressionBytes = 1024 * 1024
+)
+
+// Format is the output format of a comparison
+type Format string
+
+const (
+	FormatText     Format = "text"
+	FormatMarkdown Format = "markdown"
+	FormatJSON     Format = "json"
+)
+
+// ParseFormat parses one of text, markdown or json
+func ParseFormat(value string) (Format, error) {
+	switch format := Format(value); format {
+	case FormatText, FormatMarkdown, FormatJSON:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid compare format %q, expected text, markdown or json", value)
+	}
+}
+
+// Unit is how the values of a metric are formatted
+type Unit string
+
+const (
+	UnitBytes Unit = "bytes"
+	UnitUsec  Unit = "usec"
+)
+
+// Metric is a figure of a run, lower is better for all of them
+type Metric struct {
+	Name  string
+	Unit  Unit
+	Value uint64
+}
+
+// Metrics extracts the compared figures from a recording
+func Metrics(rec *record.Recording) ([]Metric, error) {
+	if len(rec.Samples) == 0 {
+		return nil, fmt.Errorf("the recording holds no sample")
+	}
+	last := rec.Samples[len(rec.Samples)-1].Stats
+
+	var peak uint64
+	for _, sample := range rec.Samples {
+		peak = max(peak, sample.Stats.Memory.Peak, sample.Stats.Memory.Current)
+	}
+	var readBytes, writeBytes uint64
+	for _, device := range last.IO {
+		readBytes += device.RBytes
+		writeBytes += device.WBytes
+	}
+	wallTime := uint64(rec.Samples[len(rec.Samples)-1].Time.Sub(rec.Samples[0].Time).Microseconds())
+	if rec.Run != nil {
+		wallTime = rec.Run.WallTimeUsec
+	}
+
+	return []Metric{
+		{Name: "wall time", Unit: UnitUsec, Value: wallTime},
+		{Name: "cpu time", Unit: UnitUsec, Value: last.CPU.UsageUsec},
+		{Name: "cpu throttled", Unit: UnitUsec, Value: last.CPU.ThrottledUsec},
+		{Name: "memory peak", Unit: UnitBytes, Value: peak},
+		{Name: "io read", Unit: UnitBytes, Value: readBytes},
+		{Name: "io write", Unit: UnitBytes, Value: writeBytes},
+		{Name: "cpu stall (some)", Unit: UnitUsec, Value: last.PSI.CPU.Some.TotalUsec},
+		{Name: "memory stall (some)", Unit: UnitUsec, Value: last.PSI.Memory.Some.TotalUsec},
+		{Name: "memory stall (full)", Unit: UnitUsec, Value: last.PSI.Memory.Full.TotalUsec},
+		{Name: "io stall (some)", Unit: UnitUsec, Value: last.PSI.IO.Some.TotalUsec},
+		{Name: "io stall (full)", Unit: UnitUsec, Value: last.PSI.IO.Full.TotalUsec},
+	}, nil
+}
+
+// Diff is the change of a metric between two runs
+type Diff struct {
+	Name   string `json:"name"`
+	Unit   Unit   `json:"unit"`
+	Before uint64 `json:"before"`
+	After  uint64 `json:"after"`
+	// Change is the relative change in percent, nil when the metric was 0 before
+	Change    *float64 `json:"change_percent"`
+	Regressed bool     `json:"regressed"`
+}
+
+// Comparison is the result of comparing two runs
+type Comparison struct {
+	Before    string  `json:"before"`
+	After     string  `json:"after"`
+	Threshold float64 `json:"threshold_percent"`
+	Diffs     []Diff  `json:"metrics"`
+}
+
+// Compare compares the metrics of two runs.
+// A metric regressed when it grew by more than threshold percent. The relative change of a metric that was 0 before
+// is undefined: it regressed when it grew above the floor of its unit, e.g. a run that starts being throttled.
+func Compare(before, after []Metric, threshold float64) []Diff {
+	afterByName := make(map[string]Metric, len(after))
+	for _, m := range after {
+		afterByName[m.Name] = m
+	}
+	var diffs []Diff
+	for _, b := range before {
+		a, ok := afterByName[b.Name]
+		if !ok {
+			continue
+		}
+		diff := Diff{Name: b.Name, Unit: b.Unit, Before: b.Value, After: a.Value}
+		if b.Value != 0 {
+			change := (float64(a.Value) - float64(b.Value)) / float64(b.Value) * 100
+			diff.Change = &change
+			diff.Regressed = change > threshold
+		} else {
+			diff.Regressed = a.Value > regressionFloor(b.Unit)
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+func regressionFloor(unit Unit) uint64 {
+	if unit == UnitBytes {
+		return MinRegressionBytes
+	}
+	return MinRegressionUsec
+}
+
+// Regressions returns the metrics that regressed
+func (c *Comparison) Regressions() []Diff {
+	var regressions []Diff
+	for _, d := range c.Diffs {
+		if d.Regressed {
+			regressions = append(regressions, d)
+		}
+	}
+	return regressions
+}
+
+// Write writes the comparison in the given format
+func (c *Comparison) Write(w io.Writer, format Format) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(c)
+	case FormatMarkdown:
+		var b strings.Builder
+		fmt.Fprintf(&b, "Comparison of `%s` and `%s` (threshold %s%%)\n\n", c.Before, c.After, formatFloat(c.Threshold))
+		b.WriteString("| Metric | Before | After | Change | |\n")
+		b.WriteString("|---|---:|---:|---:|---|\n")
+		for _, d := range c.Diffs {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n", d.Name, formatValue(d.Unit, d.Before), formatValue(d.Unit, d.After), formatChange(d.Change), status(d, ":x: regression"))
+		}
+		_, err := io.WriteString(w, b.String())
+		return err
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "metric\tbefore\tafter\tchange\t\n")
+		for _, d := range c.Diffs {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", d.Name, formatValue(d.Unit, d.Before), formatValue(d.Unit, d.After), formatChange(d.Change), status(d, "REGRESSION"))
+		}
+		return tw.Flush()
+	}
+}
+
+func status(d Diff, regression string) string {
+	if d.Regressed {
+		return regression
+	}
+	return ""
+}
+
+func formatValue(unit Unit, value uint64) string {
+	if unit == UnitBytes {
+		return utils.FormatBytes(value)
+	}
+	return (time.Duration(value) * time.Microsecond).Round(time.Millisecond).String()
+}
+
+func formatChange(change *float64) string {
+	if change == nil {
+		return "n/a"
+	}
+	if math.Abs(*change) < 0.05 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%+.1f%%", *change)
+}
+
+func formatFloat(value float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", value), "0"), ".")
+}
+
+// RegressionError is returned when metrics regressed beyond the threshold
+type RegressionError struct {
+	Regressions []Diff
+	Threshold   float64
+}
+
+func (e *RegressionError) Error() string {
+	var names []string
+	for _, d := range e.Regressions {
+		names = append(names, d.Name)
+	}
+	return fmt.Sprintf("%d metric(s) regressed beyond %s%%: %s", len(e.Regressions), formatFloat(e.Threshold), strings.Join(names, ", "))
+}
+
+// ExitCode is the exit code of giogo compare on regressions
+func (e *RegressionError) ExitCode() int {
+	return ExitCodeRegression
+}
@@ -0,0 +1,153 @@
+package compare_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/compare"
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/record"
+)
+
+func TestMetrics(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	rec := &record.Recording{
+		Samples: []record.Sample{
+			{Time: start, Stats: &core.Stats{Memory: core.MemoryStats{Current: 4096}}},
+			{Time: start.Add(2 * time.Second), Stats: &core.Stats{
+				CPU:    core.CPUStats{UsageUsec: 1500000, ThrottledUsec: 250000},
+				Memory: core.MemoryStats{Current: 1024, Peak: 2048},
+				IO:     []core.IOStats{{RBytes: 100, WBytes: 10}, {RBytes: 200, WBytes: 20}},
+				PSI:    core.PSIStats{Memory: core.PressureStats{Full: core.PressureData{TotalUsec: 300}}},
+			}},
+		},
+	}
+
+	metrics, err := compare.Metrics(rec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	values := make(map[string]uint64)
+	for _, m := range metrics {
+		values[m.Name] = m.Value
+	}
+	expected := map[string]uint64{
+		"wall time":           2000000,
+		"cpu time":            1500000,
+		"cpu throttled":       250000,
+		"memory peak":         4096,
+		"io read":             300,
+		"io write":            30,
+		"memory stall (full)": 300,
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("%s: expected %d, got %d", name, value, values[name])
+		}
+	}
+
+	// The wall time of the run wins over the span of the samples
+	rec.Run = &record.Run{WallTimeUsec: 3000000}
+	metrics, _ = compare.Metrics(rec)
+	if metrics[0].Name != "wall time" || metrics[0].Value != 3000000 {
+		t.Errorf("unexpected wall time: %+v", metrics[0])
+	}
+
+	if _, err := compare.Metrics(&record.Recording{}); err == nil {
+		t.Errorf("expected error for an empty recording")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	before := []compare.Metric{
+		{Name: "cpu time", Unit: compare.UnitUsec, Value: 1000000},
+		{Name: "memory peak", Unit: compare.UnitBytes, Value: 1000},
+		{Name: "io write", Unit: compare.UnitBytes, Value: 0},
+		{Name: "cpu throttled", Unit: compare.UnitUsec, Value: 0},
+	}
+	after := []compare.Metric{
+		{Name: "cpu time", Unit: compare.UnitUsec, Value: 1040000},
+		{Name: "memory peak", Unit: compare.UnitBytes, Value: 1200},
+		{Name: "io write", Unit: compare.UnitBytes, Value: 50},
+		{Name: "cpu throttled", Unit: compare.UnitUsec, Value: 2000000},
+	}
+
+	diffs := compare.Compare(before, after, 5)
+	if len(diffs) != 4 {
+		t.Fatalf("expected 4 diffs, got %d", len(diffs))
+	}
+	if diffs[0].Regressed || *diffs[0].Change != 4 {
+		t.Errorf("expected a 4%% change within the threshold, got %+v", diffs[0])
+	}
+	if !diffs[1].Regressed || *diffs[1].Change != 20 {
+		t.Errorf("expected a 20%% regression, got %+v", diffs[1])
+	}
+	if diffs[2].Regressed || diffs[2].Change != nil {
+		t.Errorf("expected no regression from 0 below the floor, got %+v", diffs[2])
+	}
+	if !diffs[3].Regressed || diffs[3].Change != nil {
+		t.Errorf("expected a regression from 0 above the floor, got %+v", diffs[3])
+	}
+}
+
+func testComparison() *compare.Comparison {
+	before := []compare.Metric{{Name: "wall time", Unit: compare.UnitUsec, Value: 2000000}, {Name: "memory peak", Unit: compare.UnitBytes, Value: 1024 * 1024}}
+	after := []compare.Metric{{Name: "wall time", Unit: compare.UnitUsec, Value: 1000000}, {Name: "memory peak", Unit: compare.UnitBytes, Value: 2 * 1024 * 1024}}
+	return &compare.Comparison{Before: "before.giogo", After: "after.giogo", Threshold: 5, Diffs: compare.Compare(before, after, 5)}
+}
+
+func TestWrite(t *testing.T) {
+	c := testComparison()
+
+	buf := new(bytes.Buffer)
+	if err := c.Write(buf, compare.FormatText); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "metric") {
+		t.Fatalf("unexpected text output:\n%s", buf.String())
+	}
+	if !strings.Contains(lines[1], "2s") || !strings.Contains(lines[1], "-50.0%") || strings.Contains(lines[1], "REGRESSION") {
+		t.Errorf("unexpected wall time line %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "+100.0%") || !strings.HasSuffix(lines[2], "REGRESSION") {
+		t.Errorf("unexpected memory line %q", lines[2])
+	}
+
+	buf.Reset()
+	if err := c.Write(buf, compare.FormatMarkdown); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "| memory peak | 1.0m | 2.0m | +100.0% | :x: regression |") {
+		t.Errorf("unexpected markdown output:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := c.Write(buf, compare.FormatJSON); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded compare.Comparison
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(decoded.Regressions()) != 1 || decoded.Regressions()[0].Name != "memory peak" {
+		t.Errorf("unexpected JSON output:\n%s", buf.String())
+	}
+}
+
+func TestRegressionError(t *testing.T) {
+	c := testComparison()
+	var err error = &compare.RegressionError{Regressions: c.Regressions(), Threshold: c.Threshold}
+
+	var exitCoder interface{ ExitCode() int }
+	if !errors.As(err, &exitCoder) || exitCoder.ExitCode() != compare.ExitCodeRegression {
+		t.Errorf("expected exit code %d", compare.ExitCodeRegression)
+	}
+	if err.Error() != "1 metric(s) regressed beyond 5%: memory peak" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+}
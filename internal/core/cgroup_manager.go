@@ -1,6 +1,15 @@
 package core
 
+import specs "github.com/opencontainers/runtime-spec/specs-go"
+
 type CgroupManager interface {
-	AddProcess(pid int) error // AddProcess adds a process to the cgroup
-	Delete() error            // Delete deletes the cgroup
+	AddProcess(pid int) error                    // AddProcess adds a process to the cgroup
+	Delete() error                               // Delete deletes the cgroup
+	Procs() ([]int, error)                       // Procs returns the PIDs of the processes in the cgroup
+	Kill() error                                 // Kill sends SIGKILL to every process in the cgroup
+	Freeze() error                               // Freeze stops every process in the cgroup
+	Thaw() error                                 // Thaw resumes the processes of a frozen cgroup
+	Update(resources specs.LinuxResources) error // Update sets the limits of the cgroup that are set in resources
+	Stats() (*Stats, error)                      // Stats returns a snapshot of the cgroup usage, normalized across cgroup v1 and v2
+	Path() string                                // Path returns the directory of the cgroup in the unified hierarchy, empty on cgroup v1
 }
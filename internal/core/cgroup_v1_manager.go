@@ -1,7 +1,11 @@
 package core
 
 import (
+	"fmt"
+	"syscall"
+
 	"github.com/containerd/cgroups/v3/cgroup1"
+	v1 "github.com/containerd/cgroups/v3/cgroup1/stats"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 )
 
@@ -26,3 +30,127 @@ func (m *CgroupV1Manager) AddProcess(pid int) error {
 func (m *CgroupV1Manager) Delete() error {
 	return m.control.Delete()
 }
+
+// Path is empty: cgroup v1 has one directory per subsystem and no unified files such as the pressure ones
+func (m *CgroupV1Manager) Path() string {
+	return ""
+}
+
+// Procs returns the PIDs of the processes in the cgroup v1
+func (m *CgroupV1Manager) Procs() ([]int, error) {
+	subsystems := m.control.Subsystems()
+	if len(subsystems) == 0 {
+		return nil, fmt.Errorf("no cgroup v1 subsystem available")
+	}
+	procs, err := m.control.Processes(subsystems[0].Name(), true)
+	if err != nil {
+		return nil, err
+	}
+	pids := make([]int, 0, len(procs))
+	for _, proc := range procs {
+		pids = append(pids, proc.Pid)
+	}
+	return pids, nil
+}
+
+// Kill kills every process in the cgroup v1.
+// cgroup v1 has no cgroup.kill file: the group is frozen so no process can fork while being signaled.
+func (m *CgroupV1Manager) Kill() error {
+	if err := m.control.Freeze(); err != nil {
+		return err
+	}
+	defer m.control.Thaw()
+	pids, err := m.Procs()
+	if err != nil {
+		return err
+	}
+	for _, pid := range pids {
+		syscall.Kill(pid, syscall.SIGKILL)
+	}
+	return nil
+}
+
+// Freeze freezes the cgroup v1
+func (m *CgroupV1Manager) Freeze() error {
+	return m.control.Freeze()
+}
+
+// Thaw thaws the cgroup v1
+func (m *CgroupV1Manager) Thaw() error {
+	return m.control.Thaw()
+}
+
+// Update sets the limits of the cgroup v1, the ones left unset are not changed
+func (m *CgroupV1Manager) Update(resources specs.LinuxResources) error {
+	return m.control.Update(&resources)
+}
+
+// Stats returns the usage of the cgroup v1, converted to the cgroup v2 units
+func (m *CgroupV1Manager) Stats() (*Stats, error) {
+	metrics, err := m.control.Stat(cgroup1.IgnoreNotExist)
+	if err != nil {
+		return nil, err
+	}
+	var stats Stats
+	if cpu := metrics.CPU; cpu != nil {
+		if usage := cpu.Usage; usage != nil {
+			stats.CPU.UsageUsec = usage.Total / 1000
+			stats.CPU.UserUsec = usage.User / 1000
+			stats.CPU.SystemUsec = usage.Kernel / 1000
+		}
+		if throttling := cpu.Throttling; throttling != nil {
+			stats.CPU.Periods = throttling.Periods
+			stats.CPU.ThrottledPeriods = throttling.ThrottledPeriods
+			stats.CPU.ThrottledUsec = throttling.ThrottledTime / 1000
+		}
+	}
+	if memory := metrics.Memory; memory != nil && memory.Usage != nil {
+		stats.Memory.Current = memory.Usage.Usage
+		stats.Memory.Peak = memory.Usage.Max
+		stats.Memory.Limit = memory.Usage.Limit
+		stats.Memory.File = memory.Cache
+		// cgroup v1 only counts the times the limit was hit
+		stats.Memory.Events.Max = memory.Usage.Failcnt
+	}
+	if pids := metrics.Pids; pids != nil {
+		stats.Pids.Current = pids.Current
+		stats.Pids.Limit = pids.Limit
+	}
+	if blkio := metrics.Blkio; blkio != nil {
+		stats.IO = blkioStats(blkio.IoServiceBytesRecursive, blkio.IoServicedRecursive)
+	}
+	return &stats, nil
+}
+
+// blkioStats merges the per-operation blkio entries of cgroup v1 into per-device IOStats
+func blkioStats(serviceBytes, serviced []*v1.BlkIOEntry) []IOStats {
+	var devices []IOStats
+	index := make(map[[2]uint64]int)
+	device := func(entry *v1.BlkIOEntry) *IOStats {
+		key := [2]uint64{entry.Major, entry.Minor}
+		i, ok := index[key]
+		if !ok {
+			i = len(devices)
+			index[key] = i
+			devices = append(devices, IOStats{Major: int64(entry.Major), Minor: int64(entry.Minor)})
+		}
+		return &devices[i]
+	}
+	for _, entry := range serviceBytes {
+		switch entry.Op {
+		case "Read":
+			device(entry).RBytes = entry.Value
+		case "Write":
+			device(entry).WBytes = entry.Value
+		}
+	}
+	for _, entry := range serviced {
+		switch entry.Op {
+		case "Read":
+			device(entry).RIOs = entry.Value
+		case "Write":
+			device(entry).WIOs = entry.Value
+		}
+	}
+	return devices
+}
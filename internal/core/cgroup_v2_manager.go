@@ -2,15 +2,35 @@ package core
 
 import (
 	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/containerd/cgroups/v3/cgroup2"
+	v2 "github.com/containerd/cgroups/v3/cgroup2/stats"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 )
 
 // CgroupV2Manager manages cgroup v2
 type CgroupV2Manager struct {
 	manager *cgroup2.Manager
+	path    string
+}
+
+// UnifiedMountpoint is where the cgroup v2 hierarchy is mounted
+var UnifiedMountpoint = "/sys/fs/cgroup"
+
+// SystemdSlicePath returns the path of a systemd slice in the unified hierarchy.
+// Dashes in a slice name nest it in its parent slices, e.g. giogo-cgroup-1.slice lives in giogo.slice/giogo-cgroup.slice.
+func SystemdSlicePath(slice string) string {
+	path := UnifiedMountpoint
+	parts := strings.Split(strings.TrimSuffix(slice, ".slice"), "-")
+	for i := range parts {
+		path = filepath.Join(path, strings.Join(parts[:i+1], "-")+".slice")
+	}
+	return path
 }
 
 func AddSliceSuffix(path string) string {
@@ -28,7 +48,18 @@ func NewCgroupV2Manager(path string, resources specs.LinuxResources) (CgroupMana
 	if err != nil {
 		return nil, err
 	}
-	return &CgroupV2Manager{manager: manager}, nil
+	// systemd does not set the cpuset of a transient unit, it is written once the group exists
+	if resources.CPU != nil && (resources.CPU.Cpus != "" || resources.CPU.Mems != "") {
+		if err := manager.ToggleControllers([]string{"cpuset"}, cgroup2.Enable); err != nil {
+			manager.DeleteSystemd()
+			return nil, fmt.Errorf("error enabling the cpuset controller: %v", err)
+		}
+		if err := manager.Update(&cgroup2.Resources{CPU: &cgroup2.CPU{Cpus: resources.CPU.Cpus, Mems: resources.CPU.Mems}}); err != nil {
+			manager.DeleteSystemd()
+			return nil, fmt.Errorf("error setting the cpuset: %v", err)
+		}
+	}
+	return &CgroupV2Manager{manager: manager, path: SystemdSlicePath(slicePath)}, nil
 }
 
 // AddProcess adds a process to the cgroup v2
@@ -40,3 +71,191 @@ func (m *CgroupV2Manager) AddProcess(pid int) error {
 func (m *CgroupV2Manager) Delete() error {
 	return m.manager.DeleteSystemd()
 }
+
+// Procs returns the PIDs of the processes in the cgroup v2
+func (m *CgroupV2Manager) Procs() ([]int, error) {
+	procs, err := m.manager.Procs(true)
+	if err != nil {
+		return nil, err
+	}
+	pids := make([]int, 0, len(procs))
+	for _, pid := range procs {
+		pids = append(pids, int(pid))
+	}
+	return pids, nil
+}
+
+// Kill kills every process in the cgroup v2
+func (m *CgroupV2Manager) Kill() error {
+	return m.manager.Kill()
+}
+
+// Freeze freezes the cgroup v2
+func (m *CgroupV2Manager) Freeze() error {
+	return m.manager.Freeze()
+}
+
+// Thaw thaws the cgroup v2
+func (m *CgroupV2Manager) Thaw() error {
+	return m.manager.Thaw()
+}
+
+// Update sets the limits of the cgroup v2, the ones left unset are not changed
+func (m *CgroupV2Manager) Update(resources specs.LinuxResources) error {
+	return m.manager.Update(cgroup2.ToResources(&resources))
+}
+
+// Path returns the directory of the cgroup v2
+func (m *CgroupV2Manager) Path() string {
+	return m.path
+}
+
+// Stats returns the usage of the cgroup v2
+func (m *CgroupV2Manager) Stats() (*Stats, error) {
+	metrics, err := m.manager.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var stats Stats
+	if cpu := metrics.CPU; cpu != nil {
+		stats.CPU = CPUStats{
+			UsageUsec:        cpu.UsageUsec,
+			UserUsec:         cpu.UserUsec,
+			SystemUsec:       cpu.SystemUsec,
+			Periods:          cpu.NrPeriods,
+			ThrottledPeriods: cpu.NrThrottled,
+			ThrottledUsec:    cpu.ThrottledUsec,
+		}
+		stats.PSI.CPU = pressureStats(cpu.PSI)
+	}
+	if memory := metrics.Memory; memory != nil {
+		stats.Memory.Current = memory.Usage
+		stats.Memory.Peak = memory.MaxUsage
+		stats.Memory.Limit = memory.UsageLimit
+		stats.Memory.File = memory.File
+		stats.PSI.Memory = pressureStats(memory.PSI)
+	}
+	if events := metrics.MemoryEvents; events != nil {
+		stats.Memory.Events = MemoryEventsStats{
+			Low:     events.Low,
+			High:    events.High,
+			Max:     events.Max,
+			OOM:     events.Oom,
+			OOMKill: events.OomKill,
+		}
+	}
+	if pids := metrics.Pids; pids != nil {
+		stats.Pids.Current = pids.Current
+		stats.Pids.Limit = pids.Limit
+	}
+	// pids.peak is not exposed by the cgroups library
+	stats.Pids.Peak = readUint64File(filepath.Join(m.path, "pids.peak"))
+	if io := metrics.Io; io != nil {
+		stats.PSI.IO = pressureStats(io.PSI)
+	}
+	// The discards of io.stat are not exposed by the cgroups library
+	stats.IO = readIOStat(filepath.Join(m.path, "io.stat"))
+	readIOMax(filepath.Join(m.path, "io.max"), stats.IO)
+	return &stats, nil
+}
+
+// readIOStat reads io.stat, one "major:minor rbytes=... wbytes=... rios=... wios=... dbytes=... dios=..." line per device
+func readIOStat(path string) []IOStats {
+	var devices []IOStats
+	forEachDevice(path, func(major, minor int64, key string, value uint64) {
+		if len(devices) == 0 || devices[len(devices)-1].Major != major || devices[len(devices)-1].Minor != minor {
+			devices = append(devices, IOStats{Major: major, Minor: minor})
+		}
+		device := &devices[len(devices)-1]
+		switch key {
+		case "rbytes":
+			device.RBytes = value
+		case "wbytes":
+			device.WBytes = value
+		case "rios":
+			device.RIOs = value
+		case "wios":
+			device.WIOs = value
+		case "dbytes":
+			device.DBytes = value
+		case "dios":
+			device.DIOs = value
+		}
+	})
+	return devices
+}
+
+// readIOMax sets the bandwidth throttles of io.max in the devices it lists
+func readIOMax(path string, devices []IOStats) {
+	forEachDevice(path, func(major, minor int64, key string, value uint64) {
+		for i := range devices {
+			if devices[i].Major != major || devices[i].Minor != minor {
+				continue
+			}
+			switch key {
+			case "rbps":
+				devices[i].RBpsMax = value
+			case "wbps":
+				devices[i].WBpsMax = value
+			}
+		}
+	})
+}
+
+// forEachDevice calls fn for every key=value of a nested keyed file such as io.stat, "max" values are skipped
+func forEachDevice(path string, fn func(major, minor int64, key string, value uint64)) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var major, minor int64
+		if _, err := fmt.Sscanf(fields[0], "%d:%d", &major, &minor); err != nil {
+			continue
+		}
+		for _, field := range fields[1:] {
+			key, value, found := strings.Cut(field, "=")
+			if !found {
+				continue
+			}
+			if parsed, err := strconv.ParseUint(value, 10, 64); err == nil {
+				fn(major, minor, key, parsed)
+			}
+		}
+	}
+}
+
+func pressureStats(psi *v2.PSIStats) PressureStats {
+	var pressure PressureStats
+	if psi == nil {
+		return pressure
+	}
+	if some := psi.Some; some != nil {
+		pressure.Some = PressureData{Avg10: some.Avg10, Avg60: some.Avg60, Avg300: some.Avg300, TotalUsec: some.Total}
+	}
+	if full := psi.Full; full != nil {
+		pressure.Full = PressureData{Avg10: full.Avg10, Avg60: full.Avg60, Avg300: full.Avg300, TotalUsec: full.Total}
+	}
+	return pressure
+}
+
+// readUint64File reads a single value cgroup file, "max" is reported as math.MaxUint64 and missing files as 0
+func readUint64File(path string) uint64 {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	value := strings.TrimSpace(string(content))
+	if value == "max" {
+		return math.MaxUint64
+	}
+	parsed, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return parsed
+}
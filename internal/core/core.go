@@ -1,10 +1,12 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"regexp"
+	"time"
 
 	"github.com/containerd/cgroups/v3"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
@@ -13,8 +15,20 @@ import (
 
 // Core struct holds the resources and the CgroupManager
 type Core struct {
-	Resources     specs.LinuxResources
-	CgroupManager CgroupManager
+	Resources       specs.LinuxResources
+	CgroupManager   CgroupManager
+	ProcessLimiters []ProcessLimiter
+	// Identity, when set, is the unprivileged user the command runs as.
+	// The cgroup is still created and joined by giogo with its own privileges.
+	Identity *Identity
+	// Watchers observe the cgroup while the command runs
+	Watchers []Watcher
+	// Reporters receive the final usage of the cgroup before it is deleted
+	Reporters []Reporter
+	// Name is the name of the cgroup
+	Name string
+	// Labels are stored on the cgroup directory and set in every Stats read while the command runs
+	Labels []Label
 }
 
 func IsValidSystemdSlice(path string) bool {
@@ -35,10 +49,23 @@ func GenerateCgroupPath() string {
 	return cgroupSystemdSlice
 }
 
+// GenerateRunCgroupPath returns the name of the cgroup of one of several runs made concurrently by giogo
+func GenerateRunCgroupPath(run int) string {
+	cgroupSystemdSlice := fmt.Sprintf("%sx%d", GenerateCgroupPath(), run)
+	if !IsValidSystemdSlice(cgroupSystemdSlice) {
+		panic("Invalid systemd slice path")
+	}
+	return cgroupSystemdSlice
+}
+
 // NewCore returns a new Core instance and initializes the appropriate CgroupManager based on the cgroup version
 func NewCore(resources specs.LinuxResources) (*Core, error) {
+	return NewNamedCore(GenerateCgroupPath(), resources)
+}
+
+// NewNamedCore is NewCore with the name of the cgroup
+func NewNamedCore(cgroupPath string, resources specs.LinuxResources) (*Core, error) {
 	cgroupMode := cgroups.Mode()
-	cgroupPath := GenerateCgroupPath()
 
 	fmt.Printf("Creating core for groupPath %s\n", cgroupPath)
 
@@ -61,6 +88,7 @@ func NewCore(resources specs.LinuxResources) (*Core, error) {
 	return &Core{
 		Resources:     resources,
 		CgroupManager: manager,
+		Name:          cgroupPath,
 	}, nil
 }
 
@@ -72,29 +100,176 @@ func (c *Core) RunCommand(args []string) error {
 			fmt.Fprintf(os.Stderr, "failed to delete cgroup: %v\n", err)
 		}
 	}()
-	// Prepare the command to execute
-	execCmd := exec.Command(args[0], args[1:]...)
+
+	if len(c.Labels) > 0 {
+		// The labels still reach the stats and reporters when they cannot be stored on the cgroup
+		if path := c.CgroupManager.Path(); path == "" {
+			fmt.Fprintln(os.Stderr, "labels not stored on the cgroup: extended attributes require cgroup v2")
+		} else if err := WriteLabels(path, c.Labels); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+	}
+
+	start := time.Now()
+	state, err := c.run(args)
+	if len(c.Reporters) == 0 {
+		return err
+	}
+
+	// Report the final usage while the cgroup still exists
+	result := &Result{
+		Name:      c.Name,
+		Command:   args,
+		Resources: c.Resources,
+		Start:     start,
+		WallTime:  time.Since(start),
+		ExitCode:  -1,
+		Err:       err,
+	}
+	if state != nil {
+		result.ExitCode = state.ExitCode()
+	}
+	for _, w := range c.Watchers {
+		if st, ok := w.(SnapshotTaker); ok {
+			result.Snapshots = append(result.Snapshots, st.Snapshots()...)
+		}
+	}
+	if stats, statsErr := c.manager().Stats(); statsErr == nil {
+		result.Stats = stats
+	} else {
+		fmt.Fprintf(os.Stderr, "failed to read cgroup stats: %v\n", statsErr)
+	}
+	for _, r := range c.Reporters {
+		if reportErr := r.Report(result); reportErr != nil {
+			// A failed report only fails the run when the command itself succeeded, the next reporters see it
+			if err == nil {
+				err = reportErr
+				result.Err = reportErr
+			} else {
+				fmt.Fprintf(os.Stderr, "%v\n", reportErr)
+			}
+		}
+	}
+	return err
+}
+
+// processAttr returns the settings the command is executed with, nil when it needs none
+func (c *Core) processAttr() *ProcessAttr {
+	if len(c.ProcessLimiters) == 0 && c.Identity == nil {
+		return nil
+	}
+	attr := &ProcessAttr{}
+	for _, pl := range c.ProcessLimiters {
+		pl.ApplyProcess(attr)
+	}
+	if c.Identity != nil {
+		attr.Credential = c.Identity.Credential()
+	}
+	return attr
+}
+
+// manager returns the cgroup manager the watchers and reporters read the stats from
+func (c *Core) manager() CgroupManager {
+	var annotators []StatsAnnotator
+	if len(c.Labels) > 0 {
+		annotators = append(annotators, labelAnnotator(LabelMap(c.Labels)))
+	}
+	for _, w := range c.Watchers {
+		if a, ok := w.(StatsAnnotator); ok {
+			annotators = append(annotators, a)
+		}
+	}
+	if len(annotators) == 0 {
+		return c.CgroupManager
+	}
+	return &annotatedManager{CgroupManager: c.CgroupManager, annotators: annotators}
+}
+
+// run starts the command in the cgroup and waits for it, the process state is nil when the command did not start
+func (c *Core) run(args []string) (*os.ProcessState, error) {
+	// Prepare the command to execute, through the exec shim when it has to be set up before exec
+	var execCmd *exec.Cmd
+	var status, resume *os.File
+	if attr := c.processAttr(); attr != nil {
+		var err error
+		execCmd, status, resume, err = execShimCommand(args, attr)
+		if err != nil {
+			return nil, fmt.Errorf("error preparing command: %v", err)
+		}
+		defer status.Close()
+		// Closing the pipe before resuming the shim makes it exit without executing the command
+		defer resume.Close()
+	} else {
+		execCmd = exec.Command(args[0], args[1:]...)
+	}
 	execCmd.Stdout = os.Stdout
 	execCmd.Stderr = os.Stderr
 	execCmd.Stdin = os.Stdin
+	if c.Identity != nil {
+		execCmd.Env = c.Identity.Environ(os.Environ())
+	}
 
 	// Start the command
 	err := execCmd.Start()
+	if status != nil {
+		for _, file := range execCmd.ExtraFiles {
+			file.Close()
+		}
+	}
 	if err != nil {
-		return fmt.Errorf("error starting command: %v", err)
+		return nil, fmt.Errorf("error starting command: %v", err)
 	}
 
 	// Add the process to the cgroup
 	err = c.CgroupManager.AddProcess(execCmd.Process.Pid)
 	if err != nil {
-		return fmt.Errorf("error adding process to cgroup: %v", err)
+		if resume != nil {
+			resume.Close()
+			execCmd.Wait()
+		}
+		return nil, fmt.Errorf("error adding process to cgroup: %v", err)
+	}
+
+	// Resume the exec shim, now in the cgroup, and wait for it to execute the command
+	if status != nil {
+		if err := resumeExecShim(resume); err != nil {
+			execCmd.Process.Kill()
+			execCmd.Wait()
+			return execCmd.ProcessState, fmt.Errorf("error resuming command: %v", err)
+		}
+		if err := waitExecShim(status); err != nil {
+			execCmd.Wait()
+			return execCmd.ProcessState, err
+		}
+	}
+
+	// Watch the cgroup until the command finishes
+	ctx, cancel := context.WithCancel(context.Background())
+	watchErrs := make(chan error, len(c.Watchers))
+	manager := c.manager()
+	for _, w := range c.Watchers {
+		go func(w Watcher) {
+			watchErrs <- w.Watch(ctx, manager)
+		}(w)
 	}
 
 	// Wait for the command to finish
 	err = execCmd.Wait()
+	cancel()
+
+	// A watcher error explains why the command was stopped, so it takes precedence over the exit status
+	var watchErr error
+	for range c.Watchers {
+		if err := <-watchErrs; err != nil && watchErr == nil {
+			watchErr = err
+		}
+	}
+	if watchErr != nil {
+		return execCmd.ProcessState, watchErr
+	}
 	if err != nil {
-		return fmt.Errorf("command exited with error: %v", err)
+		return execCmd.ProcessState, fmt.Errorf("command exited with error: %v", err)
 	}
 
-	return nil
+	return execCmd.ProcessState, nil
 }
@@ -1,15 +1,29 @@
 package core_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/pmarchini/giogo/internal/core"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
+func TestMain(m *testing.M) {
+	// The process settings are applied by the test binary re-executed as the exec shim
+	core.ExecShim()
+	os.Exit(m.Run())
+}
+
 // TestRunCommand tests the Core RunCommand method using a mocked CgroupManager
 func TestRunCommand(t *testing.T) {
 	mockManager := new(core.MockCgroupManager)
@@ -66,3 +80,418 @@ func TestRunCommand_AddProcessError(t *testing.T) {
 	mockManager.AssertCalled(t, "AddProcess", mock.AnythingOfType("int"))
 	mockManager.AssertCalled(t, "Delete")
 }
+
+type attrProcessLimiter struct {
+	attr core.ProcessAttr
+}
+
+func (l *attrProcessLimiter) ApplyProcess(attr *core.ProcessAttr) {
+	*attr = l.attr
+}
+
+// runForked runs a command forking a child that writes its view of /proc/self/<file> to a file, and returns it
+func runForked(t *testing.T, c *core.Core, file string) string {
+	t.Helper()
+	output := filepath.Join(t.TempDir(), "output")
+	err := c.RunCommand([]string{"sh", "-c", "sleep 10 & cat /proc/$!/" + file + " > " + output + "; kill $!"})
+	assert.NoError(t, err)
+	content, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	return string(content)
+}
+
+// TestRunCommand_ProcessLimiters tests that the process settings are in place before the command forks
+func TestRunCommand_ProcessLimiters(t *testing.T) {
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("AddProcess", mock.AnythingOfType("int")).Return(nil)
+	mockManager.On("Delete").Return(nil)
+
+	// Lowering the priority and raising the OOM score never require privileges
+	nice, oomScoreAdj := 7, 900
+	core := &core.Core{
+		CgroupManager: mockManager,
+		ProcessLimiters: []core.ProcessLimiter{&attrProcessLimiter{attr: core.ProcessAttr{
+			Nice:        &nice,
+			OOMScoreAdj: &oomScoreAdj,
+		}}},
+	}
+
+	stat := strings.Fields(runForked(t, core, "stat"))
+	// The nice value is the 19th field of the stat file
+	assert.Equal(t, "7", stat[18])
+	assert.Equal(t, "900\n", runForked(t, core, "oom_score_adj"))
+}
+
+// TestRunCommand_ExecShimWaitsForCgroup tests that the command is only executed once it was added to the cgroup
+func TestRunCommand_ExecShimWaitsForCgroup(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "marker")
+	var ranBeforeAdded bool
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("AddProcess", mock.AnythingOfType("int")).Return(nil).Run(func(mock.Arguments) {
+		// Leave the command the time to run, were it not waiting
+		time.Sleep(100 * time.Millisecond)
+		_, err := os.Stat(marker)
+		ranBeforeAdded = err == nil
+	})
+	mockManager.On("Delete").Return(nil)
+
+	nice := 7
+	c := &core.Core{
+		CgroupManager:   mockManager,
+		ProcessLimiters: []core.ProcessLimiter{&attrProcessLimiter{attr: core.ProcessAttr{Nice: &nice}}},
+	}
+	assert.NoError(t, c.RunCommand([]string{"touch", marker}))
+	assert.False(t, ranBeforeAdded, "the command ran before it was added to the cgroup")
+	assert.FileExists(t, marker)
+
+	// When the process cannot be added to the cgroup, the command never runs
+	os.Remove(marker)
+	mockManager = new(core.MockCgroupManager)
+	mockManager.On("AddProcess", mock.AnythingOfType("int")).Return(fmt.Errorf("failed to add process"))
+	mockManager.On("Delete").Return(nil)
+	c.CgroupManager = mockManager
+	err := c.RunCommand([]string{"touch", marker})
+	assert.ErrorContains(t, err, "failed to add process")
+	assert.NoFileExists(t, marker)
+}
+
+// TestRunCommand_Rlimits tests that a child forked as soon as the command starts has the rlimits
+func TestRunCommand_Rlimits(t *testing.T) {
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("AddProcess", mock.AnythingOfType("int")).Return(nil)
+	mockManager.On("Delete").Return(nil)
+
+	core := &core.Core{
+		CgroupManager: mockManager,
+		ProcessLimiters: []core.ProcessLimiter{&attrProcessLimiter{attr: core.ProcessAttr{Rlimits: []core.Rlimit{
+			{Name: "NOFILE", Resource: syscall.RLIMIT_NOFILE, Soft: 512, Hard: 1024},
+			{Name: "CORE", Resource: syscall.RLIMIT_CORE, Soft: 0, Hard: 0},
+		}}}},
+	}
+
+	limits := runForked(t, core, "limits")
+	assert.Regexp(t, `Max open files\s+512\s+1024\s`, limits)
+	assert.Regexp(t, `Max core file size\s+0\s+0\s`, limits)
+}
+
+// TestRunCommand_ProcessLimiterError tests that a setting the child cannot apply aborts the command before exec
+func TestRunCommand_ProcessLimiterError(t *testing.T) {
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("AddProcess", mock.AnythingOfType("int")).Return(nil)
+	mockManager.On("Delete").Return(nil)
+
+	oomScoreAdj := 5000
+	core := &core.Core{
+		CgroupManager:   mockManager,
+		ProcessLimiters: []core.ProcessLimiter{&attrProcessLimiter{attr: core.ProcessAttr{OOMScoreAdj: &oomScoreAdj}}},
+	}
+
+	err := core.RunCommand([]string{"sleep", "10"})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "error setting OOM score adjustment")
+	mockManager.AssertCalled(t, "Delete")
+}
+
+type failingWatcher struct {
+	err error
+}
+
+func (f *failingWatcher) Watch(ctx context.Context, manager core.CgroupManager) error {
+	if err := manager.Kill(); err != nil {
+		return err
+	}
+	return f.err
+}
+
+// TestRunCommand_WatcherError tests that a watcher error takes precedence over the command exit status
+func TestRunCommand_WatcherError(t *testing.T) {
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("AddProcess", mock.AnythingOfType("int")).Return(nil)
+	mockManager.On("Kill").Return(nil)
+	mockManager.On("Delete").Return(nil)
+
+	core := &core.Core{
+		CgroupManager: mockManager,
+		Watchers:      []core.Watcher{&failingWatcher{err: fmt.Errorf("budget exceeded")}},
+	}
+
+	err := core.RunCommand([]string{"sh", "-c", "exit 3"})
+
+	assert.EqualError(t, err, "budget exceeded")
+	mockManager.AssertCalled(t, "Kill")
+	mockManager.AssertCalled(t, "Delete")
+}
+
+func TestTerminateGroup_KillsAfterGracePeriod(t *testing.T) {
+	mockManager := new(core.MockCgroupManager)
+	// A PID that does not exist, signaling it is a no-op
+	mockManager.On("Procs").Return([]int{1 << 22}, nil)
+	mockManager.On("Kill").Return(nil)
+
+	err := core.TerminateGroup(mockManager, syscall.SIGTERM, 10*time.Millisecond)
+
+	assert.NoError(t, err)
+	mockManager.AssertCalled(t, "Kill")
+}
+
+type recordingReporter struct {
+	results []*core.Result
+	err     error
+}
+
+func (r *recordingReporter) Report(result *core.Result) error {
+	r.results = append(r.results, result)
+	return r.err
+}
+
+// TestRunCommand_Reporters tests that the reporters receive the final stats before the cgroup is deleted
+func TestRunCommand_Reporters(t *testing.T) {
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("AddProcess", mock.AnythingOfType("int")).Return(nil)
+	mockManager.On("Stats").Return(&core.Stats{Memory: core.MemoryStats{Peak: 42}}, nil)
+	mockManager.On("Delete").Return(nil)
+
+	reporter := &recordingReporter{}
+	core := &core.Core{
+		Name:          "giogo-cgroup-1",
+		CgroupManager: mockManager,
+		Reporters:     []core.Reporter{reporter},
+	}
+
+	err := core.RunCommand([]string{"sh", "-c", "exit 3"})
+
+	assert.Error(t, err)
+	assert.Len(t, reporter.results, 1)
+	result := reporter.results[0]
+	assert.Equal(t, "giogo-cgroup-1", result.Name)
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Equal(t, uint64(42), result.Stats.Memory.Peak)
+	assert.Equal(t, err, result.Err)
+}
+
+// TestRunCommand_ReporterError tests that a reporter error fails an otherwise successful run
+func TestRunCommand_ReporterError(t *testing.T) {
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("AddProcess", mock.AnythingOfType("int")).Return(nil)
+	mockManager.On("Stats").Return(&core.Stats{}, nil)
+	mockManager.On("Delete").Return(nil)
+
+	next := &recordingReporter{}
+	core := &core.Core{
+		CgroupManager: mockManager,
+		Reporters:     []core.Reporter{&recordingReporter{err: fmt.Errorf("report failed")}, next},
+	}
+
+	err := core.RunCommand([]string{"echo", "hello"})
+
+	assert.EqualError(t, err, "report failed")
+	// The next reporters see the run as failed
+	assert.Len(t, next.results, 1)
+	assert.EqualError(t, next.results[0].Err, "report failed")
+}
+
+type snapshottingWatcher struct{}
+
+func (w *snapshottingWatcher) Watch(ctx context.Context, manager core.CgroupManager) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (w *snapshottingWatcher) Snapshots() []string {
+	return []string{"/tmp/giogo-cgroup-1-oom-20240102T030405.000"}
+}
+
+// TestRunCommand_Snapshots tests that the snapshots of the watchers end up in the result
+func TestRunCommand_Snapshots(t *testing.T) {
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("AddProcess", mock.AnythingOfType("int")).Return(nil)
+	mockManager.On("Stats").Return(&core.Stats{}, nil)
+	mockManager.On("Delete").Return(nil)
+
+	reporter := &recordingReporter{}
+	core := &core.Core{
+		CgroupManager: mockManager,
+		Watchers:      []core.Watcher{&snapshottingWatcher{}},
+		Reporters:     []core.Reporter{reporter},
+	}
+
+	err := core.RunCommand([]string{"echo", "hello"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/tmp/giogo-cgroup-1-oom-20240102T030405.000"}, reporter.results[0].Snapshots)
+}
+
+type annotatingWatcher struct {
+	seen chan *core.Stats
+}
+
+func (w *annotatingWatcher) Watch(ctx context.Context, manager core.CgroupManager) error {
+	stats, err := manager.Stats()
+	if err != nil {
+		return err
+	}
+	w.seen <- stats
+	<-ctx.Done()
+	return nil
+}
+
+func (w *annotatingWatcher) Annotate(stats *core.Stats) {
+	stats.Memory.WorkingSet = &core.WorkingSetStats{Current: 7}
+}
+
+// TestRunCommand_Annotators tests that the stats read by the watchers and the reporters are annotated
+func TestRunCommand_Annotators(t *testing.T) {
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("AddProcess", mock.AnythingOfType("int")).Return(nil)
+	mockManager.On("Stats").Return(&core.Stats{}, nil)
+	mockManager.On("Delete").Return(nil)
+
+	watcher := &annotatingWatcher{seen: make(chan *core.Stats, 1)}
+	reporter := &recordingReporter{}
+	core := &core.Core{
+		CgroupManager: mockManager,
+		Watchers:      []core.Watcher{watcher},
+		Reporters:     []core.Reporter{reporter},
+	}
+
+	err := core.RunCommand([]string{"sleep", "0.05"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(7), (<-watcher.seen).Memory.WorkingSet.Current)
+	assert.Equal(t, uint64(7), reporter.results[0].Stats.Memory.WorkingSet.Current)
+}
+
+func TestSystemdSlicePath(t *testing.T) {
+	assert.Equal(t, "/sys/fs/cgroup/giogo.slice/giogo-cgroup.slice/giogo-cgroup-1234.slice", core.SystemdSlicePath("giogo-cgroup-1234.slice"))
+	assert.Equal(t, "/sys/fs/cgroup/single.slice", core.SystemdSlicePath("single"))
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := core.ParseLabels([]string{"team=ci", "job=build=1", "empty="})
+	assert.NoError(t, err)
+	assert.Equal(t, []core.Label{{Name: "team", Value: "ci"}, {Name: "job", Value: "build=1"}, {Name: "empty", Value: ""}}, labels)
+
+	for _, invalid := range [][]string{{"team"}, {"1team=ci"}, {"te-am=ci"}, {"team=a", "team=b"}} {
+		_, err := core.ParseLabels(invalid)
+		assert.Error(t, err, "expected error for %v", invalid)
+	}
+}
+
+// TestRunCommand_Labels tests that the labels are stored on the cgroup directory and set in the stats
+func TestRunCommand_Labels(t *testing.T) {
+	dir := t.TempDir()
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("Path").Return(dir)
+	mockManager.On("AddProcess", mock.AnythingOfType("int")).Return(nil)
+	mockManager.On("Stats").Return(&core.Stats{}, nil)
+	mockManager.On("Delete").Return(nil)
+
+	labels := []core.Label{{Name: "team", Value: "infra"}, {Name: "job", Value: "1234"}}
+	reporter := &recordingReporter{}
+	c := &core.Core{
+		CgroupManager: mockManager,
+		Reporters:     []core.Reporter{reporter},
+		Labels:        labels,
+	}
+
+	err := c.RunCommand([]string{"echo", "hello"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "infra", "job": "1234"}, reporter.results[0].Stats.Labels)
+	stored, err := readLabels(t, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []core.Label{{Name: "job", Value: "1234"}, {Name: "team", Value: "infra"}}, stored)
+}
+
+// readLabels reads the labels of dir, skipping the test when its file system has no user extended attributes
+func readLabels(t *testing.T, dir string) ([]core.Label, error) {
+	labels, err := core.ReadLabels(dir)
+	if errors.Is(err, syscall.ENOTSUP) {
+		t.Skip("user extended attributes are not supported")
+	}
+	return labels, err
+}
+
+func TestReadLabels(t *testing.T) {
+	dir := t.TempDir()
+	labels, err := readLabels(t, dir)
+	assert.NoError(t, err)
+	assert.Empty(t, labels)
+
+	long := strings.Repeat("x", 1000)
+	err = core.WriteLabels(dir, []core.Label{{Name: "long", Value: long}, {Name: "empty", Value: ""}})
+	if errors.Is(err, syscall.ENOTSUP) {
+		t.Skip("user extended attributes are not supported")
+	}
+	assert.NoError(t, err)
+	assert.NoError(t, syscall.Setxattr(dir, "user.other", []byte("ignored"), 0))
+	labels, err = core.ReadLabels(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []core.Label{{Name: "empty", Value: ""}, {Name: "long", Value: long}}, labels)
+
+	assert.True(t, core.MatchLabels(labels, []core.Label{{Name: "empty", Value: ""}}))
+	assert.True(t, core.MatchLabels(labels, nil))
+	assert.False(t, core.MatchLabels(labels, []core.Label{{Name: "long", Value: "x"}}))
+	assert.False(t, core.MatchLabels(labels, []core.Label{{Name: "team", Value: ""}}))
+}
+
+func TestListAndLoadGroups(t *testing.T) {
+	mountpoint := t.TempDir()
+	defer func(previous string) { core.UnifiedMountpoint = previous }(core.UnifiedMountpoint)
+	core.UnifiedMountpoint = mountpoint
+
+	names, err := core.ListGroups()
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+
+	for _, name := range []string{"giogo-cgroup-12.slice", "giogo-cgroup-3x1.slice", "other.slice"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(core.SystemdSlicePath("giogo-cgroup.slice"), name), 0755))
+	}
+	names, err = core.ListGroups()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"giogo-cgroup-12", "giogo-cgroup-3x1"}, names)
+
+	dir := core.SystemdSlicePath("giogo-cgroup-12.slice")
+	for _, file := range []string{"cgroup.freeze", "memory.max"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, file), nil, 0644))
+	}
+	manager, err := core.LoadGroup(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, dir, manager.Path())
+	assert.NoError(t, manager.Freeze())
+	limit := int64(64 * 1024 * 1024)
+	assert.NoError(t, manager.Update(specs.LinuxResources{Memory: &specs.LinuxMemory{Limit: &limit}}))
+	for file, expected := range map[string]string{"cgroup.freeze": "1", "memory.max": "67108864"} {
+		content, err := os.ReadFile(filepath.Join(dir, file))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, strings.TrimSpace(string(content)))
+	}
+
+	_, err = core.LoadGroup(t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestCgroupV2Stats_IO(t *testing.T) {
+	mountpoint := t.TempDir()
+	defer func(previous string) { core.UnifiedMountpoint = previous }(core.UnifiedMountpoint)
+	core.UnifiedMountpoint = mountpoint
+
+	dir := filepath.Join(mountpoint, "giogo-cgroup-1")
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	for file, content := range map[string]string{
+		"cgroup.controllers": "io\n",
+		"io.stat":            "8:0 rbytes=4096 wbytes=8192 rios=1 wios=2 dbytes=512 dios=1\n8:16 rbytes=1024 wbytes=0 rios=1 wios=0 dbytes=0 dios=0\n",
+		"io.max":             "8:0 rbps=1048576 wbps=max riops=max wiops=max\n",
+	} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, file), []byte(content), 0644))
+	}
+	manager, err := core.LoadGroup(dir)
+	assert.NoError(t, err)
+	stats, err := manager.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, []core.IOStats{
+		{Major: 8, Minor: 0, RBytes: 4096, WBytes: 8192, RIOs: 1, WIOs: 2, DBytes: 512, DIOs: 1, RBpsMax: 1048576},
+		{Major: 8, Minor: 16, RBytes: 1024, RIOs: 1},
+	}, stats.IO)
+}
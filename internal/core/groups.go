@@ -0,0 +1,48 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/containerd/cgroups/v3/cgroup2"
+)
+
+// groupPrefix is the prefix of the names of the cgroups created by giogo, see GenerateCgroupPath
+const groupPrefix = "giogo-cgroup-"
+
+// ListGroups returns the names of the cgroups of the running giogo commands, e.g. giogo-cgroup-1234, sorted
+func ListGroups() ([]string, error) {
+	entries, err := os.ReadDir(SystemdSlicePath("giogo-cgroup.slice"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		name, isSlice := strings.CutSuffix(entry.Name(), ".slice")
+		if entry.IsDir() && isSlice && strings.HasPrefix(name, groupPrefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// LoadGroup returns the manager of an existing cgroup v2 directory, such as the one of another giogo command.
+// The group belongs to the command that created it: it must not be deleted through the manager.
+func LoadGroup(dir string) (CgroupManager, error) {
+	relative, err := filepath.Rel(UnifiedMountpoint, dir)
+	if err != nil || relative == "." || strings.HasPrefix(relative, "..") {
+		return nil, fmt.Errorf("%s is not a group of the cgroup v2 hierarchy mounted at %s", dir, UnifiedMountpoint)
+	}
+	manager, err := cgroup2.Load("/"+relative, cgroup2.WithMountpoint(UnifiedMountpoint))
+	if err != nil {
+		return nil, err
+	}
+	return &CgroupV2Manager{manager: manager, path: dir}, nil
+}
@@ -0,0 +1,162 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Identity is the unprivileged user and group the command runs as once the cgroup is set up
+type Identity struct {
+	Username string
+	Home     string
+	UID, GID uint32
+	Groups   []uint32
+}
+
+// ResolveIdentity looks up the identity for the given user and optional group, both as names or numeric IDs.
+// When no group is given the primary group of the user is used.
+func ResolveIdentity(userName, groupName string) (*Identity, error) {
+	u, err := user.Lookup(userName)
+	if err != nil {
+		var lookupErr error
+		u, lookupErr = user.LookupId(userName)
+		if lookupErr != nil {
+			return nil, fmt.Errorf("unknown user %q: %v", userName, err)
+		}
+	}
+	identity, err := identityFromUser(u)
+	if err != nil {
+		return nil, err
+	}
+
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			var lookupErr error
+			g, lookupErr = user.LookupGroupId(groupName)
+			if lookupErr != nil {
+				return nil, fmt.Errorf("unknown group %q: %v", groupName, err)
+			}
+		}
+		gid, err := strconv.ParseUint(g.Gid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gid %q for group %q", g.Gid, groupName)
+		}
+		identity.GID = uint32(gid)
+	}
+
+	return identity, nil
+}
+
+// SudoIdentity returns the identity of the user who invoked giogo through sudo, from SUDO_UID and SUDO_GID
+func SudoIdentity() (*Identity, error) {
+	sudoUID := os.Getenv("SUDO_UID")
+	if sudoUID == "" {
+		return nil, fmt.Errorf("SUDO_UID is not set, giogo was not started through sudo")
+	}
+	u, err := user.LookupId(sudoUID)
+	if err != nil {
+		return nil, fmt.Errorf("unknown sudo user %s: %v", sudoUID, err)
+	}
+	identity, err := identityFromUser(u)
+	if err != nil {
+		return nil, err
+	}
+
+	if sudoGID := os.Getenv("SUDO_GID"); sudoGID != "" {
+		gid, err := strconv.ParseUint(sudoGID, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SUDO_GID %q", sudoGID)
+		}
+		identity.GID = uint32(gid)
+	}
+
+	return identity, nil
+}
+
+func identityFromUser(u *user.User) (*Identity, error) {
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uid %q for user %q", u.Uid, u.Username)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gid %q for user %q", u.Gid, u.Username)
+	}
+
+	var groups []uint32
+	groupIds, err := u.GroupIds()
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving groups of user %q: %v", u.Username, err)
+	}
+	for _, id := range groupIds {
+		group, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			continue
+		}
+		groups = append(groups, uint32(group))
+	}
+
+	return &Identity{
+		Username: u.Username,
+		Home:     u.HomeDir,
+		UID:      uint32(uid),
+		GID:      uint32(gid),
+		Groups:   groups,
+	}, nil
+}
+
+// Credential returns the credential used by the child process
+func (i *Identity) Credential() *syscall.Credential {
+	return &syscall.Credential{
+		Uid:    i.UID,
+		Gid:    i.GID,
+		Groups: i.Groups,
+	}
+}
+
+// environAllowlist is the environment of giogo kept for the identity, along with the LC_* variables
+var environAllowlist = map[string]bool{
+	"TERM":      true,
+	"COLORTERM": true,
+	"LANG":      true,
+	"LANGUAGE":  true,
+	"TZ":        true,
+}
+
+// Environ returns a sanitized copy of env for the identity.
+// Only the terminal and locale variables are kept, PATH only keeps absolute entries
+// and HOME, USER and LOGNAME point to the target user.
+func (i *Identity) Environ(env []string) []string {
+	var sanitized []string
+	for _, kv := range env {
+		key, value, _ := strings.Cut(kv, "=")
+		switch {
+		case key == "PATH":
+			sanitized = append(sanitized, "PATH="+sanitizePath(value))
+		case environAllowlist[key] || strings.HasPrefix(key, "LC_"):
+			sanitized = append(sanitized, kv)
+		}
+	}
+	return append(sanitized,
+		"HOME="+i.Home,
+		"USER="+i.Username,
+		"LOGNAME="+i.Username,
+	)
+}
+
+// sanitizePath drops empty and relative entries, which would resolve against the working directory
+func sanitizePath(path string) string {
+	var entries []string
+	for _, entry := range filepath.SplitList(path) {
+		if filepath.IsAbs(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return strings.Join(entries, string(os.PathListSeparator))
+}
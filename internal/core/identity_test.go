@@ -0,0 +1,132 @@
+package core_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestResolveIdentity(t *testing.T) {
+	byName, err := core.ResolveIdentity("root", "")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0), byName.UID)
+	assert.Equal(t, uint32(0), byName.GID)
+	assert.Equal(t, "root", byName.Username)
+
+	byID, err := core.ResolveIdentity("0", "0")
+	assert.NoError(t, err)
+	assert.Equal(t, byName.UID, byID.UID)
+
+	_, err = core.ResolveIdentity("giogo-nonexistent-user", "")
+	assert.Error(t, err)
+
+	_, err = core.ResolveIdentity("root", "giogo-nonexistent-group")
+	assert.Error(t, err)
+}
+
+func TestSudoIdentity(t *testing.T) {
+	t.Setenv("SUDO_UID", "")
+	_, err := core.SudoIdentity()
+	assert.Error(t, err)
+
+	t.Setenv("SUDO_UID", "0")
+	t.Setenv("SUDO_GID", "1234")
+	identity, err := core.SudoIdentity()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0), identity.UID)
+	assert.Equal(t, uint32(1234), identity.GID)
+}
+
+func TestIdentityEnviron(t *testing.T) {
+	identity := &core.Identity{Username: "alice", Home: "/home/alice", UID: 1000, GID: 1000}
+	env := identity.Environ([]string{
+		"HOME=/root",
+		"USER=root",
+		"SUDO_USER=alice",
+		"LD_PRELOAD=/tmp/inject.so",
+		"XDG_RUNTIME_DIR=/run/user/0",
+		"MAIL=/var/mail/root",
+		"PATH=/usr/bin:.:bin::/bin",
+		"TERM=xterm",
+		"LC_ALL=C.UTF-8",
+	})
+
+	assert.ElementsMatch(t, []string{
+		"PATH=/usr/bin:/bin",
+		"TERM=xterm",
+		"LC_ALL=C.UTF-8",
+		"HOME=/home/alice",
+		"USER=alice",
+		"LOGNAME=alice",
+	}, env)
+}
+
+// TestRunCommand_Identity tests that the command runs with the requested credentials
+func TestRunCommand_Identity(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing credentials requires root")
+	}
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("AddProcess", mock.AnythingOfType("int")).Return(nil)
+	mockManager.On("Delete").Return(nil)
+
+	identity, err := core.ResolveIdentity("nobody", "")
+	if err != nil {
+		t.Skipf("user nobody not available: %v", err)
+	}
+	// The file must be reachable by the unprivileged user
+	output, err := os.CreateTemp("", "giogo-identity")
+	assert.NoError(t, err)
+	defer os.Remove(output.Name())
+	assert.NoError(t, output.Chmod(0666))
+
+	core := &core.Core{
+		CgroupManager: mockManager,
+		Identity:      identity,
+	}
+	err = core.RunCommand([]string{"sh", "-c", "id -u > " + output.Name() + " && grep NoNewPrivs /proc/self/status >> " + output.Name()})
+	assert.NoError(t, err)
+
+	content, err := os.ReadFile(output.Name())
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	assert.Equal(t, "65534", lines[0])
+	assert.Contains(t, lines[1], "1")
+}
+
+// TestRunCommand_IdentityPath tests that the command is looked up in the sanitized PATH
+func TestRunCommand_IdentityPath(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing credentials requires root")
+	}
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("AddProcess", mock.AnythingOfType("int")).Return(nil)
+	mockManager.On("Delete").Return(nil)
+
+	identity, err := core.ResolveIdentity("nobody", "")
+	if err != nil {
+		t.Skipf("user nobody not available: %v", err)
+	}
+	// A command only found through a relative PATH entry of giogo
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "bin"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "bin", "giogo-relative"), []byte("#!/bin/sh\n"), 0755))
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+	t.Setenv("PATH", "bin:"+os.Getenv("PATH"))
+
+	core := &core.Core{
+		CgroupManager: mockManager,
+		Identity:      identity,
+	}
+	err = core.RunCommand([]string{"giogo-relative"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "executable file not found")
+}
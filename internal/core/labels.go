@@ -0,0 +1,110 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Label is a key=value metadata attached to a run
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Label names follow the Prometheus rules so they can be exported as metric labels
+var labelNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ParseLabels parses values in the form key=value, keys must be unique
+func ParseLabels(values []string) ([]Label, error) {
+	var labels []Label
+	seen := make(map[string]bool)
+	for _, value := range values {
+		name, labelValue, found := strings.Cut(value, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", value)
+		}
+		if !labelNameRegex.MatchString(name) {
+			return nil, fmt.Errorf("invalid label name %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate label %q", name)
+		}
+		seen[name] = true
+		labels = append(labels, Label{Name: name, Value: labelValue})
+	}
+	return labels, nil
+}
+
+// labelXattrPrefix prefixes the extended attributes holding the labels on the cgroup directory.
+// User attributes can be read without privileges, so any user can select the groups by label.
+const labelXattrPrefix = "user.giogo.label."
+
+// LabelMap returns the labels by name, nil when there is none
+func LabelMap(labels []Label) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(labels))
+	for _, label := range labels {
+		m[label.Name] = label.Value
+	}
+	return m
+}
+
+// MatchLabels tells whether every label of the selector is among the labels, with the same value
+func MatchLabels(labels, selector []Label) bool {
+	m := LabelMap(labels)
+	for _, s := range selector {
+		if value, ok := m[s.Name]; !ok || value != s.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteLabels stores the labels as extended attributes of the cgroup directory, cgroup v2 supports them since Linux 5.7
+func WriteLabels(dir string, labels []Label) error {
+	for _, label := range labels {
+		if err := unix.Setxattr(dir, labelXattrPrefix+label.Name, []byte(label.Value), 0); err != nil {
+			return fmt.Errorf("error storing label %s on %s: %v", label.Name, dir, err)
+		}
+	}
+	return nil
+}
+
+// ReadLabels reads the labels stored on a cgroup directory by WriteLabels, sorted by name
+func ReadLabels(dir string) ([]Label, error) {
+	size, err := unix.Listxattr(dir, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	names := make([]byte, size)
+	if size, err = unix.Listxattr(dir, names); err != nil {
+		return nil, err
+	}
+	var labels []Label
+	for _, attr := range strings.Split(string(names[:size]), "\x00") {
+		name, found := strings.CutPrefix(attr, labelXattrPrefix)
+		if !found {
+			continue
+		}
+		value := make([]byte, 256)
+		n, err := unix.Getxattr(dir, attr, value)
+		if err == unix.ERANGE {
+			if n, err = unix.Getxattr(dir, attr, nil); err == nil {
+				value = make([]byte, n)
+				n, err = unix.Getxattr(dir, attr, value)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading label %s of %s: %v", name, dir, err)
+		}
+		labels = append(labels, Label{Name: name, Value: string(value[:n])})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	return labels, nil
+}
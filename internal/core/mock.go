@@ -1,6 +1,7 @@
 package core
 
 import (
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -18,3 +19,38 @@ func (m *MockCgroupManager) Delete() error {
 	args := m.Called()
 	return args.Error(0)
 }
+
+func (m *MockCgroupManager) Procs() ([]int, error) {
+	args := m.Called()
+	return args.Get(0).([]int), args.Error(1)
+}
+
+func (m *MockCgroupManager) Kill() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *MockCgroupManager) Freeze() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *MockCgroupManager) Thaw() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *MockCgroupManager) Update(resources specs.LinuxResources) error {
+	args := m.Called(resources)
+	return args.Error(0)
+}
+
+func (m *MockCgroupManager) Path() string {
+	args := m.Called()
+	return args.String(0)
+}
+
+func (m *MockCgroupManager) Stats() (*Stats, error) {
+	args := m.Called()
+	return args.Get(0).(*Stats), args.Error(1)
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// ProcessLimiter sets limits that are bound to a single process rather than to the cgroup
+type ProcessLimiter interface {
+	ApplyProcess(attr *ProcessAttr)
+}
+
+// Rlimit is a per-process resource limit, see setrlimit(2)
+type Rlimit struct {
+	Name       string
+	Resource   int
+	Soft, Hard uint64
+}
+
+// ProcessAttr holds the settings applied to the command before it is executed.
+// The nice value and IO priority are per thread and the rlimits shape the image built by exec, so none of them
+// can be applied to an already started process without letting it, and anything it forks, run without them.
+type ProcessAttr struct {
+	Rlimits     []Rlimit `json:",omitempty"`
+	Nice        *int     `json:",omitempty"`
+	IOPrio      *int     `json:",omitempty"`
+	OOMScoreAdj *int     `json:",omitempty"`
+	// Credential, when set, is dropped to once every other setting is applied, along with no_new_privs
+	Credential *syscall.Credential `json:",omitempty"`
+}
+
+// ExecShimArg is the first argument giogo is re-executed with to start a command with a ProcessAttr
+const ExecShimArg = "__giogo-exec"
+
+// execShimStatusFd is where the exec shim reports why the command could not be executed.
+// It is closed on exec, so the parent reads EOF once the command runs.
+const execShimStatusFd = 3
+
+// execShimResumeFd is where the exec shim waits for the parent to add it to the cgroup.
+// The parent writes a byte once it did, and closes the pipe without writing when it failed.
+const execShimResumeFd = 4
+
+const ioprioWhoProcess = 1
+
+// ExecShim runs the exec shim when giogo was re-executed as one and returns immediately otherwise.
+// It must be called before anything else in main, the shim never returns.
+func ExecShim() {
+	if len(os.Args) < 4 || os.Args[1] != ExecShimArg {
+		return
+	}
+	// The nice value, IO priority and no_new_privs are set on the thread that calls execve
+	runtime.LockOSThread()
+
+	status := os.NewFile(execShimStatusFd, "status")
+	unix.CloseOnExec(execShimStatusFd)
+	// Nothing is executed before the shim joined the cgroup, or the command could fork outside of it
+	resume := os.NewFile(execShimResumeFd, "resume")
+	if _, err := io.ReadFull(resume, make([]byte, 1)); err != nil {
+		os.Exit(127)
+	}
+	resume.Close()
+	if err := execWithAttr(os.Args[2], os.Args[3:]); err != nil {
+		fmt.Fprint(status, err.Error())
+		os.Exit(127)
+	}
+}
+
+func execWithAttr(encodedAttr string, args []string) error {
+	var attr ProcessAttr
+	if err := json.Unmarshal([]byte(encodedAttr), &attr); err != nil {
+		return fmt.Errorf("invalid process attributes: %v", err)
+	}
+	// The command is looked up in the environment given to the shim, with the sanitized PATH of an identity
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return fmt.Errorf("error starting command: %v", err)
+	}
+
+	if attr.Nice != nil {
+		if err := unix.Setpriority(unix.PRIO_PROCESS, 0, *attr.Nice); err != nil {
+			return fmt.Errorf("error setting nice value: %v", err)
+		}
+	}
+	if attr.IOPrio != nil {
+		if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, 0, uintptr(*attr.IOPrio)); errno != 0 {
+			return fmt.Errorf("error setting IO priority: %v", errno)
+		}
+	}
+	if attr.OOMScoreAdj != nil {
+		if err := os.WriteFile("/proc/self/oom_score_adj", []byte(strconv.Itoa(*attr.OOMScoreAdj)), 0644); err != nil {
+			return fmt.Errorf("error setting OOM score adjustment: %v", err)
+		}
+	}
+	for _, rlimit := range attr.Rlimits {
+		// syscall.Setrlimit keeps the runtime from restoring its own RLIMIT_NOFILE on exec
+		if err := syscall.Setrlimit(rlimit.Resource, &syscall.Rlimit{Cur: rlimit.Soft, Max: rlimit.Hard}); err != nil {
+			return fmt.Errorf("error setting RLIMIT_%s: %v", rlimit.Name, err)
+		}
+	}
+	if cred := attr.Credential; cred != nil {
+		groups := make([]int, len(cred.Groups))
+		for i, g := range cred.Groups {
+			groups[i] = int(g)
+		}
+		if err := syscall.Setgroups(groups); err != nil {
+			return fmt.Errorf("error setting groups: %v", err)
+		}
+		if err := syscall.Setgid(int(cred.Gid)); err != nil {
+			return fmt.Errorf("error setting gid: %v", err)
+		}
+		if err := syscall.Setuid(int(cred.Uid)); err != nil {
+			return fmt.Errorf("error setting uid: %v", err)
+		}
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("error setting no_new_privs: %v", err)
+		}
+	}
+
+	if err := syscall.Exec(path, args, os.Environ()); err != nil {
+		return fmt.Errorf("error starting command: %v", err)
+	}
+	return nil
+}
+
+// execShimCommand returns the command re-executing giogo as the exec shim of args, the read end of the pipe
+// the shim reports its errors to and the write end of the pipe resuming it, see resumeExecShim.
+// The other ends are the extra files of the command, to close once it started.
+func execShimCommand(args []string, attr *ProcessAttr) (*exec.Cmd, *os.File, *os.File, error) {
+	encodedAttr, err := json.Marshal(attr)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	statusR, statusW, err := os.Pipe()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	resumeR, resumeW, err := os.Pipe()
+	if err != nil {
+		statusR.Close()
+		statusW.Close()
+		return nil, nil, nil, err
+	}
+	cmd := exec.Command("/proc/self/exe", append([]string{ExecShimArg, string(encodedAttr)}, args...)...)
+	cmd.Args[0] = args[0]
+	cmd.ExtraFiles = []*os.File{statusW, resumeR}
+	return cmd, statusR, resumeW, nil
+}
+
+// resumeExecShim lets the exec shim execute the command, once it was added to the cgroup
+func resumeExecShim(resume *os.File) error {
+	_, err := resume.Write([]byte{0})
+	if closeErr := resume.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// waitExecShim returns the error reported by the exec shim, nil once the command was executed
+func waitExecShim(status io.Reader) error {
+	message, err := io.ReadAll(status)
+	if err != nil {
+		return err
+	}
+	if len(message) > 0 {
+		return errors.New(string(message))
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package core
+
+import (
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// Result describes a finished run, as seen by the reporters
+type Result struct {
+	Name      string
+	Command   []string
+	Resources specs.LinuxResources
+	Start     time.Time
+	WallTime  time.Duration
+	// ExitCode is -1 when the command did not start or was killed by a signal
+	ExitCode int
+	// Err is the error the run ended with, if any
+	Err error
+	// Stats is the final usage of the cgroup, nil when it could not be read
+	Stats *Stats
+	// Snapshots are the diagnostic directories written by the watchers during the run
+	Snapshots []string
+}
+
+// Reporter receives the result of the run right before the cgroup is deleted.
+// A reporter error fails the run when the command itself succeeded, and is the Err of the result given to the next reporters.
+type Reporter interface {
+	Report(result *Result) error
+}
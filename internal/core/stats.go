@@ -0,0 +1,147 @@
+package core
+
+// Stats is a normalized snapshot of the cgroup usage, shared by the cgroup v1 and v2 managers.
+// Times are expressed in microseconds, as in the cgroup v2 interface files.
+// Limits are math.MaxUint64 when unlimited.
+type Stats struct {
+	CPU    CPUStats    `json:"cpu"`
+	Memory MemoryStats `json:"memory"`
+	IO     []IOStats   `json:"io"`
+	Pids   PidsStats   `json:"pids"`
+	PSI    PSIStats    `json:"psi"`
+	// Processes is only set when the processes of the group are tracked
+	Processes []ProcessStats `json:"processes,omitempty"`
+	// Labels are the labels of the run, see --label
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// CPUStats holds the CPU usage of the cgroup (cpu.stat)
+type CPUStats struct {
+	UsageUsec        uint64 `json:"usage_usec"`
+	UserUsec         uint64 `json:"user_usec"`
+	SystemUsec       uint64 `json:"system_usec"`
+	Periods          uint64 `json:"nr_periods"`
+	ThrottledPeriods uint64 `json:"nr_throttled"`
+	ThrottledUsec    uint64 `json:"throttled_usec"`
+}
+
+// IOStats holds the IO usage of the cgroup on a single block device (io.stat)
+type IOStats struct {
+	// Device is the name of the block device (e.g., sda), only set when the IO of the group is tracked
+	Device string `json:"device,omitempty"`
+	Major  int64  `json:"major"`
+	Minor  int64  `json:"minor"`
+	RBytes uint64 `json:"rbytes"`
+	WBytes uint64 `json:"wbytes"`
+	RIOs   uint64 `json:"rios"`
+	WIOs   uint64 `json:"wios"`
+	// DBytes and DIOs count the discards, only available with cgroup v2
+	DBytes uint64 `json:"dbytes"`
+	DIOs   uint64 `json:"dios"`
+	// RBpsMax and WBpsMax are the throttles of io.max in bytes per second, 0 when unlimited
+	RBpsMax uint64 `json:"rbps_max,omitempty"`
+	WBpsMax uint64 `json:"wbps_max,omitempty"`
+	// Rates is only set when the IO of the group is tracked
+	Rates *IORateStats `json:"rates,omitempty"`
+}
+
+// IORateStats holds the bandwidths the cgroup achieved on a block device, in bytes per second
+type IORateStats struct {
+	// Read and Write are the bandwidths over the latest interval, PeakRead and PeakWrite the highest ones
+	Read      float64 `json:"read"`
+	Write     float64 `json:"write"`
+	PeakRead  float64 `json:"peak_read"`
+	PeakWrite float64 `json:"peak_write"`
+	// ReadSaturatedUsec and WriteSaturatedUsec add up the intervals the bandwidth was close to its throttle
+	ReadSaturatedUsec  uint64 `json:"read_saturated_usec"`
+	WriteSaturatedUsec uint64 `json:"write_saturated_usec"`
+}
+
+// MemoryStats holds the memory usage of the cgroup
+type MemoryStats struct {
+	Current uint64 `json:"current"`
+	Peak    uint64 `json:"peak"`
+	Limit   uint64 `json:"limit"`
+	// File is the page cache charged to the group (file in memory.stat), the kernel reclaims it under pressure
+	File   uint64            `json:"file"`
+	Events MemoryEventsStats `json:"events"`
+	// WorkingSet is only set when the working set is estimated
+	WorkingSet *WorkingSetStats `json:"working_set,omitempty"`
+}
+
+// WorkingSetStats is the working set of the cgroup as estimated by proactive reclaim (memory.reclaim)
+type WorkingSetStats struct {
+	// Current is the latest estimate and Peak the highest one, in bytes
+	Current uint64 `json:"current"`
+	Peak    uint64 `json:"peak"`
+	// Reclaimed is the memory proactive reclaim freed, Refaults the pages read back in since the estimation started
+	Reclaimed uint64 `json:"reclaimed"`
+	Refaults  uint64 `json:"refaults"`
+	// Converged tells that reclaim reached the working set, until then the estimate is an upper bound
+	Converged bool `json:"converged"`
+}
+
+// MemoryEventsStats holds the memory event counters of the cgroup (memory.events)
+type MemoryEventsStats struct {
+	Low     uint64 `json:"low"`
+	High    uint64 `json:"high"`
+	Max     uint64 `json:"max"`
+	OOM     uint64 `json:"oom"`
+	OOMKill uint64 `json:"oom_kill"`
+}
+
+// PidsStats holds the number of tasks in the cgroup
+type PidsStats struct {
+	Current uint64 `json:"current"`
+	Peak    uint64 `json:"peak"`
+	Limit   uint64 `json:"limit"`
+}
+
+// PSIStats holds the pressure stall information of the cgroup (cpu.pressure, memory.pressure, io.pressure).
+// It is only available with cgroup v2.
+type PSIStats struct {
+	CPU    PressureStats `json:"cpu"`
+	Memory PressureStats `json:"memory"`
+	IO     PressureStats `json:"io"`
+}
+
+// PressureStats holds the share of time some or all tasks were stalled on a resource
+type PressureStats struct {
+	Some PressureData `json:"some"`
+	Full PressureData `json:"full"`
+}
+
+// PressureData holds the stall averages, in percent, and the total stall time
+type PressureData struct {
+	Avg10     float64 `json:"avg10"`
+	Avg60     float64 `json:"avg60"`
+	Avg300    float64 `json:"avg300"`
+	TotalUsec uint64  `json:"total_usec"`
+}
+
+// ProcessStats holds the identity and usage of a process of the cgroup, from /proc/<pid>
+type ProcessStats struct {
+	PID     int      `json:"pid"`
+	PPID    int      `json:"ppid"`
+	Comm    string   `json:"comm"`
+	Cmdline []string `json:"cmdline"`
+	Threads int      `json:"threads"`
+	// CPUUsec is the user and system CPU time of the process
+	CPUUsec uint64 `json:"cpu_usec"`
+	// Rss, Pss and Swap are in bytes, from /proc/<pid>/smaps_rollup
+	Rss  uint64 `json:"rss"`
+	Pss  uint64 `json:"pss"`
+	Swap uint64 `json:"swap"`
+	// ReadBytes and WriteBytes are the bytes read from and written to storage, from /proc/<pid>/io
+	ReadBytes  uint64 `json:"read_bytes"`
+	WriteBytes uint64 `json:"write_bytes"`
+}
+
+// IOTotals returns the bytes read and written on all the devices
+func IOTotals(devices []IOStats) (read, write uint64) {
+	for _, device := range devices {
+		read += device.RBytes
+		write += device.WBytes
+	}
+	return read, write
+}
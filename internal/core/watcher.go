@@ -0,0 +1,89 @@
+package core
+
+import (
+	"context"
+	"syscall"
+	"time"
+)
+
+// Watcher observes the cgroup while the command runs.
+// Watch must return once ctx is done; a non-nil error ends the run with that error.
+// Only enforcing watchers, such as budgets, return errors: an informative watcher that cannot do its job, e.g. without
+// cgroup v2 or an output file, prints why to stderr and returns nil so that the command keeps running.
+type Watcher interface {
+	Watch(ctx context.Context, manager CgroupManager) error
+}
+
+// SnapshotTaker is a watcher that writes diagnostic snapshots while the command runs.
+// Snapshots is called once every watcher returned, the directories end up in the result of the run.
+type SnapshotTaker interface {
+	Snapshots() []string
+}
+
+// StatsAnnotator is a watcher that derives figures the cgroup files do not hold, such as an estimated working set.
+// Annotate completes every Stats read through the manager while the command runs, and the final stats of the run.
+type StatsAnnotator interface {
+	Annotate(stats *Stats)
+}
+
+// annotatedManager is a CgroupManager whose stats are completed by the annotators
+type annotatedManager struct {
+	CgroupManager
+	annotators []StatsAnnotator
+}
+
+func (m *annotatedManager) Stats() (*Stats, error) {
+	stats, err := m.CgroupManager.Stats()
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range m.annotators {
+		a.Annotate(stats)
+	}
+	return stats, nil
+}
+
+// labelAnnotator sets the labels of the run in the stats
+type labelAnnotator map[string]string
+
+func (l labelAnnotator) Annotate(stats *Stats) {
+	stats.Labels = l
+}
+
+// terminatePollInterval is how often TerminateGroup checks whether the group is empty during the grace period
+const terminatePollInterval = 100 * time.Millisecond
+
+// TerminateGroup ends every process in the cgroup.
+// When graceSignal is set it is sent first, and the processes get up to gracePeriod to exit before being killed.
+func TerminateGroup(manager CgroupManager, graceSignal syscall.Signal, gracePeriod time.Duration) error {
+	if graceSignal != 0 {
+		if err := SignalGroup(manager, graceSignal); err != nil {
+			return err
+		}
+		deadline := time.Now().Add(gracePeriod)
+		for time.Now().Before(deadline) {
+			pids, err := manager.Procs()
+			if err != nil {
+				return err
+			}
+			if len(pids) == 0 {
+				return nil
+			}
+			time.Sleep(terminatePollInterval)
+		}
+	}
+	return manager.Kill()
+}
+
+// SignalGroup sends sig to every process in the cgroup
+func SignalGroup(manager CgroupManager, sig syscall.Signal) error {
+	pids, err := manager.Procs()
+	if err != nil {
+		return err
+	}
+	for _, pid := range pids {
+		// The process may have exited in the meantime
+		syscall.Kill(pid, sig)
+	}
+	return nil
+}
@@ -9,6 +9,16 @@ import (
 
 type Executor struct {
 	Limiters []limiter.ResourceLimiter
+	// Identity, when set, is the user the command runs as after the cgroup setup
+	Identity *core.Identity
+	// Watchers observe the cgroup while the command runs, in addition to the limiters that watch it
+	Watchers []core.Watcher
+	// Reporters receive the final usage of the cgroup before it is deleted
+	Reporters []core.Reporter
+	// Name, when set, is the name of the cgroup instead of the one derived from the pid of giogo
+	Name string
+	// Labels are stored on the cgroup and set in its stats
+	Labels []core.Label
 }
 
 func NewExecutor(limiters []limiter.ResourceLimiter) *Executor {
@@ -19,13 +29,32 @@ func NewExecutor(limiters []limiter.ResourceLimiter) *Executor {
 
 func (e *Executor) RunCommand(args []string) error {
 	var resources specs.LinuxResources
+	var processLimiters []core.ProcessLimiter
+	watchers := append([]core.Watcher{}, e.Watchers...)
 	for _, l := range e.Limiters {
 		l.Apply(&resources)
+		if pl, ok := l.(core.ProcessLimiter); ok {
+			processLimiters = append(processLimiters, pl)
+		}
+		if w, ok := l.(core.Watcher); ok {
+			watchers = append(watchers, w)
+		}
 	}
 
-	coreModule, err := core.NewCore(resources)
+	var coreModule *core.Core
+	var err error
+	if e.Name != "" {
+		coreModule, err = core.NewNamedCore(e.Name, resources)
+	} else {
+		coreModule, err = core.NewCore(resources)
+	}
 	if err != nil {
 		return err
 	}
+	coreModule.ProcessLimiters = processLimiters
+	coreModule.Identity = e.Identity
+	coreModule.Watchers = watchers
+	coreModule.Reporters = e.Reporters
+	coreModule.Labels = e.Labels
 	return coreModule.RunCommand(args)
 }
@@ -0,0 +1,240 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pmarchini/giogo/internal/assertion"
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/limiter"
+	"golang.org/x/sys/unix"
+)
+
+// DefaultPath is the history store of the machine
+const DefaultPath = "/var/lib/giogo/history.jsonl"
+
+// Exit reasons of a run
+const (
+	ReasonSuccess        = "success"
+	ReasonFailure        = "failure"
+	ReasonOOMKilled      = "oom_killed"
+	ReasonBudgetExceeded = "budget_exceeded"
+	// ReasonAssertionFailed is a command that succeeded but failed its resource assertions
+	ReasonAssertionFailed = "assertion_failed"
+	// ReasonKilled is a command killed by a signal, or that did not start
+	ReasonKilled = "killed"
+)
+
+// Run is a finished run as kept in the history, one JSON document per line
+type Run struct {
+	Name    string   `json:"name"`
+	Command []string `json:"command"`
+	// User is the user who started giogo, the one behind sudo when run through it
+	User   string            `json:"user"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// Resources are the limits applied to the cgroup
+	Resources    specs.LinuxResources `json:"resources"`
+	Start        time.Time            `json:"start"`
+	WallTimeUsec uint64               `json:"wall_time_usec"`
+	ExitCode     int                  `json:"exit_code"`
+	ExitReason   string               `json:"exit_reason"`
+	Error        string               `json:"error,omitempty"`
+	Stats        *core.Stats          `json:"stats,omitempty"`
+}
+
+// NewRun creates the history entry of a run
+func NewRun(result *core.Result, userName string, labels []core.Label) *Run {
+	run := &Run{
+		Name:         result.Name,
+		Command:      result.Command,
+		User:         userName,
+		Resources:    result.Resources,
+		Start:        result.Start,
+		WallTimeUsec: uint64(result.WallTime.Microseconds()),
+		ExitCode:     result.ExitCode,
+		ExitReason:   exitReason(result),
+		Stats:        result.Stats,
+		Labels:       core.LabelMap(labels),
+	}
+	if result.Err != nil {
+		run.Error = result.Err.Error()
+	}
+	return run
+}
+
+// exitReason tells why the command stopped
+func exitReason(result *core.Result) string {
+	var cpuBudget *limiter.CPUTimeBudgetError
+	var ioBudget *limiter.IOBudgetError
+	var assertionErr *assertion.AssertionError
+	switch {
+	case result.Err == nil && result.ExitCode == 0:
+		return ReasonSuccess
+	case errors.As(result.Err, &assertionErr):
+		return ReasonAssertionFailed
+	case errors.As(result.Err, &cpuBudget) || errors.As(result.Err, &ioBudget):
+		return ReasonBudgetExceeded
+	case result.Stats != nil && result.Stats.Memory.Events.OOMKill > 0:
+		return ReasonOOMKilled
+	case result.ExitCode < 0:
+		return ReasonKilled
+	}
+	return ReasonFailure
+}
+
+// CurrentUser returns the name of the user running giogo, the one who ran sudo when giogo runs through it
+func CurrentUser() string {
+	if name := os.Getenv("SUDO_USER"); name != "" {
+		return name
+	}
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return fmt.Sprint(os.Getuid())
+}
+
+// Append adds a run at the end of the history at path, creating it if needed.
+// The file is locked so that concurrent runs do not interleave their lines.
+func Append(path string, run *Run) error {
+	line, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Read reads the runs of a history, in the order they finished
+func Read(r io.Reader) ([]Run, error) {
+	var runs []Run
+	scanner := bufio.NewScanner(r)
+	// A line holds the final stats, which grow with the devices and processes of the run
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var run Run
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, scanner.Err()
+}
+
+// ReadFile reads the history at path, a missing history has no runs
+func ReadFile(path string) ([]Run, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	runs, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading history %s: %v", path, err)
+	}
+	return runs, nil
+}
+
+// Filter selects runs, its zero value selects them all
+type Filter struct {
+	// Since and Until bound the start of the runs
+	Since, Until time.Time
+	// Labels must all be set on the run with the same value
+	Labels []core.Label
+	User   string
+	// Command is a substring of the command line
+	Command string
+	Reason  string
+}
+
+// Match tells whether the run is selected
+func (f Filter) Match(run *Run) bool {
+	if !f.Since.IsZero() && run.Start.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !run.Start.Before(f.Until) {
+		return false
+	}
+	for _, label := range f.Labels {
+		if value, ok := run.Labels[label.Name]; !ok || value != label.Value {
+			return false
+		}
+	}
+	if f.User != "" && run.User != f.User {
+		return false
+	}
+	if f.Command != "" && !strings.Contains(strings.Join(run.Command, " "), f.Command) {
+		return false
+	}
+	return f.Reason == "" || run.ExitReason == f.Reason
+}
+
+// Select returns the runs matched by the filter, sorted by start time
+func Select(runs []Run, filter Filter) []Run {
+	var selected []Run
+	for i := range runs {
+		if filter.Match(&runs[i]) {
+			selected = append(selected, runs[i])
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool { return selected[i].Start.Before(selected[j].Start) })
+	return selected
+}
+
+// ParseTime parses a point in time given as a date (2006-01-02), an RFC 3339 time, or a duration before now (e.g., 720h)
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected a date (2006-01-02), an RFC 3339 time or a duration (e.g., 24h)", value)
+}
+
+// Reporter records every run in the history at Path
+type Reporter struct {
+	Path   string
+	User   string
+	Labels []core.Label
+}
+
+// Report appends the run to the history
+func (r *Reporter) Report(result *core.Result) error {
+	if err := Append(r.Path, NewRun(result, r.User, r.Labels)); err != nil {
+		return fmt.Errorf("error recording the run in history %s: %v", r.Path, err)
+	}
+	return nil
+}
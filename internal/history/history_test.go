@@ -0,0 +1,196 @@
+package history_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/assertion"
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/history"
+	"github.com/pmarchini/giogo/internal/limiter"
+)
+
+func TestNewRun_ExitReason(t *testing.T) {
+	for _, test := range []struct {
+		result *core.Result
+		reason string
+	}{
+		{&core.Result{}, history.ReasonSuccess},
+		{&core.Result{ExitCode: 2, Err: fmt.Errorf("exit status 2")}, history.ReasonFailure},
+		{&core.Result{ExitCode: -1, Err: &limiter.CPUTimeBudgetError{}}, history.ReasonBudgetExceeded},
+		{&core.Result{ExitCode: -1, Err: fmt.Errorf("signal: killed"), Stats: &core.Stats{Memory: core.MemoryStats{Events: core.MemoryEventsStats{OOMKill: 1}}}}, history.ReasonOOMKilled},
+		{&core.Result{ExitCode: -1, Err: fmt.Errorf("signal: terminated")}, history.ReasonKilled},
+		{&core.Result{Err: &assertion.AssertionError{Failed: 1, Total: 2}}, history.ReasonAssertionFailed},
+	} {
+		if reason := history.NewRun(test.result, "ci", nil).ExitReason; reason != test.reason {
+			t.Errorf("expected %s for %+v, got %s", test.reason, test.result, reason)
+		}
+	}
+}
+
+func TestAppendAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "giogo", "history.jsonl")
+	runs, err := history.ReadFile(path)
+	if err != nil || runs != nil {
+		t.Fatalf("expected a missing history to have no runs, got %v (%v)", runs, err)
+	}
+
+	reporter := &history.Reporter{Path: path, User: "ci", Labels: []core.Label{{Name: "team", Value: "infra"}}}
+	start := time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		err := reporter.Report(&core.Result{
+			Name:     fmt.Sprintf("giogo-cgroup-%d", i),
+			Command:  []string{"make", "nightly"},
+			Start:    start.Add(time.Duration(i) * time.Hour),
+			WallTime: time.Minute,
+			Stats:    &core.Stats{CPU: core.CPUStats{UsageUsec: 1000000}},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	runs, err = history.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 runs, got %d", len(runs))
+	}
+	run := runs[1]
+	if run.Name != "giogo-cgroup-1" || run.User != "ci" || run.Labels["team"] != "infra" || run.WallTimeUsec != 60000000 ||
+		run.ExitReason != history.ReasonSuccess || run.Stats.CPU.UsageUsec != 1000000 || !run.Start.Equal(start.Add(time.Hour)) {
+		t.Errorf("unexpected run %+v", run)
+	}
+
+	if err := os.WriteFile(path, []byte("{not json\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := history.ReadFile(path); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("expected an error pointing at the invalid line, got %v", err)
+	}
+}
+
+func testRuns() []history.Run {
+	day := time.Date(2024, 3, 4, 12, 0, 0, 0, time.Local)
+	run := func(start time.Time, team, reason string, cpuSeconds, memoryMiB uint64) history.Run {
+		r := history.Run{
+			Command:    []string{"/usr/bin/make", "nightly"},
+			User:       "ci",
+			Start:      start,
+			ExitReason: reason,
+			Stats: &core.Stats{
+				CPU:    core.CPUStats{UsageUsec: cpuSeconds * 1000000},
+				Memory: core.MemoryStats{Peak: memoryMiB * 1024 * 1024},
+				IO:     []core.IOStats{{RBytes: 100, WBytes: 10}, {RBytes: 1}},
+			},
+		}
+		if team != "" {
+			r.Labels = map[string]string{"team": team, "job": "nightly"}
+		}
+		return r
+	}
+	return []history.Run{
+		run(day.AddDate(0, -1, 0), "infra", history.ReasonSuccess, 10, 100),
+		run(day, "infra", history.ReasonSuccess, 20, 200),
+		run(day.Add(time.Hour), "infra", history.ReasonOOMKilled, 40, 400),
+		run(day.AddDate(0, 0, 1), "web", history.ReasonSuccess, 5, 50),
+		run(day, "", history.ReasonSuccess, 1, 1),
+	}
+}
+
+func TestSelect(t *testing.T) {
+	runs := testRuns()
+	since := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)
+	selected := history.Select(runs, history.Filter{Since: since, Labels: []core.Label{{Name: "team", Value: "infra"}}, Command: "make night"})
+	if len(selected) != 2 || selected[0].Stats.CPU.UsageUsec != 20000000 || selected[1].Stats.CPU.UsageUsec != 40000000 {
+		t.Errorf("unexpected selection %+v", selected)
+	}
+	if selected := history.Select(runs, history.Filter{Reason: history.ReasonOOMKilled}); len(selected) != 1 {
+		t.Errorf("expected 1 OOM killed run, got %d", len(selected))
+	}
+	if selected := history.Select(runs, history.Filter{Until: since, User: "ci"}); len(selected) != 1 {
+		t.Errorf("expected 1 run before March, got %d", len(selected))
+	}
+	if selected := history.Select(runs, history.Filter{User: "root"}); len(selected) != 0 {
+		t.Errorf("expected no run of root, got %d", len(selected))
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+	for value, expected := range map[string]time.Time{
+		"24h":                  now.Add(-24 * time.Hour),
+		"2024-03-01":           time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local),
+		"2024-03-01T10:00:00Z": time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+	} {
+		parsed, err := history.ParseTime(value, now)
+		if err != nil || !parsed.Equal(expected) {
+			t.Errorf("ParseTime(%q) = %v (%v), expected %v", value, parsed, err, expected)
+		}
+	}
+	if _, err := history.ParseTime("last month", now); err == nil {
+		t.Errorf("expected an error for an unparsable time")
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	by, err := history.ParseGroupBy("label:team")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	usages := history.Aggregate(testRuns(), by, history.WindowMonth)
+	if len(usages) != 4 {
+		t.Fatalf("expected 4 groups, got %+v", usages)
+	}
+	march := usages[2]
+	if march.Window != "2024-03" || march.Group != "infra" || march.Runs != 2 || march.Failures != 1 ||
+		march.CPUUsec != 60000000 || march.ReadBytes != 202 || march.WriteBytes != 20 ||
+		march.CPU.P50 != 30000000 || march.MemoryPeak.Max != 400*1024*1024 {
+		t.Errorf("unexpected usage of infra in March %+v", march)
+	}
+	if usages[0].Window != "2024-02" || usages[1].Group != "(none)" || usages[3].Group != "web" {
+		t.Errorf("unexpected order %+v", usages)
+	}
+
+	// Grouping by label counts a run in every one of its labels
+	by, _ = history.ParseGroupBy("label")
+	usages = history.Aggregate(testRuns(), by, history.WindowAll)
+	var groups []string
+	for _, usage := range usages {
+		groups = append(groups, fmt.Sprintf("%s:%d", usage.Group, usage.Runs))
+	}
+	if strings.Join(groups, " ") != "(none):1 job=nightly:4 team=infra:3 team=web:1" {
+		t.Errorf("unexpected groups %v", groups)
+	}
+
+	by, _ = history.ParseGroupBy("command")
+	usages = history.Aggregate(testRuns(), by, history.WindowDay)
+	if len(usages) != 3 || usages[1].Group != "make" || usages[1].Window != "2024-03-04" || usages[1].Runs != 3 {
+		t.Errorf("unexpected daily usage by command %+v", usages)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := history.WriteUsageText(buf, usages); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 4 || !strings.HasPrefix(lines[0], "WINDOW") {
+		t.Errorf("unexpected table:\n%s", buf.String())
+	}
+}
+
+func TestParseGroupByAndWindow(t *testing.T) {
+	for _, value := range []string{"label:", "labels", "user:name", ""} {
+		if _, err := history.ParseGroupBy(value); err == nil {
+			t.Errorf("expected an error for grouping %q", value)
+		}
+	}
+	if _, err := history.ParseWindow("year"); err == nil {
+		t.Errorf("expected an error for an unsupported window")
+	}
+}
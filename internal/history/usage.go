@@ -0,0 +1,226 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/bench"
+	"github.com/pmarchini/giogo/internal/utils"
+)
+
+// GroupBy is how runs are grouped in a usage report
+type GroupBy struct {
+	// Kind is one of label, user or command
+	Kind string
+	// Label, when set, groups by the value of this label only
+	Label string
+}
+
+// ParseGroupBy parses label (every name=value pair), label:NAME (the values of a label), user or command
+func ParseGroupBy(value string) (GroupBy, error) {
+	kind, label, hasLabel := strings.Cut(value, ":")
+	switch {
+	case kind == "label" && (!hasLabel || label != ""):
+		return GroupBy{Kind: kind, Label: label}, nil
+	case (kind == "user" || kind == "command") && !hasLabel:
+		return GroupBy{Kind: kind}, nil
+	}
+	return GroupBy{}, fmt.Errorf("invalid grouping %q, expected label, label:NAME, user or command", value)
+}
+
+// keys returns the groups a run counts in, a run counts in every one of its labels when grouping by label
+func (g GroupBy) keys(run *Run) []string {
+	switch g.Kind {
+	case "user":
+		return []string{run.User}
+	case "command":
+		if len(run.Command) == 0 {
+			return []string{""}
+		}
+		return []string{filepath.Base(run.Command[0])}
+	}
+	if g.Label != "" {
+		if value, ok := run.Labels[g.Label]; ok {
+			return []string{value}
+		}
+		return []string{"(none)"}
+	}
+	if len(run.Labels) == 0 {
+		return []string{"(none)"}
+	}
+	var keys []string
+	for name, value := range run.Labels {
+		keys = append(keys, name+"="+value)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Window is the span of time usage is aggregated over
+type Window string
+
+const (
+	WindowAll   Window = "all"
+	WindowDay   Window = "day"
+	WindowWeek  Window = "week"
+	WindowMonth Window = "month"
+)
+
+// ParseWindow parses one of all, day, week or month
+func ParseWindow(value string) (Window, error) {
+	switch window := Window(value); window {
+	case WindowAll, WindowDay, WindowWeek, WindowMonth:
+		return window, nil
+	}
+	return "", fmt.Errorf("invalid window %q, expected all, day, week or month", value)
+}
+
+// label returns the window a point in time falls in, in local time; weeks start on Monday
+func (w Window) label(t time.Time) string {
+	t = t.Local()
+	switch w {
+	case WindowDay:
+		return t.Format("2006-01-02")
+	case WindowWeek:
+		monday := t.AddDate(0, 0, -(int(t.Weekday())+6)%7)
+		return monday.Format("2006-01-02")
+	case WindowMonth:
+		return t.Format("2006-01")
+	}
+	return ""
+}
+
+// Usage is the resource usage of a group of runs over a window
+type Usage struct {
+	Group string `json:"group"`
+	// Window is the day, the Monday of the week, or the month, empty over all time
+	Window   string `json:"window,omitempty"`
+	Runs     int    `json:"runs"`
+	Failures int    `json:"failures"`
+	// CPUUsec, WallTimeUsec, ReadBytes and WriteBytes add up the runs
+	CPUUsec      uint64 `json:"cpu_usec"`
+	WallTimeUsec uint64 `json:"wall_time_usec"`
+	ReadBytes    uint64 `json:"read_bytes"`
+	WriteBytes   uint64 `json:"write_bytes"`
+	// CPU and MemoryPeak are the statistics of the CPU time and of the peak memory of a run
+	CPU        bench.Statistics `json:"cpu_usec_per_run"`
+	MemoryPeak bench.Statistics `json:"memory_peak_bytes_per_run"`
+}
+
+// Aggregate sums the usage of the runs by group and window, sorted by window then group
+func Aggregate(runs []Run, by GroupBy, window Window) []Usage {
+	type key struct{ group, window string }
+	usages := make(map[key]*Usage)
+	cpu := make(map[key][]float64)
+	memory := make(map[key][]float64)
+	for i := range runs {
+		run := &runs[i]
+		for _, group := range by.keys(run) {
+			k := key{group, window.label(run.Start)}
+			usage, ok := usages[k]
+			if !ok {
+				usage = &Usage{Group: k.group, Window: k.window}
+				usages[k] = usage
+			}
+			usage.Runs++
+			if run.ExitReason != ReasonSuccess {
+				usage.Failures++
+			}
+			usage.WallTimeUsec += run.WallTimeUsec
+			if stats := run.Stats; stats != nil {
+				usage.CPUUsec += stats.CPU.UsageUsec
+				for _, device := range stats.IO {
+					usage.ReadBytes += device.RBytes
+					usage.WriteBytes += device.WBytes
+				}
+				cpu[k] = append(cpu[k], float64(stats.CPU.UsageUsec))
+				// memory.peak is read as 0 before Linux 5.19, such runs are left out of the statistics
+				if stats.Memory.Peak > 0 {
+					memory[k] = append(memory[k], float64(stats.Memory.Peak))
+				}
+			}
+		}
+	}
+
+	result := make([]Usage, 0, len(usages))
+	for k, usage := range usages {
+		if len(cpu[k]) > 0 {
+			usage.CPU = bench.Summarize(cpu[k])
+		}
+		if len(memory[k]) > 0 {
+			usage.MemoryPeak = bench.Summarize(memory[k])
+		}
+		result = append(result, *usage)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Window != result[j].Window {
+			return result[i].Window < result[j].Window
+		}
+		return result[i].Group < result[j].Group
+	})
+	return result
+}
+
+// WriteUsageText writes the usage as a table
+func WriteUsageText(w io.Writer, usages []Usage) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "WINDOW\tGROUP\tRUNS\tFAILED\tCPU TIME\tCPU P50\tCPU P95\tWALL TIME\tMEM P50\tMEM P95\tMEM MAX\tREAD\tWRITE")
+	for _, u := range usages {
+		window := u.Window
+		if window == "" {
+			window = string(WindowAll)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%v\t%v\t%v\t%v\t%s\t%s\t%s\t%s\t%s\n", window, u.Group, u.Runs, u.Failures,
+			usecToDuration(float64(u.CPUUsec)), usecToDuration(u.CPU.P50), usecToDuration(u.CPU.P95), usecToDuration(float64(u.WallTimeUsec)),
+			formatPeak(uint64(u.MemoryPeak.P50)), formatPeak(uint64(u.MemoryPeak.P95)), formatPeak(uint64(u.MemoryPeak.Max)),
+			utils.FormatBytes(u.ReadBytes), utils.FormatBytes(u.WriteBytes))
+	}
+	return tw.Flush()
+}
+
+// WriteUsageJSON writes the usage as a JSON array
+func WriteUsageJSON(w io.Writer, usages []Usage) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(usages)
+}
+
+// WriteRunsText writes one line per run
+func WriteRunsText(w io.Writer, runs []Run) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "START\tNAME\tUSER\tREASON\tEXIT\tWALL TIME\tCPU TIME\tMEM PEAK\tLABELS\tCOMMAND")
+	for i := range runs {
+		run := &runs[i]
+		var cpuUsec, memoryPeak uint64
+		if run.Stats != nil {
+			cpuUsec, memoryPeak = run.Stats.CPU.UsageUsec, run.Stats.Memory.Peak
+		}
+		var labels []string
+		for name, value := range run.Labels {
+			labels = append(labels, name+"="+value)
+		}
+		sort.Strings(labels)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%v\t%v\t%s\t%s\t%s\n", run.Start.Local().Format("2006-01-02 15:04:05"), run.Name, run.User,
+			run.ExitReason, run.ExitCode, usecToDuration(float64(run.WallTimeUsec)), usecToDuration(float64(cpuUsec)),
+			formatPeak(memoryPeak), strings.Join(labels, ","), strings.Join(run.Command, " "))
+	}
+	return tw.Flush()
+}
+
+// formatPeak formats a peak memory, n/a when memory.peak was not available to the run
+func formatPeak(peak uint64) string {
+	if peak == 0 {
+		return "n/a"
+	}
+	return utils.FormatBytes(peak)
+}
+
+func usecToDuration(usec float64) time.Duration {
+	return (time.Duration(usec) * time.Microsecond).Round(time.Millisecond)
+}
@@ -0,0 +1,81 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+)
+
+// DefaultBudgetPollInterval is how often the budget limiters sample the cgroup usage
+var DefaultBudgetPollInterval = 500 * time.Millisecond
+
+// Grace describes how a group is terminated once a budget is exhausted
+type Grace struct {
+	// Signal is sent to every process first, 0 kills the group right away
+	Signal syscall.Signal
+	// Period is how long the processes have to exit after Signal before being killed
+	Period time.Duration
+}
+
+// BudgetAction is what happens to the group once a budget is exceeded
+type BudgetAction string
+
+const (
+	BudgetActionKill   BudgetAction = "kill"
+	BudgetActionFreeze BudgetAction = "freeze"
+	BudgetActionWarn   BudgetAction = "warn"
+)
+
+// ParseBudgetAction parses one of kill, freeze or warn
+func ParseBudgetAction(value string) (BudgetAction, error) {
+	switch action := BudgetAction(value); action {
+	case BudgetActionKill, BudgetActionFreeze, BudgetActionWarn:
+		return action, nil
+	default:
+		return "", fmt.Errorf("invalid budget action %q, expected kill, freeze or warn", value)
+	}
+}
+
+// BudgetPolicy describes how the budget limiters react when a budget is exceeded
+type BudgetPolicy struct {
+	Action BudgetAction
+	Grace  Grace
+}
+
+// enforce applies the policy to a group that exceeded its budget.
+// It returns the error the watcher ends with, nil when the run goes on.
+func (p BudgetPolicy) enforce(ctx context.Context, manager core.CgroupManager, exceeded error) error {
+	switch p.Action {
+	case BudgetActionWarn:
+		fmt.Fprintf(os.Stderr, "warning: %v\n", exceeded)
+		return nil
+	case BudgetActionFreeze:
+		// Interrupting giogo kills the frozen group instead of leaving it behind
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(interrupt)
+
+		if err := manager.Freeze(); err != nil {
+			return fmt.Errorf("error freezing the group: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "%v: the group is frozen, interrupt giogo to kill it\n", exceeded)
+		select {
+		case <-interrupt:
+			if err := manager.Kill(); err != nil {
+				return fmt.Errorf("error killing the frozen group: %v", err)
+			}
+		case <-ctx.Done():
+		}
+		return exceeded
+	default:
+		if err := core.TerminateGroup(manager, p.Grace.Signal, p.Grace.Period); err != nil {
+			return fmt.Errorf("error terminating the group: %v", err)
+		}
+		return exceeded
+	}
+}
@@ -41,10 +41,12 @@ type CPULimiter struct {
 func (c *CPULimiter) Apply(resources *specs.LinuxResources) {
 	period := uint64(100000)
 	quota := int64(c.Fraction * float64(period))
-	resources.CPU = &specs.LinuxCPU{
-		Period: &period,
-		Quota:  &quota,
+	// Keep the other CPU settings, such as the cpuset
+	if resources.CPU == nil {
+		resources.CPU = &specs.LinuxCPU{}
 	}
+	resources.CPU.Period = &period
+	resources.CPU.Quota = &quota
 }
 
 // NewCPULimiter creates a new CPULimiter with validation and error handling
@@ -0,0 +1,123 @@
+package limiter
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// CpusetLimiterError is returned for an invalid CPU list
+type CpusetLimiterError struct {
+	Message string
+	Cause   error
+}
+
+func (e *CpusetLimiterError) Error() string {
+	if e.Cause == nil {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %v", e.Message, e.Cause)
+}
+
+// chain the errors
+func (e *CpusetLimiterError) Unwrap() error {
+	return e.Cause
+}
+
+// CpusetLimiter pins the group to a set of CPUs (cpuset.cpus)
+type CpusetLimiter struct {
+	// Cpus is a CPU list in the kernel notation, e.g. 0-3,6
+	Cpus string
+}
+
+// Apply the cpuset to the provided Linux resources
+func (c *CpusetLimiter) Apply(resources *specs.LinuxResources) {
+	if resources.CPU == nil {
+		resources.CPU = &specs.LinuxCPU{}
+	}
+	resources.CPU.Cpus = c.Cpus
+}
+
+// ParseCPUList parses a CPU list such as 0-3,6 and returns the CPUs it holds in order
+func ParseCPUList(value string) ([]int, error) {
+	var cpus []int
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(first)
+		if err != nil || start < 0 {
+			return nil, &CpusetLimiterError{Message: fmt.Sprintf("invalid CPU %q", part)}
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(last)
+			if err != nil || end < start {
+				return nil, &CpusetLimiterError{Message: fmt.Sprintf("invalid CPU range %q", part)}
+			}
+		}
+		for cpu := start; cpu <= end; cpu++ {
+			if !seen[cpu] {
+				seen[cpu] = true
+				cpus = append(cpus, cpu)
+			}
+		}
+	}
+	return cpus, nil
+}
+
+// SystemOnlineCPUsFile lists the CPUs of the machine that are online
+const SystemOnlineCPUsFile = "/sys/devices/system/cpu/online"
+
+// OnlineCPUs reads the online CPUs from a file such as SystemOnlineCPUsFile.
+// Unlike runtime.NumCPU, it does not depend on the affinity giogo itself was started with.
+func OnlineCPUs(file string) ([]int, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCPUList(strings.TrimSpace(string(content)))
+}
+
+// NewCpusetLimiter creates a new CpusetLimiter, every CPU of the list must be online on this machine
+func NewCpusetLimiter(value string) (*CpusetLimiter, error) {
+	cpus, err := ParseCPUList(value)
+	if err != nil {
+		return nil, err
+	}
+	online, err := OnlineCPUs(SystemOnlineCPUsFile)
+	if err != nil {
+		return nil, &CpusetLimiterError{Message: "error reading the online CPUs", Cause: err}
+	}
+	isOnline := make(map[int]bool, len(online))
+	for _, cpu := range online {
+		isOnline[cpu] = true
+	}
+	for _, cpu := range cpus {
+		if !isOnline[cpu] {
+			return nil, &CpusetLimiterError{Message: fmt.Sprintf("CPU %d is not online, the online CPUs are %s", cpu, formatCPUList(online))}
+		}
+	}
+	return &CpusetLimiter{Cpus: strings.ReplaceAll(value, " ", "")}, nil
+}
+
+// formatCPUList formats CPUs in the kernel notation, e.g. 0-3,6
+func formatCPUList(cpus []int) string {
+	var parts []string
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(cpus[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
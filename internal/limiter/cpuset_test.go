@@ -0,0 +1,84 @@
+package limiter_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pmarchini/giogo/internal/limiter"
+)
+
+func TestParseCPUList(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []int
+		wantErr  bool
+	}{
+		{"0", []int{0}, false},
+		{"0-3", []int{0, 1, 2, 3}, false},
+		{"0,2, 4-5", []int{0, 2, 4, 5}, false},
+		{"1,1-2", []int{1, 2}, false},
+		{"", nil, true},
+		{"3-1", nil, true},
+		{"-1", nil, true},
+		{"a", nil, true},
+		{"0,", nil, true},
+	}
+
+	for _, tt := range tests {
+		cpus, err := limiter.ParseCPUList(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCPUList(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if len(cpus) != len(tt.expected) {
+			t.Errorf("ParseCPUList(%q) = %v, expected %v", tt.input, cpus, tt.expected)
+			continue
+		}
+		for i := range cpus {
+			if cpus[i] != tt.expected[i] {
+				t.Errorf("ParseCPUList(%q) = %v, expected %v", tt.input, cpus, tt.expected)
+				break
+			}
+		}
+	}
+}
+
+func TestCpusetLimiterApply(t *testing.T) {
+	cpusetLimiter, err := limiter.NewCpusetLimiter("0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cpuLimiter := &limiter.CPULimiter{Fraction: 0.5}
+
+	// The CPU limit and the cpuset are kept whatever the order they are applied in
+	var resources specs.LinuxResources
+	cpusetLimiter.Apply(&resources)
+	cpuLimiter.Apply(&resources)
+	if resources.CPU.Cpus != "0" || resources.CPU.Quota == nil || *resources.CPU.Quota != 50000 {
+		t.Errorf("unexpected CPU resources: %+v", resources.CPU)
+	}
+
+	if _, err := limiter.NewCpusetLimiter("100000"); err == nil {
+		t.Errorf("expected error for a CPU that does not exist")
+	}
+}
+
+func TestOnlineCPUs(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "online")
+	if err := os.WriteFile(file, []byte("0-2,5\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cpus, err := limiter.OnlineCPUs(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cpus) != 4 || cpus[0] != 0 || cpus[2] != 2 || cpus[3] != 5 {
+		t.Errorf("unexpected online CPUs %v", cpus)
+	}
+
+	if _, err := limiter.OnlineCPUs(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("expected error for a missing file")
+	}
+}
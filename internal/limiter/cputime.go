@@ -0,0 +1,87 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pmarchini/giogo/internal/core"
+)
+
+// ExitCodeCPUTimeBudgetExceeded is the exit code used when the CPU time budget is exhausted.
+// It matches the status of a process killed by SIGXCPU, as with RLIMIT_CPU.
+const ExitCodeCPUTimeBudgetExceeded = 128 + 24
+
+// CPUTimeBudgetError is returned when the group consumed its whole CPU time budget
+type CPUTimeBudgetError struct {
+	Budget, Consumed time.Duration
+}
+
+func (e *CPUTimeBudgetError) Error() string {
+	return fmt.Sprintf("CPU time budget of %v exceeded: consumed %v", e.Budget, e.Consumed)
+}
+
+// ExitCode returns the exit code giogo terminates with
+func (e *CPUTimeBudgetError) ExitCode() int {
+	return ExitCodeCPUTimeBudgetExceeded
+}
+
+// CPUTimeLimiter terminates the group once it consumed a total amount of CPU time (cpu.stat usage_usec)
+type CPUTimeLimiter struct {
+	Budget       time.Duration
+	Policy       BudgetPolicy
+	PollInterval time.Duration
+}
+
+// Apply is a no-op: the CPU time budget is enforced by watching the cgroup
+func (c *CPUTimeLimiter) Apply(resources *specs.LinuxResources) {}
+
+// Watch polls the CPU usage of the group and enforces the policy once the budget is spent
+func (c *CPUTimeLimiter) Watch(ctx context.Context, manager core.CgroupManager) error {
+	pollInterval := c.PollInterval
+	if pollInterval == 0 {
+		pollInterval = DefaultBudgetPollInterval
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		stats, err := manager.Stats()
+		if err != nil {
+			// The group may be going away together with the command
+			continue
+		}
+		consumed := time.Duration(stats.CPU.UsageUsec) * time.Microsecond
+		if consumed < c.Budget {
+			continue
+		}
+
+		err = c.Policy.enforce(ctx, manager, &CPUTimeBudgetError{Budget: c.Budget, Consumed: consumed})
+		if budgetErr, ok := err.(*CPUTimeBudgetError); ok {
+			// The processes kept running until they were stopped
+			if stats, err := manager.Stats(); err == nil {
+				budgetErr.Consumed = time.Duration(stats.CPU.UsageUsec) * time.Microsecond
+			}
+		}
+		return err
+	}
+}
+
+// NewCPUTimeLimiter creates a new CPUTimeLimiter from a duration (e.g. 10m, 90s)
+func NewCPUTimeLimiter(value string, policy BudgetPolicy) (*CPUTimeLimiter, error) {
+	budget, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, fmt.Errorf("unparsable CPU time budget: %v", err)
+	}
+	if budget <= 0 {
+		return nil, fmt.Errorf("CPU time budget must be positive")
+	}
+	return &CPUTimeLimiter{Budget: budget, Policy: policy}, nil
+}
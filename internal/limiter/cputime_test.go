@@ -0,0 +1,81 @@
+package limiter_test
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/limiter"
+)
+
+func TestNewCPUTimeLimiter(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"10m", 10 * time.Minute, false},
+		{"1.5s", 1500 * time.Millisecond, false},
+		{"0s", 0, true},
+		{"-1m", 0, true},
+		{"ten", 0, true},
+	}
+
+	for _, tt := range tests {
+		cpuTimeLimiter, err := limiter.NewCPUTimeLimiter(tt.input, limiter.BudgetPolicy{})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewCPUTimeLimiter(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && cpuTimeLimiter.Budget != tt.expected {
+			t.Errorf("NewCPUTimeLimiter(%q) = %v, expected %v", tt.input, cpuTimeLimiter.Budget, tt.expected)
+		}
+	}
+}
+
+func TestCPUTimeLimiterWatchExceeded(t *testing.T) {
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("Stats").Return(&core.Stats{CPU: core.CPUStats{UsageUsec: 2500000}}, nil)
+	mockManager.On("Procs").Return([]int{}, nil)
+	mockManager.On("Kill").Return(nil)
+
+	cpuTimeLimiter := &limiter.CPUTimeLimiter{
+		Budget: 2 * time.Second,
+		Policy: limiter.BudgetPolicy{
+			Action: limiter.BudgetActionKill,
+			Grace:  limiter.Grace{Signal: syscall.SIGTERM, Period: time.Second},
+		},
+		PollInterval: time.Millisecond,
+	}
+	err := cpuTimeLimiter.Watch(context.Background(), mockManager)
+
+	var budgetErr *limiter.CPUTimeBudgetError
+	if !errors.As(err, &budgetErr) {
+		t.Fatalf("expected CPUTimeBudgetError, got %v", err)
+	}
+	if budgetErr.Consumed != 2500*time.Millisecond {
+		t.Errorf("Consumed = %v, expected 2.5s", budgetErr.Consumed)
+	}
+	if budgetErr.ExitCode() != limiter.ExitCodeCPUTimeBudgetExceeded {
+		t.Errorf("ExitCode = %d, expected %d", budgetErr.ExitCode(), limiter.ExitCodeCPUTimeBudgetExceeded)
+	}
+	// The grace signal emptied the group, no kill needed
+	mockManager.AssertNotCalled(t, "Kill")
+}
+
+func TestCPUTimeLimiterWatchWithinBudget(t *testing.T) {
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("Stats").Return(&core.Stats{CPU: core.CPUStats{UsageUsec: 1000}}, nil)
+
+	cpuTimeLimiter := &limiter.CPUTimeLimiter{Budget: time.Minute, PollInterval: time.Millisecond}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := cpuTimeLimiter.Watch(ctx, mockManager); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mockManager.AssertNotCalled(t, "Kill")
+}
@@ -100,6 +100,17 @@ func GetBlockDevices(blockDir string) ([]BlockDevice, error) {
 
 func (i *IOLimiter) Apply(resources *specs.LinuxResources) {
 	// Set the throttle values for read and write operations
+	resources.BlockIO = &specs.LinuxBlockIO{}
+	if i.ReadThrottle != math.MaxUint64 {
+		resources.BlockIO.ThrottleReadBpsDevice = i.throttleDevices(i.ReadThrottle)
+	}
+	if i.WriteThrottle != math.MaxUint64 {
+		resources.BlockIO.ThrottleWriteBpsDevice = i.throttleDevices(i.WriteThrottle)
+	}
+}
+
+// throttleDevices throttles every block device at rate
+func (i *IOLimiter) throttleDevices(rate uint64) []specs.LinuxThrottleDevice {
 	var linuxThrottleDevices []specs.LinuxThrottleDevice
 	for _, device := range i.BlockDevices {
 		linuxThrottleDevices = append(
@@ -109,17 +120,11 @@ func (i *IOLimiter) Apply(resources *specs.LinuxResources) {
 					Major: device.Major,
 					Minor: device.Minor,
 				},
-				Rate: i.ReadThrottle,
+				Rate: rate,
 			},
 		)
 	}
-	resources.BlockIO = &specs.LinuxBlockIO{}
-	if i.ReadThrottle != math.MaxUint64 {
-		resources.BlockIO.ThrottleReadBpsDevice = linuxThrottleDevices
-	}
-	if i.WriteThrottle != math.MaxUint64 {
-		resources.BlockIO.ThrottleWriteBpsDevice = linuxThrottleDevices
-	}
+	return linuxThrottleDevices
 }
 
 type IOLimiterInitializer struct {
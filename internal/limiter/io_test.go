@@ -191,6 +191,11 @@ func TestIOLimiterApplyNoThrottleValues(t *testing.T) {
 	if len(resources.BlockIO.ThrottleWriteBpsDevice) != len(mockDevices) {
 		t.Fatalf("unexpected number of ThrottleWriteBpsDevice: %d", len(resources.BlockIO.ThrottleWriteBpsDevice))
 	}
+	for _, device := range resources.BlockIO.ThrottleWriteBpsDevice {
+		if device.Rate != limiter.WriteThrottle {
+			t.Fatalf("unexpected write rate %d for %d:%d, expected %d", device.Rate, device.Major, device.Minor, limiter.WriteThrottle)
+		}
+	}
 }
 
 // Test invalid system block directory
@@ -0,0 +1,187 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/utils"
+)
+
+// ExitCodeIOBudgetExceeded is the exit code used when an IO byte budget is exhausted.
+// It matches the status of a process killed by SIGXFSZ, as with RLIMIT_FSIZE.
+const ExitCodeIOBudgetExceeded = 128 + 25
+
+// IOBudgetError is returned when the group read or wrote more bytes than its budget
+type IOBudgetError struct {
+	// Direction is either "read" or "write"
+	Direction        string
+	Budget, Consumed uint64
+}
+
+func (e *IOBudgetError) Error() string {
+	return fmt.Sprintf("IO %s budget of %s exceeded: consumed %s", e.Direction, utils.FormatBytes(e.Budget), utils.FormatBytes(e.Consumed))
+}
+
+// ExitCode returns the exit code giogo terminates with
+func (e *IOBudgetError) ExitCode() int {
+	return ExitCodeIOBudgetExceeded
+}
+
+// IOBudgetLimiter enforces a total number of bytes read or written by the group (io.stat) on the selected devices
+type IOBudgetLimiter struct {
+	// ReadMax and WriteMax are math.MaxUint64 when unlimited
+	ReadMax, WriteMax uint64
+	BlockDevices      []BlockDevice
+	Policy            BudgetPolicy
+	PollInterval      time.Duration
+}
+
+// Apply is a no-op: the IO budgets are enforced by watching the cgroup
+func (i *IOBudgetLimiter) Apply(resources *specs.LinuxResources) {}
+
+// Watch polls the IO usage of the group and enforces the policy once a budget is spent
+func (i *IOBudgetLimiter) Watch(ctx context.Context, manager core.CgroupManager) error {
+	pollInterval := i.PollInterval
+	if pollInterval == 0 {
+		pollInterval = DefaultBudgetPollInterval
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	readMax, writeMax := i.ReadMax, i.WriteMax
+	for readMax != math.MaxUint64 || writeMax != math.MaxUint64 {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		stats, err := manager.Stats()
+		if err != nil {
+			// The group may be going away together with the command
+			continue
+		}
+		read, written := i.Usage(stats.IO)
+
+		var exceeded *IOBudgetError
+		if written > writeMax {
+			exceeded = &IOBudgetError{Direction: "write", Budget: writeMax, Consumed: written}
+			// When only warning, each budget is reported once
+			writeMax = math.MaxUint64
+		} else if read > readMax {
+			exceeded = &IOBudgetError{Direction: "read", Budget: readMax, Consumed: read}
+			readMax = math.MaxUint64
+		}
+		if exceeded == nil {
+			continue
+		}
+		if err := i.Policy.enforce(ctx, manager, exceeded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Usage sums the bytes read and written on the selected devices, every device counts when none is selected
+func (i *IOBudgetLimiter) Usage(io []core.IOStats) (read, written uint64) {
+	selected := make(map[[2]int64]bool, len(i.BlockDevices))
+	for _, device := range i.BlockDevices {
+		selected[[2]int64{device.Major, device.Minor}] = true
+	}
+	for _, entry := range io {
+		if len(selected) > 0 && !selected[[2]int64{entry.Major, entry.Minor}] {
+			continue
+		}
+		read += entry.RBytes
+		written += entry.WBytes
+	}
+	return read, written
+}
+
+type IOBudgetLimiterInitializer struct {
+	ReadTotalMax, WriteTotalMax string
+	// Devices are the names (e.g., sda) or major:minor numbers of the devices counted, every physical disk when empty
+	Devices                []string
+	Policy                 BudgetPolicy
+	OverrideSystemBlockDir string
+}
+
+// NewIOBudgetLimiter creates a new IOBudgetLimiter on the selected block devices, empty values are unlimited
+func NewIOBudgetLimiter(init *IOBudgetLimiterInitializer) (*IOBudgetLimiter, error) {
+	var readMax, writeMax uint64 = math.MaxUint64, math.MaxUint64
+	systemBlockDir := "/sys/block"
+	if init.OverrideSystemBlockDir != "" {
+		systemBlockDir = init.OverrideSystemBlockDir
+	}
+	blockDevices, err := GetBlockDevices(systemBlockDir)
+	if err != nil {
+		return nil, &IOLimiterError{Message: "error retrieving block devices", Cause: err}
+	}
+	if len(init.Devices) > 0 {
+		blockDevices, err = SelectBlockDevices(blockDevices, init.Devices)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		blockDevices = PhysicalBlockDevices(systemBlockDir, blockDevices)
+	}
+	if init.ReadTotalMax != "" {
+		readMax, err = utils.BytesStringToBytes(init.ReadTotalMax)
+		if err != nil {
+			return nil, &IOLimiterError{Message: "unparsable ReadTotalMax value", Cause: err}
+		}
+	}
+	if init.WriteTotalMax != "" {
+		writeMax, err = utils.BytesStringToBytes(init.WriteTotalMax)
+		if err != nil {
+			return nil, &IOLimiterError{Message: "unparsable WriteTotalMax value", Cause: err}
+		}
+	}
+	return &IOBudgetLimiter{
+		ReadMax:      readMax,
+		WriteMax:     writeMax,
+		BlockDevices: blockDevices,
+		Policy:       init.Policy,
+	}, nil
+}
+
+// PhysicalBlockDevices returns the devices that are not stacked on other devices, i.e. without slaves.
+// The IO to a device-mapper or md device is also accounted to the disks below it, so counting both would count it twice.
+func PhysicalBlockDevices(blockDir string, devices []BlockDevice) []BlockDevice {
+	var physical []BlockDevice
+	for _, device := range devices {
+		slaves, err := os.ReadDir(filepath.Join(blockDir, device.Name, "slaves"))
+		if err == nil && len(slaves) > 0 {
+			continue
+		}
+		physical = append(physical, device)
+	}
+	return physical
+}
+
+// SelectBlockDevices returns the devices matching the selectors, each a device name or its major:minor numbers
+func SelectBlockDevices(devices []BlockDevice, selectors []string) ([]BlockDevice, error) {
+	var selected []BlockDevice
+	for _, selector := range selectors {
+		selector = strings.TrimSpace(selector)
+		found := false
+		for _, device := range devices {
+			if device.Name == selector || fmt.Sprintf("%d:%d", device.Major, device.Minor) == selector {
+				selected = append(selected, device)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, &IOLimiterError{Message: fmt.Sprintf("unknown block device %q", selector)}
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,222 @@
+package limiter_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/limiter"
+)
+
+func TestNewIOBudgetLimiter(t *testing.T) {
+	mockDevices := []limiter.BlockDevice{
+		{Name: "sda", Major: 8, Minor: 0},
+	}
+	tempDir, cleanup, err := setupMockBlockDevices(t, mockDevices)
+	if err != nil {
+		t.Fatalf("Failed to set up mock block devices: %v", err)
+	}
+	defer cleanup()
+
+	ioBudgetLimiter, err := limiter.NewIOBudgetLimiter(&limiter.IOBudgetLimiterInitializer{
+		WriteTotalMax:          "1g",
+		OverrideSystemBlockDir: tempDir,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ioBudgetLimiter.ReadMax != math.MaxUint64 {
+		t.Errorf("unexpected ReadMax: %d", ioBudgetLimiter.ReadMax)
+	}
+	if ioBudgetLimiter.WriteMax != 1024*1024*1024 {
+		t.Errorf("unexpected WriteMax: %d", ioBudgetLimiter.WriteMax)
+	}
+	if len(ioBudgetLimiter.BlockDevices) != len(mockDevices) {
+		t.Errorf("unexpected number of BlockDevices: %d", len(ioBudgetLimiter.BlockDevices))
+	}
+
+	_, err = limiter.NewIOBudgetLimiter(&limiter.IOBudgetLimiterInitializer{
+		ReadTotalMax:           "invalid",
+		OverrideSystemBlockDir: tempDir,
+	})
+	if ioLimiterErr, ok := err.(*limiter.IOLimiterError); !ok || ioLimiterErr.Message != "unparsable ReadTotalMax value" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNewIOBudgetLimiter_Devices(t *testing.T) {
+	mockDevices := []limiter.BlockDevice{
+		{Name: "sda", Major: 8, Minor: 0},
+		{Name: "sdb", Major: 8, Minor: 16},
+		{Name: "nvme0n1", Major: 259, Minor: 0},
+	}
+	tempDir, cleanup, err := setupMockBlockDevices(t, mockDevices)
+	if err != nil {
+		t.Fatalf("Failed to set up mock block devices: %v", err)
+	}
+	defer cleanup()
+
+	ioBudgetLimiter, err := limiter.NewIOBudgetLimiter(&limiter.IOBudgetLimiterInitializer{
+		WriteTotalMax:          "1g",
+		Devices:                []string{"sdb", "259:0"},
+		OverrideSystemBlockDir: tempDir,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []limiter.BlockDevice{mockDevices[1], mockDevices[2]}
+	if len(ioBudgetLimiter.BlockDevices) != 2 || ioBudgetLimiter.BlockDevices[0] != expected[0] || ioBudgetLimiter.BlockDevices[1] != expected[1] {
+		t.Errorf("unexpected BlockDevices: %v, expected %v", ioBudgetLimiter.BlockDevices, expected)
+	}
+
+	_, err = limiter.NewIOBudgetLimiter(&limiter.IOBudgetLimiterInitializer{
+		WriteTotalMax:          "1g",
+		Devices:                []string{"sdz"},
+		OverrideSystemBlockDir: tempDir,
+	})
+	if ioLimiterErr, ok := err.(*limiter.IOLimiterError); !ok || ioLimiterErr.Message != `unknown block device "sdz"` {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNewIOBudgetLimiter_PhysicalDevices(t *testing.T) {
+	mockDevices := []limiter.BlockDevice{
+		{Name: "sda", Major: 8, Minor: 0},
+		{Name: "sdb", Major: 8, Minor: 16},
+		{Name: "md0", Major: 9, Minor: 0},
+		{Name: "dm-0", Major: 253, Minor: 0},
+	}
+	tempDir, cleanup, err := setupMockBlockDevices(t, mockDevices)
+	if err != nil {
+		t.Fatalf("Failed to set up mock block devices: %v", err)
+	}
+	defer cleanup()
+	// md0 mirrors sda and sdb, dm-0 is a volume on md0
+	for device, slaves := range map[string][]string{"sda": nil, "md0": {"sda", "sdb"}, "dm-0": {"md0"}} {
+		if err := os.MkdirAll(filepath.Join(tempDir, device, "slaves"), 0755); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, slave := range slaves {
+			if err := os.Symlink(filepath.Join(tempDir, slave), filepath.Join(tempDir, device, "slaves", slave)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+	}
+
+	ioBudgetLimiter, err := limiter.NewIOBudgetLimiter(&limiter.IOBudgetLimiterInitializer{
+		WriteTotalMax:          "1g",
+		OverrideSystemBlockDir: tempDir,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The IO to dm-0 is also accounted to md0, sda and sdb, only the disks are counted
+	expected := []limiter.BlockDevice{mockDevices[0], mockDevices[1]}
+	if len(ioBudgetLimiter.BlockDevices) != 2 || ioBudgetLimiter.BlockDevices[0] != expected[0] || ioBudgetLimiter.BlockDevices[1] != expected[1] {
+		t.Errorf("unexpected BlockDevices: %v, expected %v", ioBudgetLimiter.BlockDevices, expected)
+	}
+
+	// A stacked device is counted when it is selected
+	ioBudgetLimiter, err = limiter.NewIOBudgetLimiter(&limiter.IOBudgetLimiterInitializer{
+		WriteTotalMax:          "1g",
+		Devices:                []string{"dm-0"},
+		OverrideSystemBlockDir: tempDir,
+	})
+	if err != nil || len(ioBudgetLimiter.BlockDevices) != 1 || ioBudgetLimiter.BlockDevices[0] != mockDevices[3] {
+		t.Errorf("unexpected BlockDevices %v (%v)", ioBudgetLimiter, err)
+	}
+}
+
+func TestIOBudgetLimiterUsage(t *testing.T) {
+	ioBudgetLimiter := &limiter.IOBudgetLimiter{
+		BlockDevices: []limiter.BlockDevice{{Name: "sda", Major: 8, Minor: 0}},
+	}
+	io := []core.IOStats{
+		{Major: 8, Minor: 0, RBytes: 100, WBytes: 200},
+		{Major: 7, Minor: 0, RBytes: 1000, WBytes: 2000},
+	}
+
+	read, written := ioBudgetLimiter.Usage(io)
+	if read != 100 || written != 200 {
+		t.Errorf("Usage() = %d/%d, expected 100/200", read, written)
+	}
+
+	ioBudgetLimiter.BlockDevices = nil
+	read, written = ioBudgetLimiter.Usage(io)
+	if read != 1100 || written != 2200 {
+		t.Errorf("Usage() without selected devices = %d/%d, expected 1100/2200", read, written)
+	}
+}
+
+func TestIOBudgetLimiterWatchKill(t *testing.T) {
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("Stats").Return(&core.Stats{IO: []core.IOStats{{Major: 8, Minor: 0, WBytes: 2048}}}, nil)
+	mockManager.On("Kill").Return(nil)
+
+	ioBudgetLimiter := &limiter.IOBudgetLimiter{
+		ReadMax:      math.MaxUint64,
+		WriteMax:     1024,
+		Policy:       limiter.BudgetPolicy{Action: limiter.BudgetActionKill},
+		PollInterval: time.Millisecond,
+	}
+	err := ioBudgetLimiter.Watch(context.Background(), mockManager)
+
+	var budgetErr *limiter.IOBudgetError
+	if !errors.As(err, &budgetErr) {
+		t.Fatalf("expected IOBudgetError, got %v", err)
+	}
+	if budgetErr.Direction != "write" || budgetErr.Consumed != 2048 {
+		t.Errorf("unexpected budget error: %+v", budgetErr)
+	}
+	if budgetErr.ExitCode() != limiter.ExitCodeIOBudgetExceeded {
+		t.Errorf("ExitCode = %d, expected %d", budgetErr.ExitCode(), limiter.ExitCodeIOBudgetExceeded)
+	}
+	mockManager.AssertCalled(t, "Kill")
+}
+
+func TestIOBudgetLimiterWatchFreeze(t *testing.T) {
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("Stats").Return(&core.Stats{IO: []core.IOStats{{Major: 8, Minor: 0, RBytes: 2048}}}, nil)
+	mockManager.On("Freeze").Return(nil)
+
+	ioBudgetLimiter := &limiter.IOBudgetLimiter{
+		ReadMax:      1024,
+		WriteMax:     math.MaxUint64,
+		Policy:       limiter.BudgetPolicy{Action: limiter.BudgetActionFreeze},
+		PollInterval: time.Millisecond,
+	}
+	// The frozen group stays frozen until the command is gone
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := ioBudgetLimiter.Watch(ctx, mockManager)
+
+	var budgetErr *limiter.IOBudgetError
+	if !errors.As(err, &budgetErr) || budgetErr.Direction != "read" {
+		t.Fatalf("expected read IOBudgetError, got %v", err)
+	}
+	mockManager.AssertCalled(t, "Freeze")
+	mockManager.AssertNotCalled(t, "Kill")
+}
+
+func TestIOBudgetLimiterWatchWarn(t *testing.T) {
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("Stats").Return(&core.Stats{IO: []core.IOStats{{Major: 8, Minor: 0, RBytes: 2048, WBytes: 2048}}}, nil)
+
+	ioBudgetLimiter := &limiter.IOBudgetLimiter{
+		ReadMax:      1024,
+		WriteMax:     1024,
+		Policy:       limiter.BudgetPolicy{Action: limiter.BudgetActionWarn},
+		PollInterval: time.Millisecond,
+	}
+	// Once both budgets have been reported there is nothing left to watch
+	if err := ioBudgetLimiter.Watch(context.Background(), mockManager); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mockManager.AssertNotCalled(t, "Kill")
+	mockManager.AssertNotCalled(t, "Freeze")
+}
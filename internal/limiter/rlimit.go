@@ -0,0 +1,124 @@
+package limiter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/utils"
+	"golang.org/x/sys/unix"
+)
+
+// RlimitLimiter custom error
+type RlimitLimiterError struct {
+	Message string
+	Cause   error
+}
+
+func (e *RlimitLimiterError) Error() string {
+	if e.Cause == nil {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %v", e.Message, e.Cause)
+}
+
+func (e *RlimitLimiterError) Is(target error) bool {
+	return e.Cause == target
+}
+
+// chain the errors
+func (e *RlimitLimiterError) Unwrap() error {
+	return e.Cause
+}
+
+// UnlimitedRlimitValue disables the given soft or hard limit
+var UnlimitedRlimitValue = "unlimited"
+
+// rlimitResource describes a supported rlimit and how its values are parsed
+type rlimitResource struct {
+	Resource int
+	// SizeBased resources accept the same units as memory limits (k, m, g)
+	SizeBased bool
+}
+
+var rlimitResources = map[string]rlimitResource{
+	"NOFILE": {Resource: unix.RLIMIT_NOFILE},
+	"CORE":   {Resource: unix.RLIMIT_CORE, SizeBased: true},
+	"FSIZE":  {Resource: unix.RLIMIT_FSIZE, SizeBased: true},
+	"STACK":  {Resource: unix.RLIMIT_STACK, SizeBased: true},
+	"AS":     {Resource: unix.RLIMIT_AS, SizeBased: true},
+}
+
+// Rlimit is a single per-process resource limit
+type Rlimit = core.Rlimit
+
+// RlimitLimiter applies classic per-process rlimits to the launched command.
+// Rlimits have no cgroup equivalent, so they are set in the child before it executes the command.
+type RlimitLimiter struct {
+	Rlimits []Rlimit
+}
+
+// Apply is a no-op: rlimits are not part of the cgroup resources
+func (r *RlimitLimiter) Apply(resources *specs.LinuxResources) {}
+
+// ApplyProcess sets the rlimits the command is executed with
+func (r *RlimitLimiter) ApplyProcess(attr *core.ProcessAttr) {
+	attr.Rlimits = append(attr.Rlimits, r.Rlimits...)
+}
+
+// NewRlimitLimiter creates a new RlimitLimiter from values in the form NAME=soft[:hard]
+func NewRlimitLimiter(values []string) (*RlimitLimiter, error) {
+	var rlimits []Rlimit
+	for _, value := range values {
+		rlimit, err := ParseRlimit(value)
+		if err != nil {
+			return nil, err
+		}
+		rlimits = append(rlimits, rlimit)
+	}
+	return &RlimitLimiter{Rlimits: rlimits}, nil
+}
+
+// ParseRlimit parses a NAME=soft[:hard] value, the hard limit defaults to the soft one
+func ParseRlimit(value string) (Rlimit, error) {
+	name, limits, found := strings.Cut(value, "=")
+	if !found {
+		return Rlimit{}, &RlimitLimiterError{Message: fmt.Sprintf("invalid rlimit %q, expected NAME=soft[:hard]", value)}
+	}
+	name = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "RLIMIT_")
+	resource, ok := rlimitResources[name]
+	if !ok {
+		return Rlimit{}, &RlimitLimiterError{Message: fmt.Sprintf("unsupported rlimit %q", name)}
+	}
+
+	softValue, hardValue, hasHard := strings.Cut(limits, ":")
+	soft, err := parseRlimitValue(softValue, resource.SizeBased)
+	if err != nil {
+		return Rlimit{}, &RlimitLimiterError{Message: fmt.Sprintf("unparsable soft limit for RLIMIT_%s", name), Cause: err}
+	}
+	hard := soft
+	if hasHard {
+		hard, err = parseRlimitValue(hardValue, resource.SizeBased)
+		if err != nil {
+			return Rlimit{}, &RlimitLimiterError{Message: fmt.Sprintf("unparsable hard limit for RLIMIT_%s", name), Cause: err}
+		}
+	}
+	if soft > hard {
+		return Rlimit{}, &RlimitLimiterError{Message: fmt.Sprintf("soft limit exceeds hard limit for RLIMIT_%s", name)}
+	}
+
+	return Rlimit{Name: name, Resource: resource.Resource, Soft: soft, Hard: hard}, nil
+}
+
+func parseRlimitValue(value string, sizeBased bool) (uint64, error) {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, UnlimitedRlimitValue) {
+		return unix.RLIM_INFINITY, nil
+	}
+	if sizeBased {
+		return utils.BytesStringToBytes(value)
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
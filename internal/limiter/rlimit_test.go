@@ -0,0 +1,67 @@
+package limiter_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/limiter"
+	"golang.org/x/sys/unix"
+)
+
+func TestParseRlimit(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedName string
+		expectedSoft uint64
+		expectedHard uint64
+		wantErr      bool
+	}{
+		{"NOFILE=1024", "NOFILE", 1024, 1024, false},
+		{"nofile=1024:4096", "NOFILE", 1024, 4096, false},
+		{"RLIMIT_CORE=0", "CORE", 0, 0, false},
+		{"fsize=1g", "FSIZE", 1024 * 1024 * 1024, 1024 * 1024 * 1024, false},
+		{"stack=8m:unlimited", "STACK", 8 * 1024 * 1024, unix.RLIM_INFINITY, false},
+		{"AS=unlimited", "AS", unix.RLIM_INFINITY, unix.RLIM_INFINITY, false},
+		{"NOFILE=1k", "", 0, 0, true},
+		{"NOFILE=4096:1024", "", 0, 0, true},
+		{"NPROC=10", "", 0, 0, true},
+		{"NOFILE", "", 0, 0, true},
+		{"CORE=invalid", "", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		rlimit, err := limiter.ParseRlimit(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRlimit(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			if _, ok := err.(*limiter.RlimitLimiterError); !ok {
+				t.Errorf("ParseRlimit(%q) unexpected error type: %T", tt.input, err)
+			}
+			continue
+		}
+		if rlimit.Name != tt.expectedName || rlimit.Soft != tt.expectedSoft || rlimit.Hard != tt.expectedHard {
+			t.Errorf("ParseRlimit(%q) = %+v, expected %s=%d:%d", tt.input, rlimit, tt.expectedName, tt.expectedSoft, tt.expectedHard)
+		}
+	}
+}
+
+func TestRlimitLimiterApplyProcess(t *testing.T) {
+	rlimitLimiter, err := limiter.NewRlimitLimiter([]string{"NOFILE=1024:4096", "CORE=0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var attr core.ProcessAttr
+	rlimitLimiter.ApplyProcess(&attr)
+
+	expected := []core.Rlimit{
+		{Name: "NOFILE", Resource: unix.RLIMIT_NOFILE, Soft: 1024, Hard: 4096},
+		{Name: "CORE", Resource: unix.RLIMIT_CORE, Soft: 0, Hard: 0},
+	}
+	if !reflect.DeepEqual(attr.Rlimits, expected) {
+		t.Errorf("ApplyProcess() rlimits = %+v, expected %+v", attr.Rlimits, expected)
+	}
+}
@@ -0,0 +1,209 @@
+package limiter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pmarchini/giogo/internal/core"
+)
+
+// SchedulingLimiterError is returned by the nice, ionice and OOM score limiters
+type SchedulingLimiterError struct {
+	Message string
+	Cause   error
+}
+
+func (e *SchedulingLimiterError) Error() string {
+	if e.Cause == nil {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %v", e.Message, e.Cause)
+}
+
+func (e *SchedulingLimiterError) Is(target error) bool {
+	return e.Cause == target
+}
+
+// chain the errors
+func (e *SchedulingLimiterError) Unwrap() error {
+	return e.Cause
+}
+
+// NiceLimiter sets the scheduling priority of the launched process
+type NiceLimiter struct {
+	Nice int
+}
+
+// Apply is a no-op: the nice value is not part of the cgroup resources
+func (n *NiceLimiter) Apply(resources *specs.LinuxResources) {}
+
+// ApplyProcess sets the nice value the command is executed with
+func (n *NiceLimiter) ApplyProcess(attr *core.ProcessAttr) {
+	nice := n.Nice
+	attr.Nice = &nice
+}
+
+// NewNiceLimiter creates a new NiceLimiter, the value must be between -20 and 19
+func NewNiceLimiter(value string) (*NiceLimiter, error) {
+	nice, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return nil, &SchedulingLimiterError{Message: "unparsable nice value", Cause: err}
+	}
+	if nice < -20 || nice > 19 {
+		return nil, &SchedulingLimiterError{Message: fmt.Sprintf("nice value %d out of range [-20, 19]", nice)}
+	}
+	return &NiceLimiter{Nice: nice}, nil
+}
+
+// IO scheduling classes, see ioprio_set(2)
+const (
+	IOPrioClassNone = iota
+	IOPrioClassRealtime
+	IOPrioClassBestEffort
+	IOPrioClassIdle
+)
+
+const ioprioClassShift = 13
+
+var ioPrioClasses = map[string]int{
+	"none":        IOPrioClassNone,
+	"realtime":    IOPrioClassRealtime,
+	"best-effort": IOPrioClassBestEffort,
+	"idle":        IOPrioClassIdle,
+}
+
+// IONiceLimiter sets the IO scheduling class and level of the launched process
+type IONiceLimiter struct {
+	Class, Level int
+	// UnsupportedDevices lists the block devices whose IO scheduler ignores IO priorities
+	UnsupportedDevices []string
+}
+
+// Apply is a no-op: the IO priority is not part of the cgroup resources
+func (i *IONiceLimiter) Apply(resources *specs.LinuxResources) {}
+
+// ApplyProcess sets the IO priority the command is executed with
+func (i *IONiceLimiter) ApplyProcess(attr *core.ProcessAttr) {
+	ioprio := i.Class<<ioprioClassShift | i.Level
+	attr.IOPrio = &ioprio
+}
+
+type IONiceLimiterInitializer struct {
+	Class, Level           string
+	OverrideSystemBlockDir string
+}
+
+// NewIONiceLimiter creates a new IONiceLimiter.
+// The class defaults to best-effort when only a level is given, as ionice(1) does.
+func NewIONiceLimiter(init *IONiceLimiterInitializer) (*IONiceLimiter, error) {
+	class := IOPrioClassBestEffort
+	if init.Class != "" {
+		var ok bool
+		class, ok = ioPrioClasses[strings.ToLower(strings.TrimSpace(init.Class))]
+		if !ok {
+			parsed, err := strconv.Atoi(strings.TrimSpace(init.Class))
+			if err != nil || parsed < IOPrioClassNone || parsed > IOPrioClassIdle {
+				return nil, &SchedulingLimiterError{Message: fmt.Sprintf("invalid ionice class %q, expected none, realtime, best-effort or idle", init.Class)}
+			}
+			class = parsed
+		}
+	}
+
+	level := 4
+	if init.Level != "" {
+		if class == IOPrioClassIdle || class == IOPrioClassNone {
+			return nil, &SchedulingLimiterError{Message: "ionice level is only supported with the realtime and best-effort classes"}
+		}
+		var err error
+		level, err = strconv.Atoi(strings.TrimSpace(init.Level))
+		if err != nil {
+			return nil, &SchedulingLimiterError{Message: "unparsable ionice level", Cause: err}
+		}
+		if level < 0 || level > 7 {
+			return nil, &SchedulingLimiterError{Message: fmt.Sprintf("ionice level %d out of range [0, 7]", level)}
+		}
+	}
+	if class == IOPrioClassIdle || class == IOPrioClassNone {
+		level = 0
+	}
+
+	systemBlockDir := "/sys/block"
+	if init.OverrideSystemBlockDir != "" {
+		systemBlockDir = init.OverrideSystemBlockDir
+	}
+	unsupported, err := GetDevicesIgnoringIOPriority(systemBlockDir)
+	if err != nil {
+		return nil, &SchedulingLimiterError{Message: "error retrieving IO schedulers", Cause: err}
+	}
+
+	return &IONiceLimiter{Class: class, Level: level, UnsupportedDevices: unsupported}, nil
+}
+
+// GetDevicesIgnoringIOPriority returns the block devices whose active IO scheduler is not BFQ (or the legacy CFQ).
+// IO priorities set with ionice have no effect on those devices.
+func GetDevicesIgnoringIOPriority(blockDir string) ([]string, error) {
+	var devices []string
+
+	entries, err := os.ReadDir(blockDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		// Loop and RAM devices never honour IO priorities, reporting them would only add noise
+		if strings.HasPrefix(entry.Name(), "loop") || strings.HasPrefix(entry.Name(), "ram") || strings.HasPrefix(entry.Name(), "zram") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(blockDir, entry.Name(), "queue", "scheduler"))
+		if err != nil {
+			// Devices without a request queue have no scheduler to check
+			continue
+		}
+		scheduler := ActiveIOScheduler(string(content))
+		if scheduler != "bfq" && scheduler != "cfq" {
+			devices = append(devices, fmt.Sprintf("%s (%s)", entry.Name(), scheduler))
+		}
+	}
+
+	return devices, nil
+}
+
+// ActiveIOScheduler returns the scheduler in brackets from the content of a queue/scheduler file
+func ActiveIOScheduler(content string) string {
+	for _, field := range strings.Fields(content) {
+		if strings.HasPrefix(field, "[") && strings.HasSuffix(field, "]") {
+			return strings.Trim(field, "[]")
+		}
+	}
+	return strings.TrimSpace(content)
+}
+
+// OOMScoreAdjLimiter sets the OOM score adjustment of the launched process
+type OOMScoreAdjLimiter struct {
+	Adj int
+}
+
+// Apply is a no-op: the OOM score adjustment is not part of the cgroup resources
+func (o *OOMScoreAdjLimiter) Apply(resources *specs.LinuxResources) {}
+
+// ApplyProcess sets the OOM score adjustment the command is executed with
+func (o *OOMScoreAdjLimiter) ApplyProcess(attr *core.ProcessAttr) {
+	adj := o.Adj
+	attr.OOMScoreAdj = &adj
+}
+
+// NewOOMScoreAdjLimiter creates a new OOMScoreAdjLimiter, the value must be between -1000 and 1000
+func NewOOMScoreAdjLimiter(value string) (*OOMScoreAdjLimiter, error) {
+	adj, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return nil, &SchedulingLimiterError{Message: "unparsable OOM score adjustment", Cause: err}
+	}
+	if adj < -1000 || adj > 1000 {
+		return nil, &SchedulingLimiterError{Message: fmt.Sprintf("OOM score adjustment %d out of range [-1000, 1000]", adj)}
+	}
+	return &OOMScoreAdjLimiter{Adj: adj}, nil
+}
@@ -0,0 +1,152 @@
+package limiter_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/limiter"
+)
+
+func TestNewNiceLimiter(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+		wantErr  bool
+	}{
+		{"19", 19, false},
+		{"-20", -20, false},
+		{"0", 0, false},
+		{"20", 0, true},
+		{"-21", 0, true},
+		{"invalid", 0, true},
+	}
+
+	for _, tt := range tests {
+		niceLimiter, err := limiter.NewNiceLimiter(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewNiceLimiter(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && niceLimiter.Nice != tt.expected {
+			t.Errorf("NewNiceLimiter(%q) = %v, expected %v", tt.input, niceLimiter.Nice, tt.expected)
+		}
+	}
+}
+
+// createMockSchedulers creates block devices with the given active IO scheduler
+func createMockSchedulers(t *testing.T, schedulers map[string]string) string {
+	t.Helper()
+	tempDir := t.TempDir()
+	for name, scheduler := range schedulers {
+		queueDir := filepath.Join(tempDir, name, "queue")
+		if err := os.MkdirAll(queueDir, 0755); err != nil {
+			t.Fatalf("Failed to create queue directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(queueDir, "scheduler"), []byte(scheduler), 0644); err != nil {
+			t.Fatalf("Failed to write scheduler file: %v", err)
+		}
+	}
+	return tempDir
+}
+
+func TestNewIONiceLimiter(t *testing.T) {
+	blockDir := createMockSchedulers(t, map[string]string{"sda": "mq-deadline kyber [bfq] none"})
+	tests := []struct {
+		class, level  string
+		expectedClass int
+		expectedLevel int
+		wantErr       bool
+	}{
+		{"idle", "", limiter.IOPrioClassIdle, 0, false},
+		{"best-effort", "7", limiter.IOPrioClassBestEffort, 7, false},
+		{"", "2", limiter.IOPrioClassBestEffort, 2, false},
+		{"1", "0", limiter.IOPrioClassRealtime, 0, false},
+		{"idle", "3", 0, 0, true},
+		{"best-effort", "8", 0, 0, true},
+		{"fast", "", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		ioniceLimiter, err := limiter.NewIONiceLimiter(&limiter.IONiceLimiterInitializer{
+			Class:                  tt.class,
+			Level:                  tt.level,
+			OverrideSystemBlockDir: blockDir,
+		})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewIONiceLimiter(%q, %q) error = %v, wantErr %v", tt.class, tt.level, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if ioniceLimiter.Class != tt.expectedClass || ioniceLimiter.Level != tt.expectedLevel {
+			t.Errorf("NewIONiceLimiter(%q, %q) = %d/%d, expected %d/%d", tt.class, tt.level, ioniceLimiter.Class, ioniceLimiter.Level, tt.expectedClass, tt.expectedLevel)
+		}
+		if len(ioniceLimiter.UnsupportedDevices) != 0 {
+			t.Errorf("unexpected unsupported devices: %v", ioniceLimiter.UnsupportedDevices)
+		}
+	}
+}
+
+func TestGetDevicesIgnoringIOPriority(t *testing.T) {
+	blockDir := createMockSchedulers(t, map[string]string{
+		"sda":     "mq-deadline kyber [bfq] none",
+		"nvme0n1": "[none] mq-deadline",
+		"sdb":     "[mq-deadline] bfq none",
+		"loop0":   "[none]",
+	})
+
+	devices, err := limiter.GetDevicesIgnoringIOPriority(blockDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"nvme0n1 (none)", "sdb (mq-deadline)"}
+	if strings.Join(devices, ",") != strings.Join(expected, ",") {
+		t.Errorf("GetDevicesIgnoringIOPriority() = %v, expected %v", devices, expected)
+	}
+}
+
+func TestNewOOMScoreAdjLimiter(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+		wantErr  bool
+	}{
+		{"1000", 1000, false},
+		{"-1000", -1000, false},
+		{"1001", 0, true},
+		{"invalid", 0, true},
+	}
+
+	for _, tt := range tests {
+		oomLimiter, err := limiter.NewOOMScoreAdjLimiter(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewOOMScoreAdjLimiter(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && oomLimiter.Adj != tt.expected {
+			t.Errorf("NewOOMScoreAdjLimiter(%q) = %v, expected %v", tt.input, oomLimiter.Adj, tt.expected)
+		}
+	}
+}
+
+func TestSchedulingLimitersApplyProcess(t *testing.T) {
+	var attr core.ProcessAttr
+	(&limiter.NiceLimiter{Nice: 10}).ApplyProcess(&attr)
+	(&limiter.IONiceLimiter{Class: limiter.IOPrioClassBestEffort, Level: 7}).ApplyProcess(&attr)
+	(&limiter.OOMScoreAdjLimiter{Adj: 1000}).ApplyProcess(&attr)
+
+	if attr.Nice == nil || *attr.Nice != 10 {
+		t.Errorf("nice = %v, expected 10", attr.Nice)
+	}
+	// The IO priority holds the class in its upper bits, see ioprio_set(2)
+	if attr.IOPrio == nil || *attr.IOPrio != limiter.IOPrioClassBestEffort<<13|7 {
+		t.Errorf("IO priority = %v, expected best-effort level 7", attr.IOPrio)
+	}
+	if attr.OOMScoreAdj == nil || *attr.OOMScoreAdj != 1000 {
+		t.Errorf("OOM score adjustment = %v, expected 1000", attr.OOMScoreAdj)
+	}
+}
@@ -0,0 +1,258 @@
+package matrix
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/limiter"
+	"github.com/pmarchini/giogo/internal/summary"
+	"github.com/pmarchini/giogo/internal/utils"
+)
+
+// CpusetFlag is the limit flag pinning a combination to CPUs, combinations with disjoint cpusets may run in parallel
+const CpusetFlag = "cpuset"
+
+// Format is the output format of the matrix table
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatCSV  Format = "csv"
+	FormatJSON Format = "json"
+)
+
+// ParseFormat parses one of text, csv or json
+func ParseFormat(value string) (Format, error) {
+	switch format := Format(value); format {
+	case FormatText, FormatCSV, FormatJSON:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid matrix format %q, expected text, csv or json", value)
+	}
+}
+
+// Parameter is a limit flag swept by the matrix and the values it takes
+type Parameter struct {
+	Flag   string
+	Values []string
+}
+
+// Setting is the value of a limit flag in a combination
+type Setting struct {
+	Flag  string `json:"flag"`
+	Value string `json:"value"`
+}
+
+// Combination is a point of the matrix, a value for each swept flag
+type Combination []Setting
+
+// Value returns the value of flag in the combination, empty when the flag is not swept
+func (c Combination) Value(flag string) string {
+	for _, s := range c {
+		if s.Flag == flag {
+			return s.Value
+		}
+	}
+	return ""
+}
+
+// String formats the combination as giogo flags
+func (c Combination) String() string {
+	var flags []string
+	for _, s := range c {
+		flags = append(flags, fmt.Sprintf("--%s=%s", s.Flag, s.Value))
+	}
+	return strings.Join(flags, " ")
+}
+
+// Expand returns the cartesian product of the parameters, the last parameter varying the fastest.
+// Parameters without values are ignored, without any parameter the matrix holds a single unlimited combination.
+func Expand(parameters []Parameter) []Combination {
+	combinations := []Combination{nil}
+	for _, p := range parameters {
+		if len(p.Values) == 0 {
+			continue
+		}
+		var expanded []Combination
+		for _, c := range combinations {
+			for _, v := range p.Values {
+				combination := append(append(Combination{}, c...), Setting{Flag: p.Flag, Value: v})
+				expanded = append(expanded, combination)
+			}
+		}
+		combinations = expanded
+	}
+	return combinations
+}
+
+// Overlap tells whether two combinations may compete for the same CPUs.
+// A combination without a cpuset may run on every CPU, so it overlaps any other.
+func Overlap(a, b Combination) bool {
+	cpusA, errA := limiter.ParseCPUList(a.Value(CpusetFlag))
+	cpusB, errB := limiter.ParseCPUList(b.Value(CpusetFlag))
+	if errA != nil || errB != nil {
+		return true
+	}
+	pinned := make(map[int]bool, len(cpusA))
+	for _, cpu := range cpusA {
+		pinned[cpu] = true
+	}
+	for _, cpu := range cpusB {
+		if pinned[cpu] {
+			return true
+		}
+	}
+	return false
+}
+
+// Row is the outcome of the run of a combination
+type Row struct {
+	Limits  Combination      `json:"limits"`
+	Summary *summary.Summary `json:"summary"`
+}
+
+// Matrix runs a command once per combination, each run in its own cgroup
+type Matrix struct {
+	Command      []string
+	Combinations []Combination
+	// Parallel is the maximum number of concurrent runs, only combinations with disjoint cpusets run concurrently
+	Parallel int
+	// Run runs the command under the limits of the combination, the result is nil when the cgroup could not be set up
+	Run func(index int, combination Combination) (*core.Result, error)
+	// Progress is where the progress is written, stderr when nil
+	Progress io.Writer
+}
+
+// Execute runs every combination and returns their rows in the order of the combinations.
+// A failed run is part of the outcome, it does not stop the matrix.
+func (m *Matrix) Execute() []Row {
+	progress := m.Progress
+	if progress == nil {
+		progress = os.Stderr
+	}
+	parallel := max(m.Parallel, 1)
+
+	rows := make([]Row, len(m.Combinations))
+	done := make(chan int)
+	running := make(map[int]bool)
+	var pending []int
+	for i := range m.Combinations {
+		pending = append(pending, i)
+	}
+	for len(pending) > 0 || len(running) > 0 {
+		// Start every pending combination that fits, in order
+		for i := 0; i < len(pending) && len(running) < parallel; {
+			index := pending[i]
+			if !m.fits(index, running) {
+				i++
+				continue
+			}
+			pending = append(pending[:i], pending[i+1:]...)
+			running[index] = true
+			fmt.Fprintf(progress, "giogo matrix: run %d/%d %s\n", index+1, len(m.Combinations), m.Combinations[index])
+			go func(index int) {
+				rows[index] = m.run(index)
+				done <- index
+			}(index)
+		}
+		delete(running, <-done)
+	}
+	return rows
+}
+
+func (m *Matrix) fits(index int, running map[int]bool) bool {
+	for other := range running {
+		if Overlap(m.Combinations[index], m.Combinations[other]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Matrix) run(index int) Row {
+	result, err := m.Run(index, m.Combinations[index])
+	if result == nil {
+		result = &core.Result{Command: m.Command, ExitCode: -1, Err: err}
+	}
+	return Row{Limits: m.Combinations[index], Summary: summary.New(result)}
+}
+
+// Table is the outcome of a matrix, one row per combination
+type Table struct {
+	// Flags are the swept limit flags, in the order of the columns
+	Flags []string
+	Rows  []Row
+}
+
+// Write writes the table in the given format
+func (t *Table) Write(w io.Writer, format Format) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(t.Rows)
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		header := append(append([]string{}, t.Flags...), "exit_code", "wall_time_usec", "cpu_time_usec", "cpu_throttled_usec", "memory_peak_bytes", "oom_kills", "error")
+		writer.Write(header)
+		for _, row := range t.Rows {
+			record := t.limits(row)
+			stats := row.Summary.Stats
+			if stats == nil {
+				stats = &core.Stats{}
+			}
+			record = append(record,
+				strconv.Itoa(row.Summary.ExitCode),
+				strconv.FormatUint(row.Summary.WallTimeUsec, 10),
+				strconv.FormatUint(stats.CPU.UsageUsec, 10),
+				strconv.FormatUint(stats.CPU.ThrottledUsec, 10),
+				strconv.FormatUint(stats.Memory.Peak, 10),
+				strconv.FormatUint(stats.Memory.Events.OOMKill, 10),
+				row.Summary.Error,
+			)
+			writer.Write(record)
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "%s\n", strings.Join(append(append([]string{}, t.Flags...), "exit", "wall time", "cpu time", "throttled", "memory peak", "oom kills", ""), "\t"))
+		for _, row := range t.Rows {
+			columns := t.limits(row)
+			columns = append(columns, strconv.Itoa(row.Summary.ExitCode), formatUsec(row.Summary.WallTimeUsec))
+			if stats := row.Summary.Stats; stats != nil {
+				columns = append(columns,
+					formatUsec(stats.CPU.UsageUsec),
+					formatUsec(stats.CPU.ThrottledUsec),
+					utils.FormatBytes(stats.Memory.Peak),
+					strconv.FormatUint(stats.Memory.Events.OOMKill, 10),
+				)
+			} else {
+				columns = append(columns, "-", "-", "-", "-")
+			}
+			columns = append(columns, row.Summary.Error)
+			fmt.Fprintf(tw, "%s\n", strings.Join(columns, "\t"))
+		}
+		return tw.Flush()
+	}
+}
+
+func (t *Table) limits(row Row) []string {
+	var values []string
+	for _, flag := range t.Flags {
+		values = append(values, row.Limits.Value(flag))
+	}
+	return values
+}
+
+func formatUsec(usec uint64) string {
+	return (time.Duration(usec) * time.Microsecond).Round(time.Millisecond).String()
+}
@@ -0,0 +1,145 @@
+package matrix_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/matrix"
+)
+
+func TestExpand(t *testing.T) {
+	combinations := matrix.Expand([]matrix.Parameter{
+		{Flag: "cpu", Values: []string{"0.5", "1"}},
+		{Flag: "cpuset"},
+		{Flag: "ram", Values: []string{"256m", "512m", "1g"}},
+	})
+	if len(combinations) != 6 {
+		t.Fatalf("expected 6 combinations, got %d", len(combinations))
+	}
+	var flags []string
+	for _, c := range combinations {
+		flags = append(flags, c.String())
+	}
+	expected := []string{
+		"--cpu=0.5 --ram=256m", "--cpu=0.5 --ram=512m", "--cpu=0.5 --ram=1g",
+		"--cpu=1 --ram=256m", "--cpu=1 --ram=512m", "--cpu=1 --ram=1g",
+	}
+	if strings.Join(flags, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %v, got %v", expected, flags)
+	}
+	if combinations[4].Value("ram") != "512m" || combinations[4].Value("cpuset") != "" {
+		t.Errorf("unexpected values of %s", combinations[4])
+	}
+
+	if none := matrix.Expand(nil); len(none) != 1 || len(none[0]) != 0 {
+		t.Errorf("expected a single unlimited combination, got %v", none)
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	pinned := func(cpus string) matrix.Combination {
+		return matrix.Combination{{Flag: matrix.CpusetFlag, Value: cpus}}
+	}
+	tests := []struct {
+		a, b     matrix.Combination
+		expected bool
+	}{
+		{pinned("0-1"), pinned("2-3"), false},
+		{pinned("0-1"), pinned("1,3"), true},
+		{pinned("0"), matrix.Combination{{Flag: "cpu", Value: "0.5"}}, true},
+		{nil, nil, true},
+	}
+	for _, tt := range tests {
+		if got := matrix.Overlap(tt.a, tt.b); got != tt.expected {
+			t.Errorf("Overlap(%s, %s) = %v, expected %v", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+func TestMatrixExecute(t *testing.T) {
+	combinations := matrix.Expand([]matrix.Parameter{
+		{Flag: "cpuset", Values: []string{"0", "1", "0-1"}},
+		{Flag: "ram", Values: []string{"1g"}},
+	})
+
+	var mu sync.Mutex
+	running, concurrent := map[string]bool{}, false
+	m := &matrix.Matrix{
+		Command:      []string{"make"},
+		Combinations: combinations,
+		Parallel:     3,
+		Run: func(index int, c matrix.Combination) (*core.Result, error) {
+			cpuset := c.Value("cpuset")
+			mu.Lock()
+			if cpuset == "0-1" && len(running) > 0 || running["0-1"] {
+				t.Errorf("%s ran alongside an overlapping combination", c)
+			}
+			running[cpuset] = true
+			concurrent = concurrent || len(running) > 1
+			mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			delete(running, cpuset)
+			mu.Unlock()
+
+			if index == 1 {
+				return nil, errors.New("error initializing cgroup manager")
+			}
+			return &core.Result{
+				Command:  []string{"make"},
+				WallTime: time.Second,
+				ExitCode: index,
+				Stats:    &core.Stats{Memory: core.MemoryStats{Peak: 2048}},
+			}, nil
+		},
+		Progress: new(bytes.Buffer),
+	}
+
+	rows := m.Execute()
+	if !concurrent {
+		t.Errorf("expected the disjoint cpusets to run concurrently")
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+	if rows[0].Limits.Value("cpuset") != "0" || rows[2].Summary.ExitCode != 2 || rows[2].Summary.Stats.Memory.Peak != 2048 {
+		t.Errorf("unexpected rows: %+v %+v", rows[0], rows[2])
+	}
+	if rows[1].Summary.ExitCode != -1 || rows[1].Summary.Error != "error initializing cgroup manager" {
+		t.Errorf("expected the failed setup in the row, got %+v", rows[1].Summary)
+	}
+
+	table := &matrix.Table{Flags: []string{"cpuset", "ram"}, Rows: rows}
+	var csv bytes.Buffer
+	if err := table.Write(&csv, matrix.FormatCSV); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(csv.String()), "\n")
+	if lines[0] != "cpuset,ram,exit_code,wall_time_usec,cpu_time_usec,cpu_throttled_usec,memory_peak_bytes,oom_kills,error" {
+		t.Errorf("unexpected CSV header: %s", lines[0])
+	}
+	if lines[1] != "0,1g,0,1000000,0,0,2048,0," || lines[2] != "1,1g,-1,0,0,0,0,0,error initializing cgroup manager" || lines[3] != "0-1,1g,2,1000000,0,0,2048,0," {
+		t.Errorf("unexpected CSV:\n%s", csv.String())
+	}
+
+	var text bytes.Buffer
+	if err := table.Write(&text, matrix.FormatText); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(text.String(), "cpuset  ram  exit  wall time") || !strings.Contains(text.String(), "2.0k") {
+		t.Errorf("unexpected text:\n%s", text.String())
+	}
+
+	var js bytes.Buffer
+	if err := table.Write(&js, matrix.FormatJSON); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(js.String(), `"flag": "cpuset"`) || !strings.Contains(js.String(), `"exit_code": 2`) {
+		t.Errorf("unexpected JSON:\n%s", js.String())
+	}
+}
@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pmarchini/giogo/internal/core"
+)
+
+// ContentType is the content type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// RunLabel is the label holding the name of the run, it is added to every metric
+const RunLabel = "run"
+
+// reservedLabels are the label names giogo uses itself
+var reservedLabels = map[string]bool{RunLabel: true, "device": true, "event": true, "resource": true, "kind": true}
+
+// ValidateLabels checks that no user label clashes with the labels giogo uses itself
+func ValidateLabels(labels []core.Label) error {
+	for _, label := range labels {
+		if reservedLabels[label.Name] {
+			return fmt.Errorf("label %q is reserved", label.Name)
+		}
+	}
+	return nil
+}
+
+type sample struct {
+	labels []core.Label
+	value  float64
+}
+
+type family struct {
+	name, help, kind string
+	samples          []sample
+}
+
+// families converts the stats to metric families, every sample gets the common labels
+func families(stats *core.Stats, common []core.Label) []family {
+	with := func(extra ...core.Label) []core.Label {
+		return append(append([]core.Label{}, common...), extra...)
+	}
+	single := func(name, help, kind string, value float64) family {
+		return family{name: name, help: help, kind: kind, samples: []sample{{labels: with(), value: value}}}
+	}
+	seconds := func(usec uint64) float64 {
+		return float64(usec) / 1e6
+	}
+
+	fs := []family{
+		single("giogo_cpu_usage_seconds_total", "Total CPU time consumed by the group.", "counter", seconds(stats.CPU.UsageUsec)),
+		single("giogo_cpu_user_seconds_total", "CPU time consumed by the group in user mode.", "counter", seconds(stats.CPU.UserUsec)),
+		single("giogo_cpu_system_seconds_total", "CPU time consumed by the group in kernel mode.", "counter", seconds(stats.CPU.SystemUsec)),
+		single("giogo_cpu_periods_total", "Elapsed CPU quota enforcement periods.", "counter", float64(stats.CPU.Periods)),
+		single("giogo_cpu_throttled_periods_total", "CPU quota enforcement periods in which the group was throttled.", "counter", float64(stats.CPU.ThrottledPeriods)),
+		single("giogo_cpu_throttled_seconds_total", "Total time the group was throttled.", "counter", seconds(stats.CPU.ThrottledUsec)),
+		single("giogo_memory_usage_bytes", "Current memory usage of the group.", "gauge", float64(stats.Memory.Current)),
+	}
+	// memory.peak is read as 0 before Linux 5.19, the metric is left out rather than reporting an empty group
+	if peak := stats.Memory.Peak; peak != 0 {
+		fs = append(fs, single("giogo_memory_peak_bytes", "Peak memory usage of the group.", "gauge", float64(peak)))
+	}
+	if limit := stats.Memory.Limit; limit != 0 && limit != math.MaxUint64 {
+		fs = append(fs, single("giogo_memory_limit_bytes", "Memory limit of the group.", "gauge", float64(limit)))
+	}
+	if ws := stats.Memory.WorkingSet; ws != nil {
+		fs = append(fs, single("giogo_memory_working_set_bytes", "Estimated working set of the group.", "gauge", float64(ws.Current)))
+	}
+
+	events := family{name: "giogo_memory_events_total", help: "Memory events of the group (memory.events).", kind: "counter"}
+	for _, event := range []struct {
+		name  string
+		value uint64
+	}{
+		{"low", stats.Memory.Events.Low},
+		{"high", stats.Memory.Events.High},
+		{"max", stats.Memory.Events.Max},
+		{"oom", stats.Memory.Events.OOM},
+		{"oom_kill", stats.Memory.Events.OOMKill},
+	} {
+		events.samples = append(events.samples, sample{labels: with(core.Label{Name: "event", Value: event.name}), value: float64(event.value)})
+	}
+	fs = append(fs, events)
+
+	readBytes := family{name: "giogo_io_read_bytes_total", help: "Bytes read by the group per device.", kind: "counter"}
+	writeBytes := family{name: "giogo_io_write_bytes_total", help: "Bytes written by the group per device.", kind: "counter"}
+	reads := family{name: "giogo_io_reads_total", help: "Read operations of the group per device.", kind: "counter"}
+	writes := family{name: "giogo_io_writes_total", help: "Write operations of the group per device.", kind: "counter"}
+	for _, device := range stats.IO {
+		labels := with(core.Label{Name: "device", Value: fmt.Sprintf("%d:%d", device.Major, device.Minor)})
+		readBytes.samples = append(readBytes.samples, sample{labels: labels, value: float64(device.RBytes)})
+		writeBytes.samples = append(writeBytes.samples, sample{labels: labels, value: float64(device.WBytes)})
+		reads.samples = append(reads.samples, sample{labels: labels, value: float64(device.RIOs)})
+		writes.samples = append(writes.samples, sample{labels: labels, value: float64(device.WIOs)})
+	}
+	fs = append(fs, readBytes, writeBytes, reads, writes)
+
+	fs = append(fs, single("giogo_pids", "Current number of tasks in the group.", "gauge", float64(stats.Pids.Current)))
+	if limit := stats.Pids.Limit; limit != 0 && limit != math.MaxUint64 {
+		fs = append(fs, single("giogo_pids_limit", "Maximum number of tasks in the group.", "gauge", float64(limit)))
+	}
+
+	stalled := family{name: "giogo_pressure_stalled_seconds_total", help: "Total time tasks of the group were stalled on a resource.", kind: "counter"}
+	avg10 := family{name: "giogo_pressure_avg10_ratio", help: "Share of the last 10 seconds tasks of the group were stalled on a resource.", kind: "gauge"}
+	avg60 := family{name: "giogo_pressure_avg60_ratio", help: "Share of the last 60 seconds tasks of the group were stalled on a resource.", kind: "gauge"}
+	avg300 := family{name: "giogo_pressure_avg300_ratio", help: "Share of the last 300 seconds tasks of the group were stalled on a resource.", kind: "gauge"}
+	for _, resource := range []struct {
+		name     string
+		pressure core.PressureStats
+	}{
+		{"cpu", stats.PSI.CPU},
+		{"memory", stats.PSI.Memory},
+		{"io", stats.PSI.IO},
+	} {
+		for _, kind := range []struct {
+			name string
+			data core.PressureData
+		}{
+			{"some", resource.pressure.Some},
+			{"full", resource.pressure.Full},
+		} {
+			labels := with(core.Label{Name: "resource", Value: resource.name}, core.Label{Name: "kind", Value: kind.name})
+			stalled.samples = append(stalled.samples, sample{labels: labels, value: seconds(kind.data.TotalUsec)})
+			avg10.samples = append(avg10.samples, sample{labels: labels, value: kind.data.Avg10 / 100})
+			avg60.samples = append(avg60.samples, sample{labels: labels, value: kind.data.Avg60 / 100})
+			avg300.samples = append(avg300.samples, sample{labels: labels, value: kind.data.Avg300 / 100})
+		}
+	}
+	fs = append(fs, stalled, avg10, avg60, avg300)
+
+	return fs
+}
+
+// Write writes the stats in the Prometheus text exposition format, every metric gets the given labels
+func Write(w io.Writer, stats *core.Stats, labels []core.Label) error {
+	var b strings.Builder
+	for _, f := range families(stats, labels) {
+		if len(f.samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n", f.name, f.help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", f.name, f.kind)
+		for _, s := range f.samples {
+			b.WriteString(f.name)
+			writeLabels(&b, s.labels)
+			b.WriteByte(' ')
+			b.WriteString(strconv.FormatFloat(s.value, 'g', -1, 64))
+			b.WriteByte('\n')
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeLabels(b *strings.Builder, labels []core.Label) {
+	if len(labels) == 0 {
+		return
+	}
+	b.WriteByte('{')
+	for i, label := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(b, `%s="%s"`, label.Name, labelValueEscaper.Replace(label.Value))
+	}
+	b.WriteByte('}')
+}
@@ -0,0 +1,143 @@
+package metrics_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/metrics"
+)
+
+func testStats() *core.Stats {
+	return &core.Stats{
+		CPU: core.CPUStats{UsageUsec: 1500000, UserUsec: 1000000, SystemUsec: 500000},
+		Memory: core.MemoryStats{
+			Current: 1024,
+			Peak:    4096,
+			Limit:   math.MaxUint64,
+			Events:  core.MemoryEventsStats{OOMKill: 1},
+		},
+		IO:   []core.IOStats{{Major: 8, Minor: 0, RBytes: 100, WBytes: 200}},
+		Pids: core.PidsStats{Current: 3, Limit: 64},
+		PSI: core.PSIStats{
+			Memory: core.PressureStats{Some: core.PressureData{Avg10: 12.5, TotalUsec: 2000000}},
+		},
+	}
+}
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	labels := []core.Label{{Name: "run", Value: "giogo-cgroup-1"}, {Name: "team", Value: `a "quoted"\ value`}}
+	if err := metrics.Write(&buf, testStats(), labels); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+
+	common := `run="giogo-cgroup-1",team="a \"quoted\"\\ value"`
+	for _, expected := range []string{
+		"# TYPE giogo_cpu_usage_seconds_total counter\n",
+		"giogo_cpu_usage_seconds_total{" + common + "} 1.5\n",
+		"giogo_memory_peak_bytes{" + common + "} 4096\n",
+		"giogo_memory_events_total{" + common + `,event="oom_kill"} 1` + "\n",
+		"giogo_io_write_bytes_total{" + common + `,device="8:0"} 200` + "\n",
+		"giogo_pids_limit{" + common + "} 64\n",
+		"giogo_pressure_stalled_seconds_total{" + common + `,resource="memory",kind="some"} 2` + "\n",
+		"giogo_pressure_avg10_ratio{" + common + `,resource="memory",kind="some"} 0.125` + "\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected output to contain %q, got:\n%s", expected, out)
+		}
+	}
+	// An unlimited memory limit is not exported
+	if strings.Contains(out, "giogo_memory_limit_bytes") {
+		t.Errorf("unexpected memory limit in output:\n%s", out)
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	if err := metrics.ValidateLabels([]core.Label{{Name: "team", Value: "ci"}}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, name := range []string{"run", "device", "event", "resource", "kind"} {
+		if err := metrics.ValidateLabels([]core.Label{{Name: name}}); err == nil {
+			t.Errorf("expected error for reserved label %q", name)
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "metrics.sock")
+	listener, err := metrics.Listen("unix:" + socket)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	manager := new(core.MockCgroupManager)
+	manager.On("Stats").Return(testStats(), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	server := &metrics.Server{Listener: listener, Name: "giogo-cgroup-1"}
+	go func() {
+		done <- server.Watch(ctx, manager)
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}
+	resp, err := client.Get("http://giogo/metrics")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != metrics.ContentType {
+		t.Errorf("unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(string(body), `giogo_pids{run="giogo-cgroup-1"} 3`) {
+		t.Errorf("unexpected body:\n%s", body)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+	}
+	manager.AssertCalled(t, "Stats")
+}
+
+func TestTextfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "giogo.prom")
+	textfile := &metrics.Textfile{Path: path, Labels: []core.Label{{Name: "team", Value: "ci"}}}
+	if err := textfile.Report(&core.Result{Name: "giogo-cgroup-1", Stats: testStats()}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(content), `giogo_memory_usage_bytes{run="giogo-cgroup-1",team="ci"} 1024`) {
+		t.Errorf("unexpected content:\n%s", content)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("expected only the textfile to be left, got %d entries", len(entries))
+	}
+}
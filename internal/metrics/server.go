@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+)
+
+// shutdownTimeout bounds the time in-flight scrapes get once the command exits
+const shutdownTimeout = 2 * time.Second
+
+// Listen opens the listener of the metrics endpoint.
+// Addresses prefixed with unix: or starting with / are unix sockets, anything else is a TCP address.
+func Listen(address string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		return net.Listen("unix", path)
+	}
+	if strings.HasPrefix(address, "/") {
+		return net.Listen("unix", address)
+	}
+	return net.Listen("tcp", address)
+}
+
+// Server serves the metrics of the running group on /metrics
+type Server struct {
+	Listener net.Listener
+	// Name is the name of the run, exported as the run label
+	Name   string
+	Labels []core.Label
+}
+
+// Watch serves the metrics until the command exits
+func (s *Server) Watch(ctx context.Context, manager core.CgroupManager) error {
+	labels := append([]core.Label{{Name: RunLabel, Value: s.Name}}, s.Labels...)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		stats, err := manager.Stats()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("error reading cgroup stats: %v", err), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", ContentType)
+		Write(w, stats, labels)
+	})
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(s.Listener)
+
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+	return nil
+}
+
+// Textfile writes the final metrics of the run for the node_exporter textfile collector
+type Textfile struct {
+	// Path must end in .prom to be picked up by the collector
+	Path   string
+	Labels []core.Label
+}
+
+// Report writes the metrics atomically, so the collector never reads a partial file
+func (t *Textfile) Report(result *core.Result) error {
+	if result.Stats == nil {
+		return nil
+	}
+	labels := append([]core.Label{{Name: RunLabel, Value: result.Name}}, t.Labels...)
+
+	tmp, err := os.CreateTemp(filepath.Dir(t.Path), ".giogo-metrics-*")
+	if err != nil {
+		return fmt.Errorf("error creating metrics textfile: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := Write(tmp, result.Stats, labels); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing metrics textfile: %v", err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing metrics textfile: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing metrics textfile: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), t.Path); err != nil {
+		return fmt.Errorf("error writing metrics textfile: %v", err)
+	}
+	return nil
+}
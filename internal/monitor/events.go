@@ -0,0 +1,345 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"golang.org/x/sys/unix"
+)
+
+// EventFormat is the output format of the cgroup events
+type EventFormat string
+
+const (
+	EventFormatText      EventFormat = "text"
+	EventFormatJSONLines EventFormat = "jsonl"
+)
+
+// ParseEventFormat parses one of text or jsonl
+func ParseEventFormat(value string) (EventFormat, error) {
+	switch format := EventFormat(value); format {
+	case EventFormatText, EventFormatJSONLines:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid events format %q, expected text or jsonl", value)
+	}
+}
+
+// EventFiles are the flat keyed files of the group whose changes are reported as events
+var EventFiles = []string{"memory.events", "pids.events", "cgroup.events"}
+
+// eventPollTimeout bounds how long the watcher waits before checking whether the command exited
+const eventPollTimeout = 200 * time.Millisecond
+
+// KilledProcess is the process the kernel OOM killer picked, as logged in the kernel ring buffer
+type KilledProcess struct {
+	PID  int    `json:"pid"`
+	Name string `json:"name"`
+}
+
+// Event is a change of a counter or state in one of the event files of the group
+type Event struct {
+	Time time.Time `json:"time"`
+	// File is the file the change was read from, e.g. memory.events
+	File  string `json:"file"`
+	Name  string `json:"event"`
+	Value uint64 `json:"value"`
+	// Delta is the change since the previous value, negative when a state such as populated is cleared
+	Delta int64 `json:"delta"`
+	// Process is set on oom_kill events when the kernel log could be read
+	Process *KilledProcess `json:"process,omitempty"`
+	// Labels are the labels of the run, only set in the JSON Lines written by EventWatcher
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// String formats the event for humans
+func (e *Event) String() string {
+	s := fmt.Sprintf("giogo event: %s %s=%d (%+d)", e.File, e.Name, e.Value, e.Delta)
+	if e.Process != nil {
+		s += fmt.Sprintf(", killed %s (pid %d)", e.Process.Name, e.Process.PID)
+	}
+	return s
+}
+
+// keyedValue is a line of a flat keyed cgroup file
+type keyedValue struct {
+	key   string
+	value uint64
+}
+
+// parseFlatKeyed parses the "key value" lines of files such as memory.events
+func parseFlatKeyed(content string) []keyedValue {
+	var values []keyedValue
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		values = append(values, keyedValue{key: fields[0], value: value})
+	}
+	return values
+}
+
+// ParseKmsgOOMKill parses a /dev/kmsg record and returns the killed process when it is the OOM kill summary of
+// a task in the given cgroup, relative to the unified mountpoint (e.g. /giogo.slice/giogo-cgroup.slice/giogo-cgroup-1.slice).
+// The kernel logs one summary per kill: "oom-kill:constraint=...,task_memcg=/path,task=name,pid=1234,uid=0".
+func ParseKmsgOOMKill(record, cgroup string) (*KilledProcess, bool) {
+	// Records are "priority,sequence,timestamp,flags;message"
+	_, message, found := strings.Cut(record, ";")
+	if !found {
+		return nil, false
+	}
+	summary, found := strings.CutPrefix(strings.TrimSpace(message), "oom-kill:")
+	if !found {
+		return nil, false
+	}
+
+	var memcg string
+	process := &KilledProcess{}
+	for _, field := range strings.Split(summary, ",") {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "task_memcg":
+			memcg = value
+		case "task":
+			process.Name = value
+		case "pid":
+			process.PID, _ = strconv.Atoi(value)
+		}
+	}
+	// The killed task can also live in a child of the group
+	if memcg != cgroup && !strings.HasPrefix(memcg, cgroup+"/") {
+		return nil, false
+	}
+	return process, true
+}
+
+// EventWatcher reports the changes of memory.events, pids.events and cgroup.events while the command runs.
+// The files are watched with inotify, so events are reported as soon as the kernel updates them.
+type EventWatcher struct {
+	Format EventFormat
+	// Path is the file the events are written to, stderr when empty so the command output is left untouched
+	Path string
+	// Labels are set in every JSON event, so that the events of the runs can be told apart
+	Labels []core.Label
+}
+
+// Watch reports the events of the group until the command exits
+func (e *EventWatcher) Watch(ctx context.Context, manager core.CgroupManager) error {
+	path := manager.Path()
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "cgroup events ignored: event files require cgroup v2")
+		return nil
+	}
+
+	var w io.Writer = os.Stderr
+	if e.Path != "" {
+		f, err := os.Create(e.Path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error creating events file: %v\n", err)
+			return nil
+		}
+		defer f.Close()
+		w = f
+	}
+
+	err := WatchEvents(ctx, path, func(events []Event) {
+		for i := range events {
+			var err error
+			if e.Format == EventFormatJSONLines {
+				events[i].Labels = core.LabelMap(e.Labels)
+				err = json.NewEncoder(w).Encode(&events[i])
+			} else {
+				_, err = fmt.Fprintln(w, events[i].String())
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error writing events: %v\n", err)
+			}
+		}
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cgroup events ignored: %v\n", err)
+	}
+	return nil
+}
+
+// WatchEvents watches the event files of the cgroup in path with inotify and calls emit with the changes until ctx is done.
+// Where /dev/kmsg is readable, oom_kill events carry the killed process.
+func WatchEvents(ctx context.Context, path string, emit func([]Event)) error {
+	inotifyFd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(inotifyFd)
+
+	state := &eventState{
+		cgroup:   strings.TrimPrefix(path, core.UnifiedMountpoint),
+		previous: make(map[string]map[string]uint64),
+		kmsgFd:   openKmsg(),
+	}
+	if state.kmsgFd >= 0 {
+		defer unix.Close(state.kmsgFd)
+	}
+	var files []string
+	for _, name := range EventFiles {
+		file := filepath.Join(path, name)
+		if _, err := unix.InotifyAddWatch(inotifyFd, file, unix.IN_MODIFY); err != nil {
+			// The file is missing when its controller is not enabled for the group
+			continue
+		}
+		files = append(files, file)
+	}
+	// The first read is the baseline, events only report what changed while the command ran
+	state.read(files)
+
+	fds := []unix.PollFd{{Fd: int32(inotifyFd), Events: unix.POLLIN}}
+	if state.kmsgFd >= 0 {
+		fds = append(fds, unix.PollFd{Fd: int32(state.kmsgFd), Events: unix.POLLIN})
+	}
+	buf := make([]byte, 4096)
+	for {
+		select {
+		case <-ctx.Done():
+			// The last events, such as an OOM kill ending the command, can land right before it exits
+			if events := state.read(files); len(events) > 0 {
+				emit(events)
+			}
+			return nil
+		default:
+		}
+
+		n, err := unix.Poll(fds, int(eventPollTimeout.Milliseconds()))
+		if err == unix.EINTR || n == 0 {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if len(fds) > 1 && fds[1].Revents&unix.POLLIN != 0 {
+			state.readKmsg()
+		}
+		if fds[0].Revents&unix.POLLIN != 0 {
+			// Drain the notifications, the files are read again as a whole
+			for {
+				if _, err := unix.Read(inotifyFd, buf); err != nil {
+					break
+				}
+			}
+			if events := state.read(files); len(events) > 0 {
+				emit(events)
+			}
+		}
+	}
+}
+
+// eventState keeps the last values of the event files and the OOM kills read from the kernel log
+type eventState struct {
+	cgroup   string
+	previous map[string]map[string]uint64
+	kmsgFd   int
+	killed   []KilledProcess
+}
+
+// read reads the event files and returns the changes since the previous read
+func (s *eventState) read(files []string) []Event {
+	var events []Event
+	now := time.Now()
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		values := parseFlatKeyed(string(content))
+		if len(values) == 0 {
+			// A file caught while being rewritten, the next notification reads it again
+			continue
+		}
+		name := filepath.Base(file)
+		previous, seen := s.previous[name]
+		current := make(map[string]uint64)
+		for _, kv := range values {
+			current[kv.key] = kv.value
+			if !seen || previous[kv.key] == kv.value {
+				continue
+			}
+			event := Event{Time: now, File: name, Name: kv.key, Value: kv.value, Delta: int64(kv.value) - int64(previous[kv.key])}
+			if kv.key == "oom_kill" {
+				events = append(events, s.oomKillEvents(event)...)
+				continue
+			}
+			events = append(events, event)
+		}
+		s.previous[name] = current
+	}
+	return events
+}
+
+// oomKillEvents attaches the killed processes to an oom_kill event, one event per kill when they are known
+func (s *eventState) oomKillEvents(event Event) []Event {
+	// The kernel logs the kill summary before counting it, so the matching records are already readable
+	s.readKmsg()
+	if len(s.killed) == 0 {
+		return []Event{event}
+	}
+	var events []Event
+	for event.Delta > 0 && len(s.killed) > 0 {
+		e := event
+		e.Delta = 1
+		e.Value = event.Value - uint64(event.Delta) + 1
+		e.Process = &s.killed[0]
+		s.killed = s.killed[1:]
+		events = append(events, e)
+		event.Delta--
+	}
+	if event.Delta > 0 {
+		events = append(events, event)
+	}
+	return events
+}
+
+// readKmsg reads the pending kernel log records and keeps the OOM kills of the group
+func (s *eventState) readKmsg() {
+	if s.kmsgFd < 0 {
+		return
+	}
+	// Every read returns a single record
+	buf := make([]byte, 8192)
+	for {
+		n, err := unix.Read(s.kmsgFd, buf)
+		if err == unix.EPIPE {
+			// Records were overwritten before being read, go on with the next ones
+			continue
+		}
+		if err != nil || n <= 0 {
+			return
+		}
+		if process, ok := ParseKmsgOOMKill(string(buf[:n]), s.cgroup); ok {
+			s.killed = append(s.killed, *process)
+		}
+	}
+}
+
+// openKmsg opens the kernel log positioned after the existing records, it returns -1 when it is not readable
+func openKmsg() int {
+	fd, err := unix.Open("/dev/kmsg", unix.O_RDONLY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1
+	}
+	if _, err := unix.Seek(fd, 0, io.SeekEnd); err != nil {
+		unix.Close(fd)
+		return -1
+	}
+	return fd
+}
@@ -0,0 +1,111 @@
+package monitor_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/monitor"
+)
+
+func TestParseKmsgOOMKill(t *testing.T) {
+	cgroup := "/giogo.slice/giogo-cgroup.slice/giogo-cgroup-1.slice"
+	record := "6,1234,5678901,-;oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=/,mems_allowed=0,oom_memcg=" + cgroup +
+		",task_memcg=" + cgroup + "/worker,task=python3,pid=4242,uid=0"
+
+	process, ok := monitor.ParseKmsgOOMKill(record, cgroup)
+	if !ok {
+		t.Fatalf("expected the record to match")
+	}
+	if process.PID != 4242 || process.Name != "python3" {
+		t.Errorf("unexpected process: %+v", process)
+	}
+
+	if _, ok := monitor.ParseKmsgOOMKill(record, "/giogo.slice/giogo-cgroup.slice/giogo-cgroup-12.slice"); ok {
+		t.Errorf("expected a kill of another group not to match")
+	}
+	if _, ok := monitor.ParseKmsgOOMKill("6,1235,5678902,-;Memory cgroup out of memory: Killed process 4242 (python3)", cgroup); ok {
+		t.Errorf("expected other records not to match")
+	}
+}
+
+func TestEventWatcherWatch(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	write("memory.events", "low 0\nhigh 2\nmax 0\noom 0\noom_kill 0\n")
+	write("cgroup.events", "populated 1\nfrozen 0\n")
+
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("Path").Return(dir)
+
+	eventsFile := filepath.Join(dir, "events.jsonl")
+	watcher := &monitor.EventWatcher{Format: monitor.EventFormatJSONLines, Path: eventsFile, Labels: []core.Label{{Name: "team", Value: "infra"}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- watcher.Watch(ctx, mockManager)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	write("memory.events", "low 0\nhigh 5\nmax 1\noom 1\noom_kill 1\n")
+	time.Sleep(100 * time.Millisecond)
+	write("cgroup.events", "populated 0\nfrozen 0\n")
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	f, err := os.Open(eventsFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+	var events []monitor.Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event monitor.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+
+	expected := []struct {
+		file, name string
+		value      uint64
+		delta      int64
+	}{
+		{"memory.events", "high", 5, 3},
+		{"memory.events", "max", 1, 1},
+		{"memory.events", "oom", 1, 1},
+		{"memory.events", "oom_kill", 1, 1},
+		{"cgroup.events", "populated", 0, -1},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %+v", len(expected), events)
+	}
+	for i, e := range expected {
+		if events[i].File != e.file || events[i].Name != e.name || events[i].Value != e.value || events[i].Delta != e.delta ||
+			events[i].Labels["team"] != "infra" {
+			t.Errorf("event %d: expected %+v, got %+v", i, e, events[i])
+		}
+	}
+}
+
+func TestEventString(t *testing.T) {
+	event := &monitor.Event{File: "memory.events", Name: "oom_kill", Value: 2, Delta: 1, Process: &monitor.KilledProcess{PID: 42, Name: "stress"}}
+	expected := "giogo event: memory.events oom_kill=2 (+1), killed stress (pid 42)"
+	if event.String() != expected {
+		t.Errorf("unexpected string:\n got %s\nwant %s", event.String(), expected)
+	}
+}
@@ -0,0 +1,124 @@
+package monitor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/limiter"
+)
+
+const (
+	// DefaultIOInterval is the time between two reads of the IO counters of the group
+	DefaultIOInterval = time.Second
+	// ioSaturation is the share of its throttle above which a bandwidth counts as saturated
+	ioSaturation = 0.9
+)
+
+// IOTracker reads the IO counters of the group every Interval while the command runs and annotates the stats with
+// the name of every block device and the bandwidths the group achieved on it, to be compared with the throttles
+// of io.max. An interval whose bandwidth is close to its throttle counts as saturated: the throttle held the
+// command back.
+type IOTracker struct {
+	Interval time.Duration
+	// BlockDir is where the block devices are listed, /sys/block when empty
+	BlockDir string
+
+	mu      sync.Mutex
+	names   map[[2]int64]string
+	rates   map[[2]int64]*core.IORateStats
+	samples map[[2]int64]core.IOStats
+	time    time.Time
+}
+
+// Annotate names the devices of the stats and sets the bandwidths tracked so far
+func (t *IOTracker) Annotate(stats *core.Stats) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range stats.IO {
+		device := &stats.IO[i]
+		key := [2]int64{device.Major, device.Minor}
+		device.Device = t.names[key]
+		if rates, ok := t.rates[key]; ok {
+			copied := *rates
+			device.Rates = &copied
+		}
+	}
+}
+
+// Watch reads the counters right away, then every Interval until the command exits
+func (t *IOTracker) Watch(ctx context.Context, manager core.CgroupManager) error {
+	blockDir := t.BlockDir
+	if blockDir == "" {
+		blockDir = "/sys/block"
+	}
+	// Devices without a name are shown by their major:minor numbers
+	devices, _ := limiter.GetBlockDevices(blockDir)
+	t.mu.Lock()
+	t.names = make(map[[2]int64]string, len(devices))
+	for _, device := range devices {
+		t.names[[2]int64{device.Major, device.Minor}] = device.Name
+	}
+	t.mu.Unlock()
+
+	interval := t.Interval
+	if interval == 0 {
+		interval = DefaultIOInterval
+	}
+	t.read(manager, time.Now())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			t.read(manager, now)
+		}
+	}
+}
+
+func (t *IOTracker) read(manager core.CgroupManager, now time.Time) {
+	stats, err := manager.Stats()
+	if err != nil {
+		return
+	}
+	t.Sample(stats.IO, now)
+}
+
+// Sample updates the bandwidths with the counters read at now
+func (t *IOTracker) Sample(devices []core.IOStats, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rates == nil {
+		t.rates = make(map[[2]int64]*core.IORateStats)
+	}
+	elapsed := now.Sub(t.time)
+	samples := make(map[[2]int64]core.IOStats, len(devices))
+	for _, device := range devices {
+		key := [2]int64{device.Major, device.Minor}
+		samples[key] = device
+		previous, ok := t.samples[key]
+		if !ok || elapsed <= 0 {
+			continue
+		}
+		rates, ok := t.rates[key]
+		if !ok {
+			rates = &core.IORateStats{}
+			t.rates[key] = rates
+		}
+		rates.Read = float64(device.RBytes-min(device.RBytes, previous.RBytes)) / elapsed.Seconds()
+		rates.Write = float64(device.WBytes-min(device.WBytes, previous.WBytes)) / elapsed.Seconds()
+		rates.PeakRead = max(rates.PeakRead, rates.Read)
+		rates.PeakWrite = max(rates.PeakWrite, rates.Write)
+		if device.RBpsMax > 0 && rates.Read >= ioSaturation*float64(device.RBpsMax) {
+			rates.ReadSaturatedUsec += uint64(elapsed.Microseconds())
+		}
+		if device.WBpsMax > 0 && rates.Write >= ioSaturation*float64(device.WBpsMax) {
+			rates.WriteSaturatedUsec += uint64(elapsed.Microseconds())
+		}
+	}
+	t.samples = samples
+	t.time = now
+}
@@ -0,0 +1,65 @@
+package monitor_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/monitor"
+)
+
+func TestIOTrackerSample(t *testing.T) {
+	tracker := &monitor.IOTracker{}
+	now := time.Now()
+	sample := func(rbytes, wbytes uint64, at time.Duration) {
+		tracker.Sample([]core.IOStats{{Major: 8, Minor: 0, RBytes: rbytes, WBytes: wbytes, WBpsMax: 1000}}, now.Add(at))
+	}
+	sample(0, 0, 0)
+	sample(4000, 1900, 2*time.Second)
+	sample(5000, 1950, 3*time.Second)
+
+	stats := &core.Stats{IO: []core.IOStats{{Major: 8, Minor: 0}, {Major: 8, Minor: 16}}}
+	tracker.Annotate(stats)
+	rates := stats.IO[0].Rates
+	if rates == nil {
+		t.Fatalf("expected the rates of 8:0")
+	}
+	expected := core.IORateStats{Read: 1000, Write: 50, PeakRead: 2000, PeakWrite: 950, WriteSaturatedUsec: 2000000}
+	if *rates != expected {
+		t.Errorf("expected %+v, got %+v", expected, *rates)
+	}
+	if stats.IO[1].Rates != nil {
+		t.Errorf("expected no rates for a device the group did not use, got %+v", stats.IO[1].Rates)
+	}
+}
+
+func TestIOTrackerWatch(t *testing.T) {
+	blockDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(blockDir, "sda"), 0755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(blockDir, "sda", "dev"), []byte("8:0\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("Stats").Return(&core.Stats{IO: []core.IOStats{{Major: 8, Minor: 0, RBytes: 4096}}}, nil)
+	tracker := &monitor.IOTracker{Interval: 10 * time.Millisecond, BlockDir: blockDir}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := tracker.Watch(ctx, mockManager); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stats := &core.Stats{IO: []core.IOStats{{Major: 8, Minor: 0, RBytes: 4096}, {Major: 253, Minor: 1}}}
+	tracker.Annotate(stats)
+	if stats.IO[0].Device != "sda" || stats.IO[1].Device != "" {
+		t.Errorf("expected 8:0 to be named sda and 253:1 to stay unnamed, got %+v", stats.IO)
+	}
+	if rates := stats.IO[0].Rates; rates == nil || rates.Read != 0 {
+		t.Errorf("expected a zero read rate from unchanged counters, got %+v", rates)
+	}
+}
@@ -0,0 +1,229 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/utils"
+)
+
+const (
+	// DefaultLeakWindow is the span of the trend fitted over the memory usage
+	DefaultLeakWindow = 10 * time.Minute
+	// leakSamplesPerWindow is the number of samples a window holds
+	leakSamplesPerWindow = 30
+	// MinLeakWindow is the shortest window, sampled every millisecond
+	MinLeakWindow = leakSamplesPerWindow * time.Millisecond
+	// leakMinR2 is the coefficient of determination above which the growth is deemed linear
+	leakMinR2 = 0.8
+	// leakMinMonotonic is the share of samples that must not decrease for the growth to be sustained
+	leakMinMonotonic = 0.75
+	// leakMinGrowth is the growth over the window below which the trend is ignored as noise
+	leakMinGrowth = 1024 * 1024
+)
+
+// MemorySample is the memory usage of the group at a point in time
+type MemorySample struct {
+	Time  time.Time
+	Bytes uint64
+}
+
+// MemoryTrend is the linear trend fitted over memory samples
+type MemoryTrend struct {
+	// Slope is the growth in bytes per second
+	Slope float64
+	// R2 is the coefficient of determination of the fit, 1 for a perfectly linear growth
+	R2 float64
+	// Monotonic is the share of samples not lower than the previous one
+	Monotonic float64
+	// Growth is the growth from the first to the last sample, 0 when the usage dropped
+	Growth uint64
+}
+
+// FitMemoryTrend fits a trend over the samples by least squares, at least two samples are needed
+func FitMemoryTrend(samples []MemorySample) MemoryTrend {
+	if len(samples) < 2 {
+		return MemoryTrend{}
+	}
+	n := float64(len(samples))
+	var sumX, sumY float64
+	for _, s := range samples {
+		sumX += s.Time.Sub(samples[0].Time).Seconds()
+		sumY += float64(s.Bytes)
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var sxx, sxy, syy float64
+	nonDecreasing := 0
+	for i, s := range samples {
+		dx := s.Time.Sub(samples[0].Time).Seconds() - meanX
+		dy := float64(s.Bytes) - meanY
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+		if i > 0 && s.Bytes >= samples[i-1].Bytes {
+			nonDecreasing++
+		}
+	}
+
+	trend := MemoryTrend{Monotonic: float64(nonDecreasing) / (n - 1)}
+	if first, last := samples[0].Bytes, samples[len(samples)-1].Bytes; last > first {
+		trend.Growth = last - first
+	}
+	if sxx == 0 {
+		return trend
+	}
+	trend.Slope = sxy / sxx
+	if syy > 0 {
+		trend.R2 = sxy * sxy / (sxx * syy)
+	}
+	return trend
+}
+
+// Leaking tells whether the trend is a sustained, roughly linear growth
+func (t MemoryTrend) Leaking() bool {
+	return t.Slope > 0 && t.R2 >= leakMinR2 && t.Monotonic >= leakMinMonotonic && t.Growth >= leakMinGrowth
+}
+
+// LeakWarning reports a suspected memory leak
+type LeakWarning struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	// Usage is the memory usage of the group, excluding the file cache
+	Usage       uint64  `json:"usage_bytes"`
+	Growth      uint64  `json:"growth_bytes"`
+	Slope       float64 `json:"slope_bytes_per_sec"`
+	R2          float64 `json:"r2"`
+	WindowUsec  uint64  `json:"window_usec"`
+	Limit       uint64  `json:"limit_bytes,omitempty"`
+	TimeToLimit uint64  `json:"time_to_limit_usec,omitempty"`
+}
+
+// String formats the warning for humans
+func (w *LeakWarning) String() string {
+	window := time.Duration(w.WindowUsec) * time.Microsecond
+	s := fmt.Sprintf("giogo leak: memory without file cache grew by %s over the last %v to %s (%s/min, r2=%.2f)",
+		utils.FormatBytes(w.Growth), window, utils.FormatBytes(w.Usage), utils.FormatBytes(uint64(w.Slope*60)), w.R2)
+	if w.Limit == 0 {
+		return s + ", the group has no memory limit"
+	}
+	return s + fmt.Sprintf(", memory.max %s reached in about %v", utils.FormatBytes(w.Limit), (time.Duration(w.TimeToLimit)*time.Microsecond).Round(time.Minute))
+}
+
+// LeakDetector samples the memory usage of the group, without the file cache which the kernel reclaims,
+// and warns when it grows steadily over Window. It estimates when the group reaches its memory limit.
+type LeakDetector struct {
+	Window time.Duration
+	Format EventFormat
+	// Output is where the warnings are written, stderr when nil
+	Output io.Writer
+	// Snapshotter, when set, takes a diagnostic snapshot when a leak is first suspected
+	Snapshotter *OOMSnapshotter
+}
+
+// Watch samples the memory usage until the command exits
+func (l *LeakDetector) Watch(ctx context.Context, manager core.CgroupManager) error {
+	path := manager.Path()
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "leak detection ignored: memory files require cgroup v2")
+		return nil
+	}
+	window := l.Window
+	if window == 0 {
+		window = DefaultLeakWindow
+	}
+	interval := window / leakSamplesPerWindow
+
+	var samples []MemorySample
+	var lastWarning time.Time
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			usage, ok := readAnonymousMemory(path)
+			if !ok {
+				continue
+			}
+			samples = append(samples, MemorySample{Time: now, Bytes: usage})
+			for len(samples) > 0 && now.Sub(samples[0].Time) > window {
+				samples = samples[1:]
+			}
+			// The trend is only sustained once it spans the whole window
+			if now.Sub(samples[0].Time) < window-interval || now.Sub(lastWarning) < window {
+				continue
+			}
+			trend := FitMemoryTrend(samples)
+			if !trend.Leaking() {
+				continue
+			}
+			_, limit := readMemoryUsage(path)
+			first := lastWarning.IsZero()
+			lastWarning = now
+			l.warn(newLeakWarning(now, usage, limit, window, trend), first)
+		}
+	}
+}
+
+func newLeakWarning(now time.Time, usage, limit uint64, window time.Duration, trend MemoryTrend) *LeakWarning {
+	warning := &LeakWarning{
+		Time:       now,
+		Event:      "memory_leak",
+		Usage:      usage,
+		Growth:     trend.Growth,
+		Slope:      trend.Slope,
+		R2:         trend.R2,
+		WindowUsec: uint64(window.Microseconds()),
+		Limit:      limit,
+	}
+	if limit > usage {
+		warning.TimeToLimit = uint64(float64(limit-usage) / trend.Slope * 1e6)
+	}
+	return warning
+}
+
+func (l *LeakDetector) warn(warning *LeakWarning, first bool) {
+	w := l.Output
+	if w == nil {
+		w = os.Stderr
+	}
+	var err error
+	if l.Format == EventFormatJSONLines {
+		err = json.NewEncoder(w).Encode(warning)
+	} else {
+		_, err = fmt.Fprintln(w, warning.String())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error writing leak warning: %v\n", err)
+	}
+	if first && l.Snapshotter != nil {
+		l.Snapshotter.Trigger(fmt.Sprintf("suspected memory leak, %s/min over %v", utils.FormatBytes(uint64(warning.Slope*60)), time.Duration(warning.WindowUsec)*time.Microsecond))
+	}
+}
+
+// readAnonymousMemory reads memory.current without the file cache of memory.stat
+func readAnonymousMemory(path string) (uint64, bool) {
+	usage, _ := readMemoryUsage(path)
+	content, err := os.ReadFile(filepath.Join(path, "memory.stat"))
+	if err != nil || usage == 0 {
+		return 0, false
+	}
+	for _, kv := range parseFlatKeyed(strings.TrimSpace(string(content))) {
+		if kv.key == "file" {
+			if kv.value >= usage {
+				return 0, true
+			}
+			return usage - kv.value, true
+		}
+	}
+	return usage, true
+}
@@ -0,0 +1,126 @@
+package monitor_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/monitor"
+)
+
+func memorySamples(values ...uint64) []monitor.MemorySample {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	var samples []monitor.MemorySample
+	for i, v := range values {
+		samples = append(samples, monitor.MemorySample{Time: start.Add(time.Duration(i) * time.Minute), Bytes: v})
+	}
+	return samples
+}
+
+func TestFitMemoryTrend(t *testing.T) {
+	const mib = 1024 * 1024
+	leak := monitor.FitMemoryTrend(memorySamples(100*mib, 101*mib, 102*mib, 103*mib, 103*mib, 105*mib))
+	if !leak.Leaking() {
+		t.Errorf("expected a steady growth to be a leak: %+v", leak)
+	}
+	if leak.Slope < 0.9*mib/60 || leak.Slope > 1.1*mib/60 || leak.Growth != 5*mib || leak.Monotonic != 1 {
+		t.Errorf("unexpected trend: %+v", leak)
+	}
+
+	tests := map[string][]uint64{
+		"flat":       {100 * mib, 100 * mib, 100 * mib, 100 * mib},
+		"sawtooth":   {100 * mib, 140 * mib, 100 * mib, 140 * mib, 100 * mib, 150 * mib},
+		"shrinking":  {105 * mib, 104 * mib, 103 * mib, 102 * mib},
+		"tiny":       {100 * mib, 100*mib + 1024, 100*mib + 2048, 100*mib + 3072},
+		"one sample": {100 * mib},
+	}
+	for name, values := range tests {
+		if trend := monitor.FitMemoryTrend(memorySamples(values...)); trend.Leaking() {
+			t.Errorf("expected %s not to be a leak: %+v", name, trend)
+		}
+	}
+}
+
+func TestLeakWarningString(t *testing.T) {
+	warning := &monitor.LeakWarning{Usage: 200 * 1024 * 1024, Growth: 10 * 1024 * 1024, Slope: 1024 * 1024 / 60.0, R2: 0.97,
+		WindowUsec: uint64((10 * time.Minute).Microseconds())}
+	expected := "giogo leak: memory without file cache grew by 10.0m over the last 10m0s to 200.0m (1.0m/min, r2=0.97), the group has no memory limit"
+	if warning.String() != expected {
+		t.Errorf("expected %q, got %q", expected, warning.String())
+	}
+	warning.Limit = 260 * 1024 * 1024
+	warning.TimeToLimit = uint64(time.Hour.Microseconds())
+	if !strings.HasSuffix(warning.String(), ", memory.max 260.0m reached in about 1h0m0s") {
+		t.Errorf("unexpected warning %q", warning.String())
+	}
+}
+
+func TestLeakDetectorWatch(t *testing.T) {
+	cgroupDir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(cgroupDir, name), []byte(content), 0644); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	write("memory.events", "low 0\nhigh 0\nmax 0\noom 0\noom_kill 0\n")
+	write("memory.current", "10485760\n")
+	write("memory.max", "1073741824\n")
+	write("memory.stat", "anon 9437184\nfile 1048576\n")
+
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("Path").Return(cgroupDir)
+	mockManager.On("Procs").Return([]int{os.Getpid()}, nil)
+
+	var out bytes.Buffer
+	snapshotter := &monitor.OOMSnapshotter{Dir: t.TempDir(), Name: "giogo-cgroup-1", PollInterval: 10 * time.Millisecond}
+	detector := &monitor.LeakDetector{Window: 300 * time.Millisecond, Format: monitor.EventFormatJSONLines, Output: &out, Snapshotter: snapshotter}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for _, w := range []core.Watcher{snapshotter, detector} {
+		wg.Add(1)
+		go func(w core.Watcher) {
+			defer wg.Done()
+			w.Watch(ctx, mockManager)
+		}(w)
+	}
+	// The usage grows by 100k every 5ms, the file cache stays the same
+	usage := uint64(10485760)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(snapshotDirs(t, snapshotter.Dir)) == 0 && time.Now().Before(deadline) {
+		usage += 100 * 1024
+		write("memory.current", fmt.Sprintf("%d\n", usage))
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	wg.Wait()
+
+	var warning monitor.LeakWarning
+	line, _, _ := strings.Cut(out.String(), "\n")
+	if err := json.Unmarshal([]byte(line), &warning); err != nil {
+		t.Fatalf("expected a JSON warning, got %q (%v)", out.String(), err)
+	}
+	if warning.Event != "memory_leak" || warning.Slope <= 0 || warning.Limit != 1073741824 || warning.TimeToLimit == 0 {
+		t.Errorf("unexpected warning: %+v", warning)
+	}
+	if warning.Usage >= usage {
+		t.Errorf("expected the file cache to be excluded from %d, got %d", usage, warning.Usage)
+	}
+
+	snapshots := snapshotter.Snapshots()
+	if len(snapshots) != 1 {
+		t.Fatalf("expected 1 snapshot, got %v", snapshots)
+	}
+	reason, err := os.ReadFile(filepath.Join(snapshots[0], "reason.txt"))
+	if err != nil || !strings.HasPrefix(string(reason), "suspected memory leak") {
+		t.Errorf("unexpected reason %q (%v)", reason, err)
+	}
+}
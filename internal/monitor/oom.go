@@ -0,0 +1,337 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/utils"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DefaultOOMSnapshotThreshold is the share of memory.max, in percent, memory.current must reach to take a snapshot
+	DefaultOOMSnapshotThreshold = 90
+	// DefaultOOMSnapshotPollInterval is how often memory.current is compared to the threshold
+	DefaultOOMSnapshotPollInterval = 250 * time.Millisecond
+	// OOMSnapshotMinInterval is the minimum time between two snapshots, the memory events can fire in bursts.
+	// An oom or oom_kill event is never held back by it, the group may not survive until the interval expires.
+	OOMSnapshotMinInterval = 10 * time.Second
+	// MaxOOMSnapshots bounds the number of snapshots of a run
+	MaxOOMSnapshots = 5
+)
+
+// oomSnapshotCgroupFiles are the files of the group copied in every snapshot, missing ones are skipped
+var oomSnapshotCgroupFiles = []string{
+	"memory.current", "memory.max", "memory.high", "memory.peak", "memory.stat", "memory.events",
+	"memory.pressure", "memory.swap.current", "memory.swap.max",
+}
+
+// clockTicks is USER_HZ, the unit of the CPU times of /proc/<pid>/stat, 100 on every Linux architecture
+const clockTicks = 100
+
+// ReadProcessInfo reads the identity and usage of a process from procDir (usually /proc)
+func ReadProcessInfo(procDir string, pid int) (*core.ProcessStats, error) {
+	dir := filepath.Join(procDir, strconv.Itoa(pid))
+	stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return nil, err
+	}
+	// The command name is in parentheses and may contain spaces, the fields after it are space separated
+	open, end := strings.IndexByte(string(stat), '('), strings.LastIndexByte(string(stat), ')')
+	if open < 0 || end < open {
+		return nil, fmt.Errorf("unparsable %s", filepath.Join(dir, "stat"))
+	}
+	info := &core.ProcessStats{PID: pid, Comm: string(stat[open+1 : end])}
+	// The fields start at the state, the third field of proc(5)
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) > 1 {
+		info.PPID, _ = strconv.Atoi(fields[1])
+	}
+	if len(fields) > 17 {
+		utime, _ := strconv.ParseUint(fields[11], 10, 64)
+		stime, _ := strconv.ParseUint(fields[12], 10, 64)
+		info.CPUUsec = (utime + stime) * 1000000 / clockTicks
+		info.Threads, _ = strconv.Atoi(fields[17])
+	}
+
+	if cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil {
+		for _, arg := range strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00") {
+			if arg != "" {
+				info.Cmdline = append(info.Cmdline, arg)
+			}
+		}
+	}
+
+	// Kernel threads and zombies have no smaps_rollup, they are reported without memory usage
+	if rollup, err := os.ReadFile(filepath.Join(dir, "smaps_rollup")); err == nil {
+		for _, line := range strings.Split(string(rollup), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) != 3 || fields[2] != "kB" {
+				continue
+			}
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				continue
+			}
+			switch fields[0] {
+			case "Rss:":
+				info.Rss = kb * 1024
+			case "Pss:":
+				info.Pss = kb * 1024
+			case "Swap:":
+				info.Swap = kb * 1024
+			}
+		}
+	}
+
+	// The IO counters are only readable by the owner of the process
+	if content, err := os.ReadFile(filepath.Join(dir, "io")); err == nil {
+		for _, line := range strings.Split(string(content), "\n") {
+			name, value, found := strings.Cut(line, ": ")
+			if !found {
+				continue
+			}
+			switch name {
+			case "read_bytes":
+				info.ReadBytes, _ = strconv.ParseUint(value, 10, 64)
+			case "write_bytes":
+				info.WriteBytes, _ = strconv.ParseUint(value, 10, 64)
+			}
+		}
+	}
+
+	return info, nil
+}
+
+// WriteProcessTree writes the processes as an indented tree, children below their parent
+func WriteProcessTree(w io.Writer, processes []core.ProcessStats) error {
+	sorted := append([]core.ProcessStats(nil), processes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].PID < sorted[j].PID })
+
+	var b strings.Builder
+	for _, r := range processTree(sorted) {
+		p := r.process
+		command := strings.Join(p.Cmdline, " ")
+		if command == "" {
+			command = "[" + p.Comm + "]"
+		}
+		fmt.Fprintf(&b, "%s%d rss=%s pss=%s swap=%s %s\n", strings.Repeat("  ", r.depth), p.PID,
+			utils.FormatBytes(p.Rss), utils.FormatBytes(p.Pss), utils.FormatBytes(p.Swap), command)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// OOMSnapshotter captures a diagnostic bundle when the group is about to be, or was, OOM-killed:
+// memory.stat and the other memory files, the memory usage of every process and the process tree.
+// A snapshot is taken when memory.events reports max or oom, or when memory.current crosses Threshold.
+type OOMSnapshotter struct {
+	// Dir is where the timestamped snapshot directories are created
+	Dir string
+	// Name is the name of the run, it prefixes the snapshot directories
+	Name string
+	// Threshold is the share of memory.max, in percent, that triggers a snapshot, 0 disables it
+	Threshold    int
+	PollInterval time.Duration
+
+	// snapshots is only written by Watch, it is read once Watch returned
+	snapshots []string
+
+	mu        sync.Mutex
+	requested string
+}
+
+// Trigger asks for a snapshot before the group gets close to an OOM, e.g. when it leaks memory.
+// The snapshot is taken by Watch, within the limits of the rate of snapshots.
+func (o *OOMSnapshotter) Trigger(reason string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.requested = reason
+}
+
+func (o *OOMSnapshotter) takeRequest() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	reason := o.requested
+	o.requested = ""
+	return reason
+}
+
+// Snapshots returns the directories of the snapshots taken during the run
+func (o *OOMSnapshotter) Snapshots() []string {
+	return o.snapshots
+}
+
+// Watch takes the snapshots until the command exits
+func (o *OOMSnapshotter) Watch(ctx context.Context, manager core.CgroupManager) error {
+	path := manager.Path()
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "OOM snapshots ignored: memory files require cgroup v2")
+		return nil
+	}
+	pollInterval := o.PollInterval
+	if pollInterval == 0 {
+		pollInterval = DefaultOOMSnapshotPollInterval
+	}
+
+	// memory.events is watched with inotify so the snapshot is taken before the killed process is reaped
+	eventsFile := filepath.Join(path, "memory.events")
+	inotifyFd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "OOM snapshots ignored: %v\n", err)
+		return nil
+	}
+	defer unix.Close(inotifyFd)
+	if _, err := unix.InotifyAddWatch(inotifyFd, eventsFile, unix.IN_MODIFY); err != nil {
+		fmt.Fprintf(os.Stderr, "OOM snapshots ignored: error watching %s: %v\n", eventsFile, err)
+		return nil
+	}
+
+	previous := readMemoryEvents(eventsFile)
+	// The threshold fires when it is crossed, it is armed again once the usage drops below it
+	armed := true
+	var last time.Time
+	fds := []unix.PollFd{{Fd: int32(inotifyFd), Events: unix.POLLIN}}
+	buf := make([]byte, 4096)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		if _, err := unix.Poll(fds, int(pollInterval.Milliseconds())); err != nil && err != unix.EINTR {
+			fmt.Fprintf(os.Stderr, "OOM snapshots stopped: %v\n", err)
+			return nil
+		}
+		if fds[0].Revents&unix.POLLIN != 0 {
+			for {
+				if _, err := unix.Read(inotifyFd, buf); err != nil {
+					break
+				}
+			}
+		}
+
+		var reason string
+		var oom bool
+		current := readMemoryEvents(eventsFile)
+		for _, event := range []string{"oom_kill", "oom", "max"} {
+			if current[event] > previous[event] {
+				reason = fmt.Sprintf("memory.events %s went from %d to %d", event, previous[event], current[event])
+				oom = event != "max"
+				break
+			}
+		}
+		if len(current) > 0 {
+			previous = current
+		}
+		if o.Threshold > 0 {
+			usage, limit := readMemoryUsage(path)
+			above := limit > 0 && usage*100 >= limit*uint64(o.Threshold)
+			if above && armed && reason == "" {
+				reason = fmt.Sprintf("memory.current %s reached %d%% of memory.max %s", utils.FormatBytes(usage), o.Threshold, utils.FormatBytes(limit))
+			}
+			armed = !above
+		}
+		if requested := o.takeRequest(); requested != "" && reason == "" {
+			reason = requested
+		}
+
+		if reason == "" || (!oom && time.Since(last) < OOMSnapshotMinInterval) || len(o.snapshots) >= MaxOOMSnapshots {
+			continue
+		}
+		last = time.Now()
+		dir, err := o.snapshot(manager, path, reason)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error taking OOM snapshot: %v\n", err)
+		}
+		if dir == "" {
+			continue
+		}
+		o.snapshots = append(o.snapshots, dir)
+		fmt.Fprintf(os.Stderr, "giogo: %s, OOM snapshot written to %s\n", reason, dir)
+	}
+}
+
+// snapshot writes a diagnostic bundle in a new timestamped directory
+func (o *OOMSnapshotter) snapshot(manager core.CgroupManager, path, reason string) (string, error) {
+	name := o.Name
+	if name == "" {
+		name = "giogo"
+	}
+	dir := filepath.Join(o.Dir, fmt.Sprintf("%s-oom-%s", name, time.Now().Format("20060102T150405.000")))
+	// Command lines can hold secrets, the bundle is only readable by its owner
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "reason.txt"), []byte(reason+"\n"), 0600); err != nil {
+		return "", err
+	}
+	for _, file := range oomSnapshotCgroupFiles {
+		content, err := os.ReadFile(filepath.Join(path, file))
+		if err != nil {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, file), content, 0600); err != nil {
+			return "", err
+		}
+	}
+
+	pids, err := manager.Procs()
+	if err != nil {
+		return dir, fmt.Errorf("error listing the processes of the group: %v", err)
+	}
+	processes := ReadProcesses("/proc", pids)
+	// The biggest consumers first
+	sort.Slice(processes, func(i, j int) bool { return processes[i].Pss > processes[j].Pss })
+
+	content, err := json.MarshalIndent(processes, "", "  ")
+	if err != nil {
+		return dir, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "processes.json"), append(content, '\n'), 0600); err != nil {
+		return dir, err
+	}
+	tree, err := os.OpenFile(filepath.Join(dir, "tree.txt"), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return dir, err
+	}
+	defer tree.Close()
+	return dir, WriteProcessTree(tree, processes)
+}
+
+// readMemoryEvents reads memory.events, it returns an empty map when the file is not readable
+func readMemoryEvents(file string) map[string]uint64 {
+	events := make(map[string]uint64)
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return events
+	}
+	for _, kv := range parseFlatKeyed(string(content)) {
+		events[kv.key] = kv.value
+	}
+	return events
+}
+
+// readMemoryUsage reads memory.current and memory.max, the limit is 0 when the group has none
+func readMemoryUsage(path string) (usage, limit uint64) {
+	if content, err := os.ReadFile(filepath.Join(path, "memory.current")); err == nil {
+		usage, _ = strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+	}
+	if content, err := os.ReadFile(filepath.Join(path, "memory.max")); err == nil {
+		limit, _ = strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+	}
+	return usage, limit
+}
@@ -0,0 +1,154 @@
+package monitor_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/monitor"
+)
+
+func writeProcFile(t *testing.T, procDir, pid, name, content string) {
+	t.Helper()
+	dir := filepath.Join(procDir, pid)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestReadProcessInfo(t *testing.T) {
+	procDir := t.TempDir()
+	writeProcFile(t, procDir, "42", "stat", "42 (my (odd) cmd) S 7 42 42 0 -1 4194304 100 0 0 0")
+	writeProcFile(t, procDir, "42", "cmdline", "python3\x00-c\x00print(1)\x00")
+	writeProcFile(t, procDir, "42", "smaps_rollup", "55d0a0000000-7ffc00000000 ---p 00000000 00:00 0 [rollup]\nRss:  2048 kB\nPss:  1024 kB\nSwap:  16 kB\n")
+
+	info, err := monitor.ReadProcessInfo(procDir, 42)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.PID != 42 || info.PPID != 7 || info.Comm != "my (odd) cmd" {
+		t.Errorf("unexpected process: %+v", info)
+	}
+	if strings.Join(info.Cmdline, " ") != "python3 -c print(1)" {
+		t.Errorf("unexpected cmdline: %q", info.Cmdline)
+	}
+	if info.Rss != 2048*1024 || info.Pss != 1024*1024 || info.Swap != 16*1024 {
+		t.Errorf("unexpected memory usage: %+v", info)
+	}
+
+	if _, err := monitor.ReadProcessInfo(procDir, 43); err == nil {
+		t.Errorf("expected error for a missing process")
+	}
+}
+
+func TestWriteProcessTree(t *testing.T) {
+	buf := new(bytes.Buffer)
+	err := monitor.WriteProcessTree(buf, []core.ProcessStats{
+		{PID: 12, PPID: 10, Cmdline: []string{"worker", "2"}, Rss: 2048},
+		{PID: 10, PPID: 1, Cmdline: []string{"make"}},
+		{PID: 11, PPID: 10, Comm: "kworker"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "10 rss=0 pss=0 swap=0 make\n" +
+		"  11 rss=0 pss=0 swap=0 [kworker]\n" +
+		"  12 rss=2.0k pss=0 swap=0 worker 2\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected tree:\n got %s\nwant %s", buf.String(), expected)
+	}
+}
+
+func TestOOMSnapshotterWatch(t *testing.T) {
+	cgroupDir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(cgroupDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	write("memory.events", "low 0\nhigh 0\nmax 0\noom 0\noom_kill 0\n")
+	write("memory.current", "1000\n")
+	write("memory.max", "10000\n")
+	write("memory.stat", "anon 900\nfile 100\n")
+
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("Path").Return(cgroupDir)
+	mockManager.On("Procs").Return([]int{os.Getpid()}, nil)
+
+	snapshotter := &monitor.OOMSnapshotter{Dir: t.TempDir(), Name: "giogo-cgroup-1", Threshold: 90, PollInterval: 10 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- snapshotter.Watch(ctx, mockManager)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	write("memory.current", "9500\n")
+	deadline := time.Now().Add(5 * time.Second)
+	for len(snapshotDirs(t, snapshotter.Dir)) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// A max event right after the first snapshot is rate limited
+	write("memory.events", "low 0\nhigh 0\nmax 1\noom 0\noom_kill 0\n")
+	time.Sleep(50 * time.Millisecond)
+	if dirs := snapshotDirs(t, snapshotter.Dir); len(dirs) != 1 {
+		t.Fatalf("expected the max event to be rate limited, got %d snapshots", len(dirs))
+	}
+	// An OOM kill is not
+	write("memory.events", "low 0\nhigh 0\nmax 1\noom 1\noom_kill 1\n")
+	deadline = time.Now().Add(5 * time.Second)
+	for len(snapshotDirs(t, snapshotter.Dir)) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	snapshots := snapshotter.Snapshots()
+	if len(snapshots) != 2 {
+		t.Fatalf("expected 2 snapshots, got %v", snapshots)
+	}
+	if reason, err := os.ReadFile(filepath.Join(snapshots[1], "reason.txt")); err != nil || !strings.Contains(string(reason), "oom_kill went from 0 to 1") {
+		t.Errorf("unexpected reason %q (%v)", reason, err)
+	}
+	if !strings.HasPrefix(filepath.Base(snapshots[0]), "giogo-cgroup-1-oom-") {
+		t.Errorf("unexpected snapshot directory %s", snapshots[0])
+	}
+
+	reason, err := os.ReadFile(filepath.Join(snapshots[0], "reason.txt"))
+	if err != nil || !strings.Contains(string(reason), "reached 90% of memory.max") {
+		t.Errorf("unexpected reason %q (%v)", reason, err)
+	}
+	if stat, err := os.ReadFile(filepath.Join(snapshots[0], "memory.stat")); err != nil || string(stat) != "anon 900\nfile 100\n" {
+		t.Errorf("unexpected memory.stat %q (%v)", stat, err)
+	}
+	var processes []core.ProcessStats
+	content, err := os.ReadFile(filepath.Join(snapshots[0], "processes.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := json.Unmarshal(content, &processes); err != nil || len(processes) != 1 || processes[0].PID != os.Getpid() {
+		t.Errorf("unexpected processes %s (%v)", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(snapshots[0], "tree.txt")); err != nil {
+		t.Errorf("expected a process tree: %v", err)
+	}
+}
+
+func snapshotDirs(t *testing.T, dir string) []os.DirEntry {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return entries
+}
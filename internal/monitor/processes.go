@@ -0,0 +1,325 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/utils"
+)
+
+// DefaultProcessInterval is the time between two reads of the processes of the group
+const DefaultProcessInterval = time.Second
+
+// ProcessColumn is a column of the process table
+type ProcessColumn string
+
+const (
+	ProcessColumnPID     ProcessColumn = "pid"
+	ProcessColumnPPID    ProcessColumn = "ppid"
+	ProcessColumnThreads ProcessColumn = "threads"
+	ProcessColumnCPU     ProcessColumn = "cpu"
+	ProcessColumnRss     ProcessColumn = "rss"
+	ProcessColumnPss     ProcessColumn = "pss"
+	ProcessColumnSwap    ProcessColumn = "swap"
+	ProcessColumnRead    ProcessColumn = "read"
+	ProcessColumnWrite   ProcessColumn = "write"
+	ProcessColumnCommand ProcessColumn = "command"
+)
+
+// ProcessColumns lists the columns of the process table in order
+var ProcessColumns = []ProcessColumn{
+	ProcessColumnPID, ProcessColumnPPID, ProcessColumnThreads, ProcessColumnCPU, ProcessColumnRss, ProcessColumnPss,
+	ProcessColumnSwap, ProcessColumnRead, ProcessColumnWrite, ProcessColumnCommand,
+}
+
+// ProcessSort orders the processes by a column
+type ProcessSort struct {
+	Column     ProcessColumn
+	Descending bool
+}
+
+// ParseProcessSort parses a column name. Usage columns sort the biggest first and the pid, ppid and command columns
+// sort ascending, a leading - or + forces a descending or ascending order (e.g., +rss).
+func ParseProcessSort(value string) (ProcessSort, error) {
+	name := strings.TrimLeft(value, "+-")
+	for _, column := range ProcessColumns {
+		if string(column) != strings.ToLower(name) {
+			continue
+		}
+		s := ProcessSort{Column: column}
+		switch {
+		case strings.HasPrefix(value, "-"):
+			s.Descending = true
+		case strings.HasPrefix(value, "+"):
+		default:
+			s.Descending = column != ProcessColumnPID && column != ProcessColumnPPID && column != ProcessColumnCommand
+		}
+		return s, nil
+	}
+	var names []string
+	for _, column := range ProcessColumns {
+		names = append(names, string(column))
+	}
+	return ProcessSort{}, fmt.Errorf("invalid process column %q, expected one of %s", value, strings.Join(names, ", "))
+}
+
+// less tells whether a comes before b, ties are broken by PID
+func (s ProcessSort) less(a, b core.ProcessStats) bool {
+	var cmp int
+	switch s.Column {
+	case ProcessColumnPPID:
+		cmp = compareUint(uint64(a.PPID), uint64(b.PPID))
+	case ProcessColumnThreads:
+		cmp = compareUint(uint64(a.Threads), uint64(b.Threads))
+	case ProcessColumnCPU:
+		cmp = compareUint(a.CPUUsec, b.CPUUsec)
+	case ProcessColumnRss:
+		cmp = compareUint(a.Rss, b.Rss)
+	case ProcessColumnPss:
+		cmp = compareUint(a.Pss, b.Pss)
+	case ProcessColumnSwap:
+		cmp = compareUint(a.Swap, b.Swap)
+	case ProcessColumnRead:
+		cmp = compareUint(a.ReadBytes, b.ReadBytes)
+	case ProcessColumnWrite:
+		cmp = compareUint(a.WriteBytes, b.WriteBytes)
+	case ProcessColumnCommand:
+		cmp = strings.Compare(processCommand(a), processCommand(b))
+	}
+	if cmp == 0 {
+		cmp = compareUint(uint64(a.PID), uint64(b.PID))
+	}
+	if s.Descending {
+		return cmp > 0
+	}
+	return cmp < 0
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// processCommand is the command line of the process, or its name in brackets for kernel threads and zombies
+func processCommand(p core.ProcessStats) string {
+	if command := strings.Join(p.Cmdline, " "); command != "" {
+		return command
+	}
+	return "[" + p.Comm + "]"
+}
+
+// ReadProcesses reads the processes with the given PIDs from procDir, skipping the ones that exited
+func ReadProcesses(procDir string, pids []int) []core.ProcessStats {
+	processes := []core.ProcessStats{}
+	for _, pid := range pids {
+		if info, err := ReadProcessInfo(procDir, pid); err == nil {
+			processes = append(processes, *info)
+		}
+	}
+	return processes
+}
+
+// ReadGroupProcesses reads the processes of the cgroup at cgroupDir. The PIDs come from cgroup.procs, or from the
+// thread group of every thread of cgroup.threads when the group is threaded and has no cgroup.procs to read.
+func ReadGroupProcesses(cgroupDir, procDir string) ([]core.ProcessStats, error) {
+	pids, err := readPIDs(filepath.Join(cgroupDir, "cgroup.procs"))
+	if err != nil {
+		tids, threadsErr := readPIDs(filepath.Join(cgroupDir, "cgroup.threads"))
+		if threadsErr != nil {
+			return nil, err
+		}
+		seen := make(map[int]bool)
+		for _, tid := range tids {
+			if tgid, ok := readTgid(procDir, tid); ok && !seen[tgid] {
+				seen[tgid] = true
+				pids = append(pids, tgid)
+			}
+		}
+	}
+	return ReadProcesses(procDir, pids), nil
+}
+
+// readPIDs reads a file with one PID per line
+func readPIDs(file string) ([]int, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, line := range strings.Fields(string(content)) {
+		pid, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, fmt.Errorf("unparsable PID %q in %s", line, file)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+// readTgid reads the thread group, the process, a thread belongs to
+func readTgid(procDir string, tid int) (int, bool) {
+	content, err := os.ReadFile(filepath.Join(procDir, strconv.Itoa(tid), "status"))
+	if err != nil {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if value, found := strings.CutPrefix(line, "Tgid:"); found {
+			tgid, err := strconv.Atoi(strings.TrimSpace(value))
+			return tgid, err == nil
+		}
+	}
+	return 0, false
+}
+
+// processRow is a process and its depth in the process tree
+type processRow struct {
+	process core.ProcessStats
+	depth   int
+}
+
+// processTree lists the processes with the children below their parent, siblings keep the order of processes
+func processTree(processes []core.ProcessStats) []processRow {
+	byPID := make(map[int]bool, len(processes))
+	for _, p := range processes {
+		byPID[p.PID] = true
+	}
+	children := make(map[int][]core.ProcessStats)
+	var roots []core.ProcessStats
+	for _, p := range processes {
+		if byPID[p.PPID] && p.PPID != p.PID {
+			children[p.PPID] = append(children[p.PPID], p)
+		} else {
+			roots = append(roots, p)
+		}
+	}
+
+	var rows []processRow
+	var walk func(list []core.ProcessStats, depth int)
+	walk = func(list []core.ProcessStats, depth int) {
+		for _, p := range list {
+			rows = append(rows, processRow{process: p, depth: depth})
+			walk(children[p.PID], depth+1)
+		}
+	}
+	walk(roots, 0)
+	return rows
+}
+
+// orderedRows orders the processes by the sort. Unless flat, children are listed below their parent
+// and the order applies between siblings.
+func orderedRows(processes []core.ProcessStats, order ProcessSort, flat bool) []processRow {
+	sorted := append([]core.ProcessStats(nil), processes...)
+	sort.Slice(sorted, func(i, j int) bool { return order.less(sorted[i], sorted[j]) })
+	if !flat {
+		return processTree(sorted)
+	}
+	rows := make([]processRow, 0, len(sorted))
+	for _, p := range sorted {
+		rows = append(rows, processRow{process: p})
+	}
+	return rows
+}
+
+// SortProcesses returns the processes in the order WriteProcessTable lists them
+func SortProcesses(processes []core.ProcessStats, order ProcessSort, flat bool) []core.ProcessStats {
+	rows := orderedRows(processes, order, flat)
+	sorted := make([]core.ProcessStats, len(rows))
+	for i, r := range rows {
+		sorted[i] = r.process
+	}
+	return sorted
+}
+
+// WriteProcessTable writes the processes as a table, ordered by the sort. Unless flat, children are listed below
+// their parent and the order applies between siblings.
+func WriteProcessTable(w io.Writer, processes []core.ProcessStats, order ProcessSort, flat bool) error {
+	rows := orderedRows(processes, order, flat)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PID\tPPID\tTHREADS\tCPU\tRSS\tPSS\tSWAP\tREAD\tWRITE\tCOMMAND")
+	for _, r := range rows {
+		p := r.process
+		command := processCommand(p)
+		if r.depth > 0 {
+			command = strings.Repeat("  ", r.depth-1) + "\\_ " + command
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%v\t%s\t%s\t%s\t%s\t%s\t%s\n", p.PID, p.PPID, p.Threads,
+			(time.Duration(p.CPUUsec) * time.Microsecond).Round(time.Millisecond),
+			utils.FormatBytes(p.Rss), utils.FormatBytes(p.Pss), utils.FormatBytes(p.Swap),
+			utils.FormatBytes(p.ReadBytes), utils.FormatBytes(p.WriteBytes), command)
+	}
+	return tw.Flush()
+}
+
+// ProcessTracker reads the processes of the group every Interval while the command runs and annotates the stats
+// of the run with them. A process that exited keeps the usage it had when it was last seen.
+type ProcessTracker struct {
+	Interval time.Duration
+
+	mu        sync.Mutex
+	processes map[int]core.ProcessStats
+}
+
+// Annotate sets every process seen so far in the stats, by PID
+func (p *ProcessTracker) Annotate(stats *core.Stats) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.processes) == 0 {
+		return
+	}
+	stats.Processes = make([]core.ProcessStats, 0, len(p.processes))
+	for _, process := range p.processes {
+		stats.Processes = append(stats.Processes, process)
+	}
+	sort.Slice(stats.Processes, func(i, j int) bool { return stats.Processes[i].PID < stats.Processes[j].PID })
+}
+
+// Watch reads the processes right away, then every Interval until the command exits
+func (p *ProcessTracker) Watch(ctx context.Context, manager core.CgroupManager) error {
+	interval := p.Interval
+	if interval == 0 {
+		interval = DefaultProcessInterval
+	}
+	p.read(manager)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			p.read(manager)
+		}
+	}
+}
+
+func (p *ProcessTracker) read(manager core.CgroupManager) {
+	pids, err := manager.Procs()
+	if err != nil {
+		return
+	}
+	processes := ReadProcesses("/proc", pids)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.processes == nil {
+		p.processes = make(map[int]core.ProcessStats)
+	}
+	for _, process := range processes {
+		p.processes[process.PID] = process
+	}
+}
@@ -0,0 +1,171 @@
+package monitor_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/monitor"
+)
+
+func TestReadProcessInfo_CPUAndIO(t *testing.T) {
+	procDir := t.TempDir()
+	writeProcFile(t, procDir, "42", "stat", "42 (make) S 7 42 42 0 -1 4194304 100 0 0 0 150 50 0 0 20 0 3 0 12345")
+	writeProcFile(t, procDir, "42", "io", "rchar: 9000\nwchar: 8000\nsyscr: 10\nsyscw: 5\nread_bytes: 4096\nwrite_bytes: 8192\ncancelled_write_bytes: 0\n")
+
+	info, err := monitor.ReadProcessInfo(procDir, 42)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.CPUUsec != 2000000 || info.Threads != 3 || info.ReadBytes != 4096 || info.WriteBytes != 8192 {
+		t.Errorf("unexpected usage: %+v", info)
+	}
+}
+
+func TestParseProcessSort(t *testing.T) {
+	tests := map[string]monitor.ProcessSort{
+		"pid":     {Column: monitor.ProcessColumnPID},
+		"cpu":     {Column: monitor.ProcessColumnCPU, Descending: true},
+		"+RSS":    {Column: monitor.ProcessColumnRss},
+		"-pid":    {Column: monitor.ProcessColumnPID, Descending: true},
+		"command": {Column: monitor.ProcessColumnCommand},
+	}
+	for value, expected := range tests {
+		order, err := monitor.ParseProcessSort(value)
+		if err != nil || order != expected {
+			t.Errorf("ParseProcessSort(%q) = %+v, %v, expected %+v", value, order, err, expected)
+		}
+	}
+	if _, err := monitor.ParseProcessSort("memory"); err == nil {
+		t.Errorf("expected error for an unknown column")
+	}
+}
+
+func testProcesses() []core.ProcessStats {
+	return []core.ProcessStats{
+		{PID: 12, PPID: 10, Threads: 1, Cmdline: []string{"worker", "2"}, CPUUsec: 1500000, Rss: 2048},
+		{PID: 10, PPID: 1, Threads: 1, Cmdline: []string{"make"}, CPUUsec: 100000},
+		{PID: 11, PPID: 10, Threads: 4, Cmdline: []string{"worker", "1"}, CPUUsec: 250000, WriteBytes: 1024 * 1024},
+		{PID: 13, PPID: 11, Threads: 1, Comm: "sh", CPUUsec: 3000000},
+	}
+}
+
+func TestWriteProcessTable(t *testing.T) {
+	buf := new(bytes.Buffer)
+	order, _ := monitor.ParseProcessSort("cpu")
+	if err := monitor.WriteProcessTable(buf, testProcesses(), order, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The busiest sibling first, children below their parent
+	expected := []string{"make", "\\_ worker 2", "\\_ worker 1", "\\_ [sh]"}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected a header and 4 processes, got:\n%s", buf.String())
+	}
+	for i, command := range expected {
+		if !strings.HasSuffix(lines[i+1], command) {
+			t.Errorf("expected line %d to end with %q, got:\n%s", i+1, command, buf.String())
+		}
+	}
+	if fields := strings.Fields(lines[3]); strings.Join(fields[:9], " ") != "11 10 4 250ms 0 0 0 0 1.0m" {
+		t.Errorf("unexpected row %q", lines[3])
+	}
+	if !strings.HasSuffix(lines[4], "    \\_ [sh]") {
+		t.Errorf("expected the grandchild to be indented, got %q", lines[4])
+	}
+
+	buf.Reset()
+	if err := monitor.WriteProcessTable(buf, testProcesses(), order, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var pids []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n")[1:] {
+		pids = append(pids, strings.Fields(line)[0])
+	}
+	if strings.Join(pids, ",") != "13,12,11,10" {
+		t.Errorf("unexpected flat order %v", pids)
+	}
+}
+
+func TestSortProcesses(t *testing.T) {
+	order, _ := monitor.ParseProcessSort("cpu")
+	for _, test := range []struct {
+		flat     bool
+		expected string
+	}{
+		{false, "10,12,11,13"},
+		{true, "13,12,11,10"},
+	} {
+		var pids []string
+		for _, p := range monitor.SortProcesses(testProcesses(), order, test.flat) {
+			pids = append(pids, strconv.Itoa(p.PID))
+		}
+		if strings.Join(pids, ",") != test.expected {
+			t.Errorf("unexpected order %v with flat %v, expected %s", pids, test.flat, test.expected)
+		}
+	}
+}
+
+func TestReadGroupProcesses(t *testing.T) {
+	procDir := t.TempDir()
+	writeProcFile(t, procDir, "42", "stat", "42 (make) S 7 42 42 0 -1 4194304 100 0 0 0")
+	writeProcFile(t, procDir, "43", "stat", "43 (cc) S 42 42 42 0 -1 4194304 100 0 0 0")
+	writeProcFile(t, procDir, "44", "status", "Name:\tcc\nTgid:\t43\nPid:\t44\n")
+	writeProcFile(t, procDir, "43", "status", "Name:\tcc\nTgid:\t43\nPid:\t43\n")
+
+	cgroupDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(cgroupDir, "cgroup.procs"), []byte("42\n43\n99\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	processes, err := monitor.ReadGroupProcesses(cgroupDir, procDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(processes) != 2 || processes[0].PID != 42 || processes[1].PID != 43 {
+		t.Errorf("expected the processes that did not exit, got %+v", processes)
+	}
+
+	// A threaded group only lists its threads
+	threadedDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(threadedDir, "cgroup.threads"), []byte("43\n44\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	processes, err = monitor.ReadGroupProcesses(threadedDir, procDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(processes) != 1 || processes[0].PID != 43 {
+		t.Errorf("expected the process of the threads, got %+v", processes)
+	}
+
+	if _, err := monitor.ReadGroupProcesses(t.TempDir(), procDir); err == nil {
+		t.Errorf("expected error for a missing group")
+	}
+}
+
+func TestProcessTrackerWatch(t *testing.T) {
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("Procs").Return([]int{os.Getpid()}, nil)
+
+	tracker := &monitor.ProcessTracker{Interval: time.Millisecond}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := tracker.Watch(ctx, mockManager); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stats := &core.Stats{}
+	tracker.Annotate(stats)
+	if len(stats.Processes) != 1 || stats.Processes[0].PID != os.Getpid() || len(stats.Processes[0].Cmdline) == 0 {
+		t.Errorf("expected the test process, got %+v", stats.Processes)
+	}
+	if stats.Processes[0].Threads == 0 {
+		t.Errorf("expected the threads of the test process, got %+v", stats.Processes[0])
+	}
+}
@@ -0,0 +1,147 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"golang.org/x/sys/unix"
+)
+
+// Bounds of the PSI trigger window enforced by the kernel, see Documentation/accounting/psi.rst
+const (
+	MinPSIWindow = 500 * time.Millisecond
+	MaxPSIWindow = 10 * time.Second
+)
+
+// psiPollTimeout bounds how long the trigger waits before checking whether the command exited
+const psiPollTimeout = 200 * time.Millisecond
+
+var psiResources = map[string]bool{"cpu": true, "memory": true, "io": true}
+
+// PSITrigger runs a hook, or prints an event, whenever tasks of the group were stalled on a resource
+// for more than Threshold within Window. It relies on the poll-based triggers of the *.pressure files.
+type PSITrigger struct {
+	// Resource is cpu, memory or io
+	Resource string
+	// Kind is some (at least one task stalled) or full (every task stalled)
+	Kind              string
+	Threshold, Window time.Duration
+	// Command is run with sh -c when the trigger fires, an event is printed to stderr when empty
+	Command string
+}
+
+// ParsePSITrigger parses a trigger in the form resource:kind:threshold/window[=command], e.g. memory:some:150ms/1s=./dump.sh
+func ParsePSITrigger(value string) (*PSITrigger, error) {
+	spec, command, _ := strings.Cut(value, "=")
+	parts := strings.Split(spec, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid PSI trigger %q, expected resource:kind:threshold/window[=command]", value)
+	}
+	resource, kind := strings.ToLower(parts[0]), strings.ToLower(parts[1])
+	if !psiResources[resource] {
+		return nil, fmt.Errorf("invalid PSI resource %q, expected cpu, memory or io", parts[0])
+	}
+	if kind != "some" && kind != "full" {
+		return nil, fmt.Errorf("invalid PSI kind %q, expected some or full", parts[1])
+	}
+
+	thresholdValue, windowValue, found := strings.Cut(parts[2], "/")
+	if !found {
+		return nil, fmt.Errorf("invalid PSI trigger %q, expected threshold/window", parts[2])
+	}
+	threshold, err := time.ParseDuration(thresholdValue)
+	if err != nil {
+		return nil, fmt.Errorf("unparsable PSI threshold: %v", err)
+	}
+	window, err := time.ParseDuration(windowValue)
+	if err != nil {
+		return nil, fmt.Errorf("unparsable PSI window: %v", err)
+	}
+	if window < MinPSIWindow || window > MaxPSIWindow {
+		return nil, fmt.Errorf("PSI window %v out of range [%v, %v]", window, MinPSIWindow, MaxPSIWindow)
+	}
+	if threshold <= 0 || threshold > window {
+		return nil, fmt.Errorf("PSI threshold %v must be positive and not exceed the window %v", threshold, window)
+	}
+
+	return &PSITrigger{Resource: resource, Kind: kind, Threshold: threshold, Window: window, Command: command}, nil
+}
+
+// String returns the trigger without its command
+func (p *PSITrigger) String() string {
+	return fmt.Sprintf("%s:%s:%v/%v", p.Resource, p.Kind, p.Threshold, p.Window)
+}
+
+// Watch registers the trigger on the pressure file of the group and fires it until the command exits
+func (p *PSITrigger) Watch(ctx context.Context, manager core.CgroupManager) error {
+	path := manager.Path()
+	if path == "" {
+		fmt.Fprintf(os.Stderr, "PSI trigger %s ignored: pressure files require cgroup v2\n", p)
+		return nil
+	}
+	pressureFile := filepath.Join(path, p.Resource+".pressure")
+	fd, err := unix.Open(pressureFile, unix.O_RDWR|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "PSI trigger %s ignored: error opening %s: %v\n", p, pressureFile, err)
+		return nil
+	}
+	defer unix.Close(fd)
+
+	trigger := fmt.Sprintf("%s %d %d", p.Kind, p.Threshold.Microseconds(), p.Window.Microseconds())
+	if _, err := unix.Write(fd, append([]byte(trigger), 0)); err != nil {
+		fmt.Fprintf(os.Stderr, "PSI trigger %s ignored: error registering it: %v\n", p, err)
+		return nil
+	}
+
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLPRI}}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		n, err := unix.Poll(fds, int(psiPollTimeout.Milliseconds()))
+		if err == unix.EINTR || n == 0 {
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "PSI trigger %s stopped: %v\n", p, err)
+			return nil
+		}
+		if fds[0].Revents&unix.POLLERR != 0 {
+			// The group is gone
+			return nil
+		}
+		if fds[0].Revents&unix.POLLPRI != 0 {
+			p.fire(path)
+		}
+	}
+}
+
+// fire runs the hook of the trigger, or prints an event when there is none
+func (p *PSITrigger) fire(path string) {
+	if p.Command == "" {
+		fmt.Fprintf(os.Stderr, "giogo: PSI trigger %s fired at %s\n", p, time.Now().Format(time.RFC3339))
+		return
+	}
+
+	cmd := exec.Command("sh", "-c", p.Command)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"GIOGO_PSI_TRIGGER="+p.String(),
+		"GIOGO_PSI_RESOURCE="+p.Resource,
+		"GIOGO_PSI_KIND="+p.Kind,
+		"GIOGO_CGROUP="+path,
+	)
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "PSI trigger %s hook failed: %v\n", p, err)
+	}
+}
@@ -0,0 +1,63 @@
+package monitor_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/monitor"
+)
+
+func TestParsePSITrigger(t *testing.T) {
+	trigger, err := monitor.ParsePSITrigger("memory:some:150ms/1s=echo stalled=yes")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if trigger.Resource != "memory" || trigger.Kind != "some" || trigger.Threshold != 150*time.Millisecond || trigger.Window != time.Second {
+		t.Errorf("unexpected trigger: %+v", trigger)
+	}
+	if trigger.Command != "echo stalled=yes" {
+		t.Errorf("unexpected command %q", trigger.Command)
+	}
+	if trigger.String() != "memory:some:150ms/1s" {
+		t.Errorf("unexpected string %q", trigger.String())
+	}
+
+	trigger, err = monitor.ParsePSITrigger("IO:full:1s/2s")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if trigger.Resource != "io" || trigger.Kind != "full" || trigger.Command != "" {
+		t.Errorf("unexpected trigger: %+v", trigger)
+	}
+
+	for _, invalid := range []string{
+		"memory:some",
+		"disk:some:150ms/1s",
+		"memory:half:150ms/1s",
+		"memory:some:150ms",
+		"memory:some:abc/1s",
+		"memory:some:150ms/100ms",
+		"memory:some:150ms/20s",
+		"memory:some:2s/1s",
+	} {
+		if _, err := monitor.ParsePSITrigger(invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestPSITriggerWatch_CgroupV1(t *testing.T) {
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("Path").Return("")
+
+	trigger, err := monitor.ParsePSITrigger("cpu:some:100ms/1s")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Without pressure files the trigger is ignored and the command goes on
+	if err := trigger.Watch(context.Background(), mockManager); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package monitor
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+)
+
+// Format is the output format of the live statistics
+type Format string
+
+const (
+	FormatJSONLines Format = "jsonl"
+	FormatCSV       Format = "csv"
+)
+
+// ParseFormat parses one of jsonl or csv
+func ParseFormat(value string) (Format, error) {
+	switch format := Format(value); format {
+	case FormatJSONLines, FormatCSV:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid stats format %q, expected jsonl or csv", value)
+	}
+}
+
+// Sample is a timestamped snapshot of the cgroup usage
+type Sample struct {
+	Time time.Time `json:"time"`
+	*core.Stats
+}
+
+// csvHeader lists the CSV columns, IO counters are summed across devices and pressure columns hold the avg10 percentages.
+// memory_working_set is 0 unless the working set is estimated, io_read_bps and io_write_bps are 0 unless the IO is tracked.
+var csvHeader = []string{
+	"time",
+	"cpu_usage_usec", "cpu_user_usec", "cpu_system_usec", "cpu_nr_periods", "cpu_nr_throttled", "cpu_throttled_usec",
+	"memory_current", "memory_peak", "memory_limit", "memory_working_set",
+	"io_rbytes", "io_wbytes", "io_rios", "io_wios", "io_dbytes", "io_dios", "io_read_bps", "io_write_bps",
+	"pids_current", "pids_limit",
+	"cpu_some_avg10", "cpu_full_avg10", "memory_some_avg10", "memory_full_avg10", "io_some_avg10", "io_full_avg10",
+}
+
+func (s *Sample) csvRecord() []string {
+	var rbytes, wbytes, rios, wios, dbytes, dios uint64
+	var readRate, writeRate float64
+	for _, device := range s.IO {
+		rbytes += device.RBytes
+		wbytes += device.WBytes
+		rios += device.RIOs
+		wios += device.WIOs
+		dbytes += device.DBytes
+		dios += device.DIOs
+		if device.Rates != nil {
+			readRate += device.Rates.Read
+			writeRate += device.Rates.Write
+		}
+	}
+	var workingSet uint64
+	if s.Memory.WorkingSet != nil {
+		workingSet = s.Memory.WorkingSet.Current
+	}
+	values := []uint64{
+		s.CPU.UsageUsec, s.CPU.UserUsec, s.CPU.SystemUsec, s.CPU.Periods, s.CPU.ThrottledPeriods, s.CPU.ThrottledUsec,
+		s.Memory.Current, s.Memory.Peak, s.Memory.Limit, workingSet,
+		rbytes, wbytes, rios, wios, dbytes, dios, uint64(readRate), uint64(writeRate),
+		s.Pids.Current, s.Pids.Limit,
+	}
+	record := []string{s.Time.Format(time.RFC3339Nano)}
+	for _, value := range values {
+		record = append(record, strconv.FormatUint(value, 10))
+	}
+	for _, avg := range []float64{
+		s.PSI.CPU.Some.Avg10, s.PSI.CPU.Full.Avg10,
+		s.PSI.Memory.Some.Avg10, s.PSI.Memory.Full.Avg10,
+		s.PSI.IO.Some.Avg10, s.PSI.IO.Full.Avg10,
+	} {
+		record = append(record, strconv.FormatFloat(avg, 'f', 2, 64))
+	}
+	return record
+}
+
+// SampleWriter writes samples as JSON Lines or CSV
+type SampleWriter struct {
+	format  Format
+	json    *json.Encoder
+	csv     *csv.Writer
+	started bool
+}
+
+// NewSampleWriter creates a SampleWriter for w
+func NewSampleWriter(w io.Writer, format Format) *SampleWriter {
+	return &SampleWriter{format: format, json: json.NewEncoder(w), csv: csv.NewWriter(w)}
+}
+
+// Write writes a single sample, the CSV header comes before the first one
+func (w *SampleWriter) Write(sample *Sample) error {
+	if w.format == FormatCSV {
+		if !w.started {
+			w.started = true
+			if err := w.csv.Write(csvHeader); err != nil {
+				return err
+			}
+		}
+		if err := w.csv.Write(sample.csvRecord()); err != nil {
+			return err
+		}
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+	return w.json.Encode(sample)
+}
+
+// StatsWriter periodically samples the cgroup and writes rolling statistics while the command runs
+type StatsWriter struct {
+	Interval time.Duration
+	Format   Format
+	// Path is the file the statistics are written to, stderr when empty so the command output is left untouched
+	Path string
+}
+
+// Watch samples the cgroup every Interval until the command exits
+func (s *StatsWriter) Watch(ctx context.Context, manager core.CgroupManager) error {
+	var w io.Writer = os.Stderr
+	if s.Path != "" {
+		f, err := os.Create(s.Path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error creating stats file: %v\n", err)
+			return nil
+		}
+		defer f.Close()
+		w = f
+	}
+	writer := NewSampleWriter(w, s.Format)
+
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			stats, err := manager.Stats()
+			if err != nil {
+				continue
+			}
+			if err := writer.Write(&Sample{Time: now, Stats: stats}); err != nil {
+				fmt.Fprintf(os.Stderr, "error writing stats: %v\n", err)
+				return nil
+			}
+		}
+	}
+}
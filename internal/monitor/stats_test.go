@@ -0,0 +1,99 @@
+package monitor_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/monitor"
+)
+
+func testStats() *core.Stats {
+	return &core.Stats{
+		CPU:    core.CPUStats{UsageUsec: 1000, Periods: 10, ThrottledPeriods: 2},
+		Memory: core.MemoryStats{Current: 4096, Peak: 8192, Limit: 16384},
+		IO: []core.IOStats{
+			{Major: 8, Minor: 0, RBytes: 100, WBytes: 200, RIOs: 1, WIOs: 2},
+			{Major: 8, Minor: 16, RBytes: 1000, WBytes: 2000, RIOs: 10, WIOs: 20, DBytes: 4096, DIOs: 1, Rates: &core.IORateStats{Read: 512.5, Write: 64}},
+		},
+		Pids: core.PidsStats{Current: 3},
+		PSI:  core.PSIStats{Memory: core.PressureStats{Some: core.PressureData{Avg10: 12.5}}},
+	}
+}
+
+func TestSampleWriterJSONLines(t *testing.T) {
+	buf := new(bytes.Buffer)
+	writer := monitor.NewSampleWriter(buf, monitor.FormatJSONLines)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if err := writer.Write(&monitor.Sample{Time: now, Stats: testStats()}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(lines))
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &decoded); err != nil {
+		t.Fatalf("invalid JSON line: %v", err)
+	}
+	if decoded["time"] != "2024-01-02T03:04:05Z" {
+		t.Errorf("unexpected time: %v", decoded["time"])
+	}
+	if memory, ok := decoded["memory"].(map[string]interface{}); !ok || memory["current"] != float64(4096) {
+		t.Errorf("unexpected memory: %v", decoded["memory"])
+	}
+}
+
+func TestSampleWriterCSV(t *testing.T) {
+	buf := new(bytes.Buffer)
+	writer := monitor.NewSampleWriter(buf, monitor.FormatCSV)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if err := writer.Write(&monitor.Sample{Time: now, Stats: testStats()}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 records, got %d lines", len(lines))
+	}
+	if !strings.HasPrefix(lines[0], "time,cpu_usage_usec,") {
+		t.Errorf("unexpected header: %s", lines[0])
+	}
+	expected := "2024-01-02T03:04:05Z,1000,0,0,10,2,0,4096,8192,16384,0,1100,2200,11,22,4096,1,512,64,3,0,0.00,0.00,12.50,0.00,0.00,0.00"
+	if lines[1] != expected {
+		t.Errorf("unexpected record:\n got %s\nwant %s", lines[1], expected)
+	}
+}
+
+func TestStatsWriterWatch(t *testing.T) {
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("Stats").Return(testStats(), nil)
+
+	path := filepath.Join(t.TempDir(), "stats.jsonl")
+	statsWriter := &monitor.StatsWriter{Interval: time.Millisecond, Format: monitor.FormatJSONLines, Path: path}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	if err := statsWriter.Watch(ctx, mockManager); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lines := strings.Count(string(content), "\n"); lines == 0 {
+		t.Errorf("expected samples to be written")
+	}
+}
@@ -0,0 +1,235 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+)
+
+const (
+	// DefaultWSSInterval is the time between two proactive reclaims
+	DefaultWSSInterval = 5 * time.Second
+	// DefaultWSSMaxPressure is the memory pressure, the some avg10 percentage, above which reclaim pauses
+	DefaultWSSMaxPressure = 1.0
+	// wssStepDivisor makes every reclaim ask for 1% of memory.current
+	wssStepDivisor = 100
+	// wssMinStep is the smallest amount asked for, groups using less are left alone
+	wssMinStep = 1024 * 1024
+	// wssBackoff is the number of intervals reclaim waits after it caused refaults
+	wssBackoff = 3
+)
+
+// WSSEstimator estimates the working set of the group: it regularly asks the kernel to reclaim a small share of
+// the memory of the group through memory.reclaim, and watches the refaults of memory.stat. Cold page cache goes
+// away without coming back, so memory.current shrinks towards the memory the command actually uses; once reclaim
+// causes refaults it reached the working set and backs off. Reclaim pauses while the memory pressure is high.
+// It annotates the stats of the run with the estimate.
+type WSSEstimator struct {
+	Interval time.Duration
+	// MaxPressure is the some avg10 percentage of memory.pressure above which reclaim pauses
+	MaxPressure float64
+	// Output is where reclaim pauses are reported, stderr when nil
+	Output io.Writer
+
+	mu       sync.Mutex
+	estimate *core.WorkingSetStats
+
+	// State of the estimation, only used by Watch
+	refaults    uint64
+	lastReclaim uint64
+	backoff     int
+	paused      bool
+}
+
+// Annotate sets the working set estimated so far in the stats
+func (e *WSSEstimator) Annotate(stats *core.Stats) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.estimate != nil {
+		estimate := *e.estimate
+		stats.Memory.WorkingSet = &estimate
+	}
+}
+
+// Watch reclaims every Interval until the command exits
+func (e *WSSEstimator) Watch(ctx context.Context, manager core.CgroupManager) error {
+	path := manager.Path()
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "working set estimation ignored: memory.reclaim requires cgroup v2")
+		return nil
+	}
+	interval := e.Interval
+	if interval == 0 {
+		interval = DefaultWSSInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := e.step(path); err != nil {
+				fmt.Fprintf(os.Stderr, "working set estimation stopped: %v\n", err)
+				return nil
+			}
+		}
+	}
+}
+
+// step updates the estimate from the usage and the refaults since the previous step, then reclaims unless it is unsafe
+func (e *WSSEstimator) step(path string) error {
+	usage, _ := readMemoryUsage(path)
+	if usage == 0 {
+		return nil
+	}
+	refaults, ok := readRefaults(path)
+	if !ok {
+		return fmt.Errorf("memory.stat has no refault counters")
+	}
+
+	e.mu.Lock()
+	if e.estimate == nil {
+		e.estimate = &core.WorkingSetStats{}
+		e.refaults = refaults
+	}
+	estimate := e.estimate
+	converged := estimate.Converged
+	refaulted := refaults - min(refaults, e.refaults)
+	estimate.Refaults += refaulted
+	e.refaults = refaults
+	// Half of the previous reclaim came back: it cut into the working set
+	if e.lastReclaim > 0 && refaulted*uint64(os.Getpagesize()) >= e.lastReclaim/2 {
+		estimate.Converged = true
+		e.backoff = wssBackoff
+	}
+	estimate.Current = usage
+	if converged {
+		estimate.Peak = max(estimate.Peak, usage)
+	} else {
+		// Until reclaim reaches the working set, the usage is an upper bound of it
+		estimate.Peak = usage
+	}
+	e.mu.Unlock()
+
+	e.lastReclaim = 0
+	if e.pressureTooHigh(path) {
+		return nil
+	}
+	if e.backoff > 0 {
+		e.backoff--
+		return nil
+	}
+	amount := max(usage/wssStepDivisor, wssMinStep)
+	if usage <= amount {
+		return nil
+	}
+	amount -= amount % uint64(os.Getpagesize())
+
+	err := writeReclaim(path, amount)
+	if errors.Is(err, syscall.EAGAIN) {
+		// The kernel found less than asked for to reclaim, what is left is in use
+		e.mu.Lock()
+		estimate.Converged = true
+		e.mu.Unlock()
+		e.backoff = wssBackoff
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error writing memory.reclaim, which requires Linux 5.19: %v", err)
+	}
+	e.lastReclaim = amount
+	e.mu.Lock()
+	estimate.Reclaimed += amount
+	e.mu.Unlock()
+	return nil
+}
+
+// pressureTooHigh reads memory.pressure and reports when reclaim pauses or resumes
+func (e *WSSEstimator) pressureTooHigh(path string) bool {
+	maxPressure := e.MaxPressure
+	if maxPressure == 0 {
+		maxPressure = DefaultWSSMaxPressure
+	}
+	pressure, ok := readSomeAvg10(filepath.Join(path, "memory.pressure"))
+	if !ok {
+		// Without pressure information reclaim is not safe
+		return true
+	}
+	w := e.Output
+	if w == nil {
+		w = os.Stderr
+	}
+	if high := pressure > maxPressure; high != e.paused {
+		e.paused = high
+		if high {
+			fmt.Fprintf(w, "giogo wss: reclaim paused, memory pressure %.2f%% above %.2f%%\n", pressure, maxPressure)
+		} else {
+			fmt.Fprintf(w, "giogo wss: reclaim resumed, memory pressure %.2f%%\n", pressure)
+		}
+	}
+	return e.paused
+}
+
+// writeReclaim asks the kernel to reclaim amount bytes from the group
+func writeReclaim(path string, amount uint64) error {
+	f, err := os.OpenFile(filepath.Join(path, "memory.reclaim"), os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(strconv.FormatUint(amount, 10)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readRefaults reads the refaulted pages of memory.stat, split between anon and file since Linux 5.9
+func readRefaults(path string) (uint64, bool) {
+	content, err := os.ReadFile(filepath.Join(path, "memory.stat"))
+	if err != nil {
+		return 0, false
+	}
+	var refaults uint64
+	found := false
+	for _, kv := range parseFlatKeyed(string(content)) {
+		switch kv.key {
+		case "workingset_refault", "workingset_refault_anon", "workingset_refault_file":
+			refaults += kv.value
+			found = true
+		}
+	}
+	return refaults, found
+}
+
+// readSomeAvg10 reads the some avg10 percentage of a pressure file
+func readSomeAvg10(file string) (float64, bool) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "some" {
+			continue
+		}
+		value, found := strings.CutPrefix(fields[1], "avg10=")
+		if !found {
+			return 0, false
+		}
+		avg10, err := strconv.ParseFloat(value, 64)
+		return avg10, err == nil
+	}
+	return 0, false
+}
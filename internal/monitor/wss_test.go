@@ -0,0 +1,101 @@
+package monitor_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/monitor"
+)
+
+func TestWSSEstimatorWatch(t *testing.T) {
+	cgroupDir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(cgroupDir, name), []byte(content), 0644); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	write("memory.current", "104857600\n")
+	write("memory.stat", "anon 52428800\nfile 52428800\nworkingset_refault_anon 0\nworkingset_refault_file 0\n")
+	write("memory.pressure", "some avg10=0.00 avg60=0.00 avg300=0.00 total=0\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n")
+	write("memory.reclaim", "")
+
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("Path").Return(cgroupDir)
+
+	var out bytes.Buffer
+	estimator := &monitor.WSSEstimator{Interval: 5 * time.Millisecond, Output: &out}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- estimator.Watch(ctx, mockManager)
+	}()
+	estimate := func(until func(ws *core.WorkingSetStats) bool) *core.WorkingSetStats {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			stats := &core.Stats{}
+			estimator.Annotate(stats)
+			if ws := stats.Memory.WorkingSet; ws != nil && until(ws) {
+				return ws
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("the estimate did not reach the expected state")
+		return nil
+	}
+
+	// Without refaults, reclaim goes on and the usage is an upper bound
+	ws := estimate(func(ws *core.WorkingSetStats) bool { return ws.Reclaimed >= 2*1048576 })
+	if ws.Converged || ws.Current != 104857600 {
+		t.Errorf("unexpected estimate: %+v", ws)
+	}
+	if content, _ := os.ReadFile(filepath.Join(cgroupDir, "memory.reclaim")); string(content) != "1048576" {
+		t.Errorf("expected 1%% of memory.current to be reclaimed, got %q", content)
+	}
+
+	// Refaults mean reclaim reached the working set
+	write("memory.current", "73400320\n")
+	write("memory.stat", "anon 52428800\nfile 20971520\nworkingset_refault_anon 0\nworkingset_refault_file 100000\n")
+	ws = estimate(func(ws *core.WorkingSetStats) bool { return ws.Converged })
+	if ws.Refaults != 100000 || ws.Current != 73400320 || ws.Peak != 73400320 {
+		t.Errorf("unexpected estimate: %+v", ws)
+	}
+
+	// Pressure pauses reclaim
+	write("memory.pressure", "some avg10=4.20 avg60=0.00 avg300=0.00 total=0\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n")
+	time.Sleep(50 * time.Millisecond)
+	paused := estimate(func(ws *core.WorkingSetStats) bool { return true }).Reclaimed
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stats := &core.Stats{}
+	estimator.Annotate(stats)
+	if stats.Memory.WorkingSet.Reclaimed != paused {
+		t.Errorf("expected no reclaim under pressure, reclaimed %d then %d", paused, stats.Memory.WorkingSet.Reclaimed)
+	}
+	if !strings.Contains(out.String(), "giogo wss: reclaim paused, memory pressure 4.20% above 1.00%") {
+		t.Errorf("expected the pause to be reported, got %q", out.String())
+	}
+}
+
+func TestWSSEstimatorWatch_CgroupV1(t *testing.T) {
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("Path").Return("")
+
+	estimator := &monitor.WSSEstimator{}
+	if err := estimator.Watch(context.Background(), mockManager); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	stats := &core.Stats{}
+	estimator.Annotate(stats)
+	if stats.Memory.WorkingSet != nil {
+		t.Errorf("expected no estimate, got %+v", stats.Memory.WorkingSet)
+	}
+}
@@ -0,0 +1,157 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+)
+
+// DefaultMargin is the default safety margin added to the smallest passing value, in percent
+const DefaultMargin = 10.0
+
+// Attempt is a run of the command under a value of the probed limit
+type Attempt struct {
+	Value  float64
+	Passed bool
+	// Reason tells why the run failed
+	Reason string
+}
+
+// Probe searches the smallest value of a limit the command still passes with, by bisection.
+// It assumes the command passes with any value above a passing one.
+type Probe struct {
+	Min, Max float64
+	// Precision is the width of the range the search stops at
+	Precision float64
+	// Try runs the command under the value, the reason tells why a run failed.
+	// An error aborts the probe, e.g. when the cgroup could not be set up.
+	Try func(value float64) (passed bool, reason string, err error)
+	// Format formats a value of the limit in the progress
+	Format func(value float64) string
+	// Progress is where the progress is written, stderr when nil
+	Progress io.Writer
+}
+
+// Execute returns the smallest passing value found, and every attempt made.
+// The command must pass with Max, it is tried first.
+func (p *Probe) Execute() (float64, []Attempt, error) {
+	if p.Min <= 0 || p.Max < p.Min {
+		return 0, nil, fmt.Errorf("invalid probe range: the minimum must be positive and not above the maximum")
+	}
+	if p.Precision <= 0 {
+		return 0, nil, fmt.Errorf("the probe precision must be positive")
+	}
+	progress := p.Progress
+	if progress == nil {
+		progress = os.Stderr
+	}
+	format := p.Format
+	if format == nil {
+		format = func(value float64) string { return fmt.Sprintf("%g", value) }
+	}
+
+	var attempts []Attempt
+	try := func(value float64) (bool, error) {
+		fmt.Fprintf(progress, "giogo probe: trying %s\n", format(value))
+		passed, reason, err := p.Try(value)
+		if err != nil {
+			return false, err
+		}
+		attempts = append(attempts, Attempt{Value: value, Passed: passed, Reason: reason})
+		if passed {
+			fmt.Fprintf(progress, "giogo probe: %s passed\n", format(value))
+		} else {
+			fmt.Fprintf(progress, "giogo probe: %s failed: %s\n", format(value), reason)
+		}
+		return passed, nil
+	}
+
+	passed, err := try(p.Max)
+	if err != nil {
+		return 0, attempts, err
+	}
+	if !passed {
+		return 0, attempts, fmt.Errorf("the command fails even with the maximum %s", format(p.Max))
+	}
+	if p.Max-p.Min <= p.Precision {
+		return p.Max, attempts, nil
+	}
+	passed, err = try(p.Min)
+	if err != nil || passed {
+		return p.Min, attempts, err
+	}
+
+	// The command fails at low and passes at high
+	low, high := p.Min, p.Max
+	for high-low > p.Precision {
+		mid := low + math.Round((high-low)/2/p.Precision)*p.Precision
+		// Drop the floating point noise of fractional steps, e.g. 0.30000000000000004
+		mid = math.Round(mid*1e9) / 1e9
+		if mid <= low || mid >= high {
+			break
+		}
+		passed, err := try(mid)
+		if err != nil {
+			return 0, attempts, err
+		}
+		if passed {
+			high = mid
+		} else {
+			low = mid
+		}
+	}
+	return high, attempts, nil
+}
+
+// WithMargin adds the safety margin, in percent, to a value
+func WithMargin(value, margin float64) float64 {
+	return value * (1 + margin/100)
+}
+
+// Failure tells why a run failed, empty when it passed: a setup error, a nonzero exit, an OOM kill or a missed deadline
+func Failure(result *core.Result) string {
+	if result.Stats != nil && result.Stats.Memory.Events.OOMKill > 0 {
+		return fmt.Sprintf("%d process(es) OOM killed", result.Stats.Memory.Events.OOMKill)
+	}
+	if result.Err != nil {
+		return result.Err.Error()
+	}
+	if result.ExitCode != 0 {
+		return fmt.Sprintf("exit code %d", result.ExitCode)
+	}
+	return ""
+}
+
+// DeadlineError is returned when the command did not finish before the deadline
+type DeadlineError struct {
+	Deadline time.Duration
+}
+
+func (e *DeadlineError) Error() string {
+	return fmt.Sprintf("deadline of %v exceeded", e.Deadline)
+}
+
+// Deadline kills the group when the command runs longer than Duration
+type Deadline struct {
+	Duration time.Duration
+}
+
+// Watch kills the group once the deadline is exceeded
+func (d *Deadline) Watch(ctx context.Context, manager core.CgroupManager) error {
+	timer := time.NewTimer(d.Duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-timer.C:
+		if err := manager.Kill(); err != nil {
+			return fmt.Errorf("error killing the group after the deadline: %v", err)
+		}
+		return &DeadlineError{Deadline: d.Duration}
+	}
+}
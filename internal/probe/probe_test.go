@@ -0,0 +1,137 @@
+package probe_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/probe"
+)
+
+func TestProbeExecute(t *testing.T) {
+	const mib = 1024 * 1024
+	threshold := 300.5 * mib
+	p := &probe.Probe{
+		Min:       64 * mib,
+		Max:       4096 * mib,
+		Precision: mib,
+		Try: func(value float64) (bool, string, error) {
+			if value < threshold {
+				return false, "1 process(es) OOM killed", nil
+			}
+			return true, "", nil
+		},
+		Progress: new(bytes.Buffer),
+	}
+
+	smallest, attempts, err := p.Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if smallest < threshold || smallest > threshold+mib {
+		t.Errorf("expected the smallest passing value within 1m of %v, got %v", threshold, smallest)
+	}
+	// Bisecting 4032 steps of 1m takes 12 runs, plus the two bounds
+	if len(attempts) > 14 {
+		t.Errorf("expected at most 14 attempts, got %d", len(attempts))
+	}
+	if attempts[0].Value != p.Max || !attempts[0].Passed || attempts[1].Value != p.Min || attempts[1].Reason != "1 process(es) OOM killed" {
+		t.Errorf("expected the bounds to be tried first, got %+v", attempts[:2])
+	}
+
+	// The minimum passes
+	threshold = 0
+	if smallest, _, err := p.Execute(); err != nil || smallest != p.Min {
+		t.Errorf("expected the minimum, got %v (%v)", smallest, err)
+	}
+
+	// The maximum fails
+	threshold = 8192 * mib
+	if _, _, err := p.Execute(); err == nil {
+		t.Errorf("expected an error when the maximum fails")
+	}
+
+	setupErr := errors.New("error initializing cgroup manager")
+	p.Try = func(value float64) (bool, string, error) { return false, "", setupErr }
+	if _, _, err := p.Execute(); !errors.Is(err, setupErr) {
+		t.Errorf("expected the setup error, got %v", err)
+	}
+
+	p.Min = 0
+	if _, _, err := p.Execute(); err == nil {
+		t.Errorf("expected error for an empty range")
+	}
+}
+
+func TestProbeExecute_Fractions(t *testing.T) {
+	p := &probe.Probe{
+		Min:       0.01,
+		Max:       1,
+		Precision: 0.01,
+		Try: func(value float64) (bool, string, error) {
+			return value >= 0.3, "deadline of 1s exceeded", nil
+		},
+		Progress: new(bytes.Buffer),
+	}
+	smallest, attempts, err := p.Execute()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if smallest != 0.3 {
+		t.Errorf("expected 0.3, got %v", smallest)
+	}
+	for _, a := range attempts {
+		if formatted := strconv.FormatFloat(a.Value, 'f', -1, 64); len(formatted) > 4 {
+			t.Errorf("expected values on the hundredths, got %v", a.Value)
+		}
+	}
+
+	if margin := probe.WithMargin(0.3, 10); margin < 0.33-1e-9 || margin > 0.33+1e-9 {
+		t.Errorf("expected 0.33, got %v", margin)
+	}
+}
+
+func TestFailure(t *testing.T) {
+	tests := []struct {
+		result   core.Result
+		expected string
+	}{
+		{core.Result{}, ""},
+		{core.Result{ExitCode: 2}, "exit code 2"},
+		{core.Result{ExitCode: -1, Err: &probe.DeadlineError{Deadline: time.Second}}, "deadline of 1s exceeded"},
+		{core.Result{ExitCode: -1, Err: errors.New("command exited with error: signal: killed"),
+			Stats: &core.Stats{Memory: core.MemoryStats{Events: core.MemoryEventsStats{OOMKill: 1}}}}, "1 process(es) OOM killed"},
+	}
+	for _, tt := range tests {
+		if got := probe.Failure(&tt.result); got != tt.expected {
+			t.Errorf("Failure(%+v) = %q, expected %q", tt.result, got, tt.expected)
+		}
+	}
+}
+
+func TestDeadlineWatch(t *testing.T) {
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("Kill").Return(nil)
+
+	deadline := &probe.Deadline{Duration: 10 * time.Millisecond}
+	err := deadline.Watch(context.Background(), mockManager)
+	var deadlineErr *probe.DeadlineError
+	if !errors.As(err, &deadlineErr) {
+		t.Fatalf("expected a DeadlineError, got %v", err)
+	}
+	mockManager.AssertCalled(t, "Kill")
+
+	// The command finished in time
+	mockManager = new(core.MockCgroupManager)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	deadline.Duration = time.Minute
+	if err := deadline.Watch(ctx, mockManager); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	mockManager.AssertNotCalled(t, "Kill")
+}
@@ -0,0 +1,326 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/record"
+	"github.com/pmarchini/giogo/internal/utils"
+)
+
+// Defaults of the recommendation
+const (
+	DefaultInterval   = time.Second
+	DefaultHeadroom   = 20.0
+	DefaultPercentile = 99.0
+)
+
+// Observed is the usage of the command, as sampled over time
+type Observed struct {
+	Samples int
+	// CPU is the CPU usage in cores, at the percentile over the sampling intervals, and its median
+	CPU       float64
+	CPUMedian float64
+	// MemoryPeak is the highest memory usage the group cannot do without: the working set when it was estimated,
+	// the usage without the page cache otherwise
+	MemoryPeak uint64
+	// IORead and IOWrite are the bandwidths in bytes per second at the percentile over the sampling intervals
+	IORead  uint64
+	IOWrite uint64
+	// PidsPeak is the highest number of tasks
+	PidsPeak uint64
+}
+
+// Observe computes the observed usage from samples in time order, at least two samples are needed
+func Observe(samples []record.Sample, percentile float64) (*Observed, error) {
+	if len(samples) < 2 {
+		return nil, fmt.Errorf("at least two samples are needed, got %d", len(samples))
+	}
+	observed := &Observed{Samples: len(samples)}
+	var cpuRates, readRates, writeRates []float64
+	for i, s := range samples {
+		observed.MemoryPeak = max(observed.MemoryPeak, memoryNeeded(&s.Stats.Memory))
+		observed.PidsPeak = max(observed.PidsPeak, s.Stats.Pids.Peak, s.Stats.Pids.Current)
+		if i == 0 {
+			continue
+		}
+		previous := samples[i-1]
+		elapsed := s.Time.Sub(previous.Time).Seconds()
+		if elapsed <= 0 {
+			continue
+		}
+		cpuRates = append(cpuRates, float64(utils.Delta(s.Stats.CPU.UsageUsec, previous.Stats.CPU.UsageUsec))/1e6/elapsed)
+		read, written := core.IOTotals(s.Stats.IO)
+		previousRead, previousWritten := core.IOTotals(previous.Stats.IO)
+		readRates = append(readRates, float64(utils.Delta(read, previousRead))/elapsed)
+		writeRates = append(writeRates, float64(utils.Delta(written, previousWritten))/elapsed)
+	}
+	if len(cpuRates) == 0 {
+		return nil, fmt.Errorf("the samples span no time")
+	}
+	observed.CPU = percentileOf(cpuRates, percentile)
+	observed.CPUMedian = percentileOf(cpuRates, 50)
+	observed.IORead = uint64(percentileOf(readRates, percentile))
+	observed.IOWrite = uint64(percentileOf(writeRates, percentile))
+	return observed, nil
+}
+
+// percentileOf returns the percentile of unsorted values
+func percentileOf(values []float64, p float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return utils.Percentile(sorted, p)
+}
+
+// Recommendation holds the proposed limits
+type Recommendation struct {
+	Command  []string
+	Observed Observed
+	Headroom float64
+	// CPU is the proposed CPU limit in cores, CPURequest the proposed Kubernetes request
+	CPU        float64
+	CPURequest float64
+	// Memory is the proposed memory limit in bytes, rounded up to the MiB
+	Memory uint64
+	// IORead and IOWrite are the proposed bandwidths in bytes per second, 0 when the command did no IO
+	IORead  uint64
+	IOWrite uint64
+}
+
+const mib = 1024 * 1024
+
+// memoryNeeded is the memory of a sample the limit must leave room for. The page cache is left out,
+// as the kernel reclaims it before invoking the OOM killer, like the leak detector does with the anonymous memory.
+func memoryNeeded(memory *core.MemoryStats) uint64 {
+	if ws := memory.WorkingSet; ws != nil {
+		return ws.Peak
+	}
+	if memory.File == 0 {
+		// Recorded without the page cache, memory.peak is the only sign of a spike between two samples
+		return max(memory.Peak, memory.Current)
+	}
+	if memory.File >= memory.Current {
+		return 0
+	}
+	return memory.Current - memory.File
+}
+
+// New proposes limits from the observed usage, with headroom percent on top of it
+func New(command []string, observed *Observed, headroom float64) *Recommendation {
+	withHeadroom := func(value float64) float64 {
+		return value * (1 + headroom/100)
+	}
+	r := &Recommendation{
+		Command:    command,
+		Observed:   *observed,
+		Headroom:   headroom,
+		CPU:        math.Max(math.Ceil(withHeadroom(observed.CPU)*100-1e-9)/100, 0.01),
+		CPURequest: math.Max(math.Ceil(observed.CPUMedian*100-1e-9)/100, 0.01),
+		Memory:     uint64(math.Max(math.Ceil(withHeadroom(float64(observed.MemoryPeak))/mib), 1)) * mib,
+	}
+	if observed.IORead > 0 {
+		r.IORead = uint64(math.Ceil(withHeadroom(float64(observed.IORead))/mib)) * mib
+	}
+	if observed.IOWrite > 0 {
+		r.IOWrite = uint64(math.Ceil(withHeadroom(float64(observed.IOWrite))/mib)) * mib
+	}
+	return r
+}
+
+// Settings returns the proposed limits as giogo flag names and values.
+// A giogo CPU limit is a fraction of a single CPU, so it is capped at 1.
+func (r *Recommendation) Settings() [][2]string {
+	settings := [][2]string{
+		{"cpu", strconv.FormatFloat(math.Min(r.CPU, 1), 'f', -1, 64)},
+		{"ram", fmt.Sprintf("%dm", r.Memory/mib)},
+	}
+	if r.IORead > 0 {
+		settings = append(settings, [2]string{"io-read-max", fmt.Sprintf("%dm", r.IORead/mib)})
+	}
+	if r.IOWrite > 0 {
+		settings = append(settings, [2]string{"io-write-max", fmt.Sprintf("%dm", r.IOWrite/mib)})
+	}
+	return settings
+}
+
+// Flags returns the proposed limits as giogo flags
+func (r *Recommendation) Flags() string {
+	var flags []string
+	for _, s := range r.Settings() {
+		flags = append(flags, fmt.Sprintf("--%s=%s", s[0], s[1]))
+	}
+	return strings.Join(flags, " ")
+}
+
+// WriteProfile writes the proposed limits as a profile, see LoadProfile
+func (r *Recommendation) WriteProfile(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# giogo profile recommended from the usage of: %s\n", strings.Join(r.Command, " "))
+	for _, s := range r.Settings() {
+		fmt.Fprintf(&b, "%s = %s\n", s[0], s[1])
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteKubernetes writes the proposed limits as Kubernetes container resources.
+// Memory is requested at its limit, as exceeding a memory request makes a pod a candidate for eviction.
+func (r *Recommendation) WriteKubernetes(w io.Writer) error {
+	memory := fmt.Sprintf("%dMi", r.Memory/mib)
+	_, err := fmt.Fprintf(w, "resources:\n  requests:\n    cpu: %dm\n    memory: %s\n  limits:\n    cpu: %dm\n    memory: %s\n",
+		int(math.Round(r.CPURequest*1000)), memory, int(math.Round(r.CPU*1000)), memory)
+	return err
+}
+
+// WriteText writes the observed usage and the proposed limits in every form
+func (r *Recommendation) WriteText(w io.Writer) error {
+	var b strings.Builder
+	o := r.Observed
+	fmt.Fprintf(&b, "observed usage over %d samples:\n", o.Samples)
+	fmt.Fprintf(&b, "  cpu:          %.2f cores (median %.2f)\n", o.CPU, o.CPUMedian)
+	fmt.Fprintf(&b, "  memory peak:  %s\n", utils.FormatBytes(o.MemoryPeak))
+	fmt.Fprintf(&b, "  io read:      %s/s\n", utils.FormatBytes(o.IORead))
+	fmt.Fprintf(&b, "  io write:     %s/s\n", utils.FormatBytes(o.IOWrite))
+	fmt.Fprintf(&b, "  pids peak:    %d\n", o.PidsPeak)
+	fmt.Fprintf(&b, "\nrecommended limits (%s%% headroom):\n  giogo %s -- %s\n", strconv.FormatFloat(r.Headroom, 'f', -1, 64), r.Flags(), strings.Join(r.Command, " "))
+	if r.CPU > 1 {
+		fmt.Fprintf(&b, "  the command used more than one CPU, which a giogo CPU limit cannot express\n")
+	}
+	b.WriteString("\nprofile:\n")
+	if err := r.WriteProfile(&b); err != nil {
+		return err
+	}
+	b.WriteString("\nkubernetes:\n")
+	if err := r.WriteKubernetes(&b); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Recommender samples the usage of the cgroup while the command runs, and proposes limits once it exited.
+// It is both a watcher and a reporter.
+type Recommender struct {
+	Interval   time.Duration
+	Headroom   float64
+	Percentile float64
+	// Output is where the recommendation is written, stderr when nil
+	Output io.Writer
+	// ProfilePath, when set, is where the profile is written
+	ProfilePath string
+
+	mu      sync.Mutex
+	samples []record.Sample
+}
+
+func (r *Recommender) add(sample record.Sample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.samples = append(r.samples, sample)
+}
+
+// Watch samples the usage of the cgroup every Interval until the command exits
+func (r *Recommender) Watch(ctx context.Context, manager core.CgroupManager) error {
+	interval := r.Interval
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	if stats, err := manager.Stats(); err == nil {
+		r.add(record.Sample{Time: time.Now(), Stats: stats})
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			if stats, err := manager.Stats(); err == nil {
+				r.add(record.Sample{Time: now, Stats: stats})
+			}
+		}
+	}
+}
+
+// Report proposes the limits from the samples and the final usage
+func (r *Recommender) Report(result *core.Result) error {
+	r.mu.Lock()
+	samples := append([]record.Sample(nil), r.samples...)
+	r.mu.Unlock()
+	if result.Stats != nil {
+		samples = append(samples, record.Sample{Time: result.Start.Add(result.WallTime), Stats: result.Stats})
+	}
+
+	percentile := r.Percentile
+	if percentile == 0 {
+		percentile = DefaultPercentile
+	}
+	observed, err := Observe(samples, percentile)
+	if err != nil {
+		return fmt.Errorf("cannot recommend limits: %v", err)
+	}
+	recommendation := New(result.Command, observed, r.Headroom)
+
+	w := r.Output
+	if w == nil {
+		w = os.Stderr
+	}
+	if err := recommendation.WriteText(w); err != nil {
+		return err
+	}
+	if r.ProfilePath != "" {
+		if err := WriteProfileFile(r.ProfilePath, recommendation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteProfileFile writes the profile of the recommendation to path
+func WriteProfileFile(path string, recommendation *Recommendation) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error writing profile: %v", err)
+	}
+	if err := recommendation.WriteProfile(f); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing profile: %v", err)
+	}
+	return f.Close()
+}
+
+// ProfileSetting is a line of a profile
+type ProfileSetting struct {
+	Flag, Value string
+}
+
+// ParseProfile parses a profile: one flag per line as name = value, with # comments
+func ParseProfile(r io.Reader) ([]ProfileSetting, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var settings []ProfileSetting
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, found := strings.Cut(line, "=")
+		name = strings.TrimPrefix(strings.TrimSpace(name), "--")
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid profile line %d: expected name = value, got %q", i+1, line)
+		}
+		settings = append(settings, ProfileSetting{Flag: name, Value: strings.TrimSpace(value)})
+	}
+	return settings, nil
+}
@@ -0,0 +1,167 @@
+package recommend_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/recommend"
+	"github.com/pmarchini/giogo/internal/record"
+)
+
+const mib = 1024 * 1024
+
+func testSamples() []record.Sample {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	sample := func(seconds int, cpuUsec, memory, read uint64, pids uint64) record.Sample {
+		return record.Sample{Time: start.Add(time.Duration(seconds) * time.Second), Stats: &core.Stats{
+			CPU:    core.CPUStats{UsageUsec: cpuUsec},
+			Memory: core.MemoryStats{Current: memory},
+			IO:     []core.IOStats{{RBytes: read}},
+			Pids:   core.PidsStats{Current: pids},
+		}}
+	}
+	return []record.Sample{
+		sample(0, 0, 10*mib, 0, 1),
+		sample(1, 250000, 100*mib, 10*mib, 4),
+		sample(2, 750000, 200*mib, 10*mib, 8),
+		sample(3, 1250000, 150*mib, 30*mib, 2),
+	}
+}
+
+func TestObserve(t *testing.T) {
+	observed, err := recommend.Observe(testSamples(), 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if observed.CPU != 0.5 || observed.CPUMedian != 0.5 {
+		t.Errorf("expected 0.5 cores, got %v (median %v)", observed.CPU, observed.CPUMedian)
+	}
+	if observed.MemoryPeak != 200*mib || observed.PidsPeak != 8 {
+		t.Errorf("unexpected peaks: %+v", observed)
+	}
+	if observed.IORead != 20*mib || observed.IOWrite != 0 {
+		t.Errorf("unexpected IO bandwidths: %+v", observed)
+	}
+
+	if _, err := recommend.Observe(testSamples()[:1], 99); err == nil {
+		t.Errorf("expected error for a single sample")
+	}
+}
+
+func TestObserve_PageCache(t *testing.T) {
+	samples := testSamples()
+	// The page cache is reclaimed before the OOM killer runs, it does not need room under the limit
+	samples[2].Stats.Memory.File = 120 * mib
+	samples[3].Stats.Memory.File = 20 * mib
+	observed, err := recommend.Observe(samples, 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if observed.MemoryPeak != 130*mib {
+		t.Errorf("expected a 130m peak without the page cache, got %d", observed.MemoryPeak)
+	}
+
+	// The working set is preferred when it was estimated
+	samples[3].Stats.Memory.WorkingSet = &core.WorkingSetStats{Current: 90 * mib, Peak: 140 * mib}
+	observed, _ = recommend.Observe(samples, 100)
+	if observed.MemoryPeak != 140*mib {
+		t.Errorf("expected the 140m working set peak, got %d", observed.MemoryPeak)
+	}
+}
+
+func TestRecommendation(t *testing.T) {
+	observed, _ := recommend.Observe(testSamples(), 100)
+	r := recommend.New([]string{"make", "-j2"}, observed, 20)
+
+	if flags := r.Flags(); flags != "--cpu=0.6 --ram=240m --io-read-max=24m" {
+		t.Errorf("unexpected flags: %s", flags)
+	}
+
+	var kubernetes bytes.Buffer
+	if err := r.WriteKubernetes(&kubernetes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "resources:\n  requests:\n    cpu: 500m\n    memory: 240Mi\n  limits:\n    cpu: 600m\n    memory: 240Mi\n"
+	if kubernetes.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, kubernetes.String())
+	}
+
+	var profile bytes.Buffer
+	if err := r.WriteProfile(&profile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	settings, err := recommend.ParseProfile(&profile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(settings) != 3 || settings[0] != (recommend.ProfileSetting{Flag: "cpu", Value: "0.6"}) || settings[1] != (recommend.ProfileSetting{Flag: "ram", Value: "240m"}) {
+		t.Errorf("unexpected profile settings: %+v", settings)
+	}
+
+	var text bytes.Buffer
+	if err := r.WriteText(&text); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, expected := range []string{"memory peak:  200.0m", "giogo --cpu=0.6 --ram=240m --io-read-max=24m -- make -j2", "ram = 240m", "cpu: 600m"} {
+		if !strings.Contains(text.String(), expected) {
+			t.Errorf("expected %q in:\n%s", expected, text.String())
+		}
+	}
+
+	// A giogo CPU limit cannot go above one CPU
+	observed.CPU = 3
+	if flags := recommend.New(nil, observed, 0).Flags(); !strings.HasPrefix(flags, "--cpu=1 ") {
+		t.Errorf("expected the CPU limit capped at 1, got %s", flags)
+	}
+}
+
+func TestParseProfile(t *testing.T) {
+	settings, err := recommend.ParseProfile(strings.NewReader("# comment\n\n--cpu = 0.5\nram=1g\nassert-peak-memory = <=512m\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []recommend.ProfileSetting{{"cpu", "0.5"}, {"ram", "1g"}, {"assert-peak-memory", "<=512m"}}
+	if len(settings) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, settings)
+	}
+	for i := range expected {
+		if settings[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected[i], settings[i])
+		}
+	}
+
+	for _, invalid := range []string{"cpu", "= 0.5"} {
+		if _, err := recommend.ParseProfile(strings.NewReader(invalid)); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestRecommenderReport(t *testing.T) {
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("Stats").Return(&core.Stats{}, nil)
+
+	var out bytes.Buffer
+	recommender := &recommend.Recommender{Headroom: 20, Output: &out}
+	// The command exited right away, only the first sample is taken
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	recommender.Watch(ctx, mockManager)
+
+	result := &core.Result{
+		Command:  []string{"sleep", "1"},
+		Start:    time.Now(),
+		WallTime: 2 * time.Second,
+		Stats:    &core.Stats{CPU: core.CPUStats{UsageUsec: 100000}, Memory: core.MemoryStats{Peak: 64 * mib}},
+	}
+	if err := recommender.Report(result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "giogo --cpu=0.06 --ram=77m -- sleep 1") {
+		t.Errorf("unexpected recommendation:\n%s", out.String())
+	}
+}
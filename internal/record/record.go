@@ -0,0 +1,258 @@
+package record
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/monitor"
+)
+
+// Version is the version of the recording format
+const Version = 1
+
+// DefaultInterval is the default time between two samples of a recording
+const DefaultInterval = time.Second
+
+// Entry types of a recording
+const (
+	EntryHeader = "header"
+	EntrySample = "sample"
+	EntryEvent  = "event"
+	EntryResult = "result"
+)
+
+// Entry is a line of a recording.
+// A recording is a gzip compressed JSON Lines file: a header, then samples and events in time order,
+// and a result once the command exited.
+type Entry struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// Version and IntervalUsec are set on the header
+	Version      int            `json:"version,omitempty"`
+	IntervalUsec uint64         `json:"interval_usec,omitempty"`
+	Stats        *core.Stats    `json:"stats,omitempty"`
+	Event        *monitor.Event `json:"event,omitempty"`
+	Result       *Run           `json:"result,omitempty"`
+}
+
+// Run describes the recorded run and the resources applied to its cgroup
+type Run struct {
+	Name         string               `json:"name"`
+	Command      []string             `json:"command"`
+	Resources    specs.LinuxResources `json:"resources"`
+	Start        time.Time            `json:"start"`
+	WallTimeUsec uint64               `json:"wall_time_usec"`
+	ExitCode     int                  `json:"exit_code"`
+	Error        string               `json:"error,omitempty"`
+}
+
+// Sample is a snapshot of the cgroup usage at a point in time
+type Sample struct {
+	Time  time.Time
+	Stats *core.Stats
+}
+
+// Recording is a recording read back in memory
+type Recording struct {
+	Interval time.Duration
+	Samples  []Sample
+	Events   []monitor.Event
+	// Run is nil when giogo did not finish writing the recording
+	Run *Run
+}
+
+// Read reads a recording
+func Read(r io.Reader) (*Recording, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a giogo recording: %v", err)
+	}
+	defer gz.Close()
+
+	recording := &Recording{}
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid recording entry on line %d: %v", line, err)
+		}
+		switch entry.Type {
+		case EntryHeader:
+			if entry.Version > Version {
+				return nil, fmt.Errorf("unsupported recording version %d", entry.Version)
+			}
+			recording.Interval = time.Duration(entry.IntervalUsec) * time.Microsecond
+		case EntrySample:
+			if entry.Stats != nil {
+				recording.Samples = append(recording.Samples, Sample{Time: entry.Time, Stats: entry.Stats})
+			}
+		case EntryEvent:
+			if entry.Event != nil {
+				recording.Events = append(recording.Events, *entry.Event)
+			}
+		case EntryResult:
+			recording.Run = entry.Result
+		}
+	}
+	// A recording cut short by a crash is still worth reading
+	if err := scanner.Err(); err != nil && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("error reading recording: %v", err)
+	}
+	return recording, nil
+}
+
+// ReadFile reads the recording stored at path
+func ReadFile(path string) (*Recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Recorder stores a time series of the cgroup stats and events while the command runs,
+// and the applied resources once it exited. It is both a watcher and a reporter.
+type Recorder struct {
+	Path     string
+	Interval time.Duration
+
+	mu   sync.Mutex
+	file *os.File
+	gz   *gzip.Writer
+	enc  *json.Encoder
+}
+
+// open creates the recording and writes its header
+func (r *Recorder) open() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file != nil {
+		return nil
+	}
+	file, err := os.Create(r.Path)
+	if err != nil {
+		return fmt.Errorf("error creating recording: %v", err)
+	}
+	r.file = file
+	r.gz = gzip.NewWriter(file)
+	r.enc = json.NewEncoder(r.gz)
+	return r.writeLocked(&Entry{Type: EntryHeader, Time: time.Now(), Version: Version, IntervalUsec: uint64(r.interval().Microseconds())})
+}
+
+func (r *Recorder) interval() time.Duration {
+	if r.Interval == 0 {
+		return DefaultInterval
+	}
+	return r.Interval
+}
+
+func (r *Recorder) write(entry *Entry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.writeLocked(entry)
+}
+
+func (r *Recorder) writeLocked(entry *Entry) error {
+	if r.enc == nil {
+		return nil
+	}
+	if err := r.enc.Encode(entry); err != nil {
+		return err
+	}
+	// Flushing every entry keeps the recording readable if giogo itself is killed
+	return r.gz.Flush()
+}
+
+// Watch records the stats of the cgroup every Interval and its events as they happen, until the command exits
+func (r *Recorder) Watch(ctx context.Context, manager core.CgroupManager) error {
+	if err := r.open(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	if path := manager.Path(); path != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := monitor.WatchEvents(ctx, path, func(events []monitor.Event) {
+				for i := range events {
+					r.write(&Entry{Type: EntryEvent, Time: events[i].Time, Event: &events[i]})
+				}
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "recording events ignored: %v\n", err)
+			}
+		}()
+	}
+	defer wg.Wait()
+
+	ticker := time.NewTicker(r.interval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			stats, err := manager.Stats()
+			if err != nil {
+				continue
+			}
+			if err := r.write(&Entry{Type: EntrySample, Time: now, Stats: stats}); err != nil {
+				fmt.Fprintf(os.Stderr, "error writing recording: %v\n", err)
+				return nil
+			}
+		}
+	}
+}
+
+// Report writes the final sample and the description of the run, then closes the recording
+func (r *Recorder) Report(result *core.Result) error {
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	end := result.Start.Add(result.WallTime)
+	if result.Stats != nil {
+		if err := r.write(&Entry{Type: EntrySample, Time: end, Stats: result.Stats}); err != nil {
+			return fmt.Errorf("error writing recording: %v", err)
+		}
+	}
+	run := &Run{
+		Name:         result.Name,
+		Command:      result.Command,
+		Resources:    result.Resources,
+		Start:        result.Start,
+		WallTimeUsec: uint64(result.WallTime.Microseconds()),
+		ExitCode:     result.ExitCode,
+	}
+	if result.Err != nil {
+		run.Error = result.Err.Error()
+	}
+	if err := r.write(&Entry{Type: EntryResult, Time: end, Result: run}); err != nil {
+		return fmt.Errorf("error writing recording: %v", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.gz.Close(); err != nil {
+		r.file.Close()
+		return fmt.Errorf("error writing recording: %v", err)
+	}
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("error writing recording: %v", err)
+	}
+	r.enc = nil
+	return nil
+}
@@ -0,0 +1,97 @@
+package record_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/record"
+)
+
+func TestRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.giogo")
+	mockManager := new(core.MockCgroupManager)
+	mockManager.On("Path").Return("")
+	mockManager.On("Stats").Return(&core.Stats{Memory: core.MemoryStats{Current: 4096}}, nil)
+
+	recorder := &record.Recorder{Path: path, Interval: 10 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- recorder.Watch(ctx, mockManager)
+	}()
+	time.Sleep(55 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	limit := int64(128 * 1024 * 1024)
+	start := time.Now().Add(-time.Second)
+	err := recorder.Report(&core.Result{
+		Name:      "giogo-cgroup-1",
+		Command:   []string{"make"},
+		Resources: specs.LinuxResources{Memory: &specs.LinuxMemory{Limit: &limit}},
+		Start:     start,
+		WallTime:  time.Second,
+		ExitCode:  2,
+		Err:       errors.New("command exited with error: exit status 2"),
+		Stats:     &core.Stats{Memory: core.MemoryStats{Current: 8192}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rec, err := record.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Interval != 10*time.Millisecond {
+		t.Errorf("unexpected interval %v", rec.Interval)
+	}
+	if len(rec.Samples) < 2 {
+		t.Fatalf("expected periodic samples and the final one, got %d", len(rec.Samples))
+	}
+	if last := rec.Samples[len(rec.Samples)-1]; last.Stats.Memory.Current != 8192 {
+		t.Errorf("unexpected final sample: %+v", last.Stats.Memory)
+	}
+	if rec.Run == nil || rec.Run.Name != "giogo-cgroup-1" || rec.Run.ExitCode != 2 || rec.Run.Error == "" {
+		t.Fatalf("unexpected run: %+v", rec.Run)
+	}
+	if rec.Run.Resources.Memory == nil || *rec.Run.Resources.Memory.Limit != limit {
+		t.Errorf("unexpected resources: %+v", rec.Run.Resources)
+	}
+}
+
+func TestReadTruncated(t *testing.T) {
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	gz.Write([]byte(`{"type":"header","time":"2024-01-02T03:04:05Z","version":1,"interval_usec":1000000}` + "\n"))
+	gz.Write([]byte(`{"type":"sample","time":"2024-01-02T03:04:06Z","stats":{"memory":{"current":1}}}` + "\n"))
+	gz.Flush()
+
+	// The gzip stream is not closed, as when giogo is killed while recording
+	rec, err := record.Read(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rec.Samples) != 1 || rec.Run != nil {
+		t.Errorf("unexpected recording: %+v", rec)
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	if _, err := record.Read(bytes.NewReader([]byte("not gzip"))); err == nil {
+		t.Errorf("expected error for a file that is not a recording")
+	}
+	if _, err := record.ReadFile(filepath.Join(os.TempDir(), "giogo-missing.giogo")); err == nil {
+		t.Errorf("expected error for a missing file")
+	}
+}
@@ -0,0 +1,355 @@
+package report
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/monitor"
+	"github.com/pmarchini/giogo/internal/record"
+	"github.com/pmarchini/giogo/internal/utils"
+)
+
+// Chart geometry, in SVG user units
+const (
+	chartWidth  = 960
+	chartHeight = 260
+	marginLeft  = 80
+	marginRight = 20
+	marginTop   = 36
+	marginBot   = 36
+)
+
+type point struct{ x, y float64 }
+
+// series is a line of a chart
+type series struct {
+	name, color string
+	points      []point
+}
+
+// limit is a configured limit, drawn as a dashed horizontal line
+type limit struct {
+	name, color string
+	value       float64
+}
+
+// marker is an event, drawn as a vertical line
+type marker struct {
+	x            float64
+	label, color string
+}
+
+type chart struct {
+	title   string
+	format  func(float64) string
+	series  []series
+	limits  []limit
+	markers []marker
+}
+
+// svg renders the chart, x values are seconds since the start of the run
+func (c *chart) svg() template.HTML {
+	var xMax, yMax float64
+	for _, s := range c.series {
+		for _, p := range s.points {
+			xMax = math.Max(xMax, p.x)
+			yMax = math.Max(yMax, p.y)
+		}
+	}
+	for _, l := range c.limits {
+		yMax = math.Max(yMax, l.value)
+	}
+	for _, m := range c.markers {
+		xMax = math.Max(xMax, m.x)
+	}
+	if xMax <= 0 {
+		xMax = 1
+	}
+	if yMax <= 0 {
+		yMax = 1
+	}
+	yMax *= 1.1
+
+	plotWidth := float64(chartWidth - marginLeft - marginRight)
+	plotHeight := float64(chartHeight - marginTop - marginBot)
+	px := func(x float64) float64 { return marginLeft + x/xMax*plotWidth }
+	py := func(y float64) float64 { return marginTop + plotHeight - y/yMax*plotHeight }
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg" role="img">`, chartWidth, chartHeight)
+	fmt.Fprintf(&b, `<text x="%d" y="18" class="title">%s</text>`, marginLeft, html.EscapeString(c.title))
+
+	// Grid and axes labels
+	for i := 0; i <= 4; i++ {
+		v := yMax * float64(i) / 4
+		y := py(v)
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" class="grid"/>`, marginLeft, y, chartWidth-marginRight, y)
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" class="axis" text-anchor="end">%s</text>`, marginLeft-6, y+4, html.EscapeString(c.format(v)))
+	}
+	for i := 0; i <= 6; i++ {
+		x := xMax * float64(i) / 6
+		label := (time.Duration(x * float64(time.Second))).Round(100 * time.Millisecond).String()
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" class="axis" text-anchor="middle">%s</text>`, px(x), chartHeight-12, label)
+	}
+
+	for _, m := range c.markers {
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%.1f" stroke="%s" class="marker"><title>%s</title></line>`,
+			px(m.x), marginTop, px(m.x), py(0), m.color, html.EscapeString(m.label))
+	}
+	for _, l := range c.limits {
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="%s" class="limit"/>`, marginLeft, py(l.value), chartWidth-marginRight, py(l.value), l.color)
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" class="axis" text-anchor="end" fill="%s">%s %s</text>`,
+			chartWidth-marginRight-4, py(l.value)-4, l.color, html.EscapeString(l.name), html.EscapeString(c.format(l.value)))
+	}
+	for _, s := range c.series {
+		if len(s.points) == 0 {
+			continue
+		}
+		var coords []string
+		for _, p := range s.points {
+			coords = append(coords, fmt.Sprintf("%.1f,%.1f", px(p.x), py(p.y)))
+		}
+		fmt.Fprintf(&b, `<polyline points="%s" stroke="%s" class="series"/>`, strings.Join(coords, " "), s.color)
+	}
+
+	// Legend
+	x := marginLeft + 320
+	for _, s := range c.series {
+		fmt.Fprintf(&b, `<rect x="%d" y="9" width="10" height="10" fill="%s"/><text x="%d" y="18" class="axis">%s</text>`, x, s.color, x+14, html.EscapeString(s.name))
+		x += 24 + 7*len(s.name)
+	}
+
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+func formatCores(v float64) string    { return fmt.Sprintf("%.2f", v) }
+func formatBytes(v float64) string    { return utils.FormatBytes(uint64(v)) }
+func formatRate(v float64) string     { return utils.FormatBytes(uint64(v)) + "/s" }
+func formatPercent(v float64) string  { return fmt.Sprintf("%.1f%%", v) }
+func formatCount(v float64) string    { return fmt.Sprintf("%.0f", v) }
+func isLimited(value uint64) bool     { return value != 0 && value != math.MaxUint64 }
+func seconds(d time.Duration) float64 { return d.Seconds() }
+
+// charts derives the charts of a recording
+func charts(rec *record.Recording) []chart {
+	var start time.Time
+	if rec.Run != nil {
+		start = rec.Run.Start
+	}
+	if len(rec.Samples) > 0 && (start.IsZero() || rec.Samples[0].Time.Before(start)) {
+		start = rec.Samples[0].Time
+	}
+	at := func(t time.Time) float64 { return math.Max(0, seconds(t.Sub(start))) }
+
+	cpu := chart{title: "CPU usage (cores)", format: formatCores}
+	memory := chart{title: "Memory", format: formatBytes}
+	ioRate := chart{title: "IO throughput", format: formatRate}
+	throttling := chart{title: "CPU throttled periods per sample", format: formatCount}
+	pressure := chart{title: "Pressure stall (some, avg10)", format: formatPercent}
+
+	cpuUsage := series{name: "usage", color: "#1f77b4"}
+	memCurrent := series{name: "memory.current", color: "#1f77b4"}
+	reads := series{name: "read", color: "#2ca02c"}
+	writes := series{name: "write", color: "#d62728"}
+	throttled := series{name: "nr_throttled", color: "#ff7f0e"}
+	cpuPressure := series{name: "cpu", color: "#1f77b4"}
+	memPressure := series{name: "memory", color: "#9467bd"}
+	ioPressure := series{name: "io", color: "#8c564b"}
+
+	var memoryLimit uint64
+	for i, sample := range rec.Samples {
+		x := at(sample.Time)
+		stats := sample.Stats
+		memCurrent.points = append(memCurrent.points, point{x, float64(stats.Memory.Current)})
+		if isLimited(stats.Memory.Limit) {
+			memoryLimit = stats.Memory.Limit
+		}
+		cpuPressure.points = append(cpuPressure.points, point{x, stats.PSI.CPU.Some.Avg10})
+		memPressure.points = append(memPressure.points, point{x, stats.PSI.Memory.Some.Avg10})
+		ioPressure.points = append(ioPressure.points, point{x, stats.PSI.IO.Some.Avg10})
+		if i == 0 {
+			continue
+		}
+
+		previous := rec.Samples[i-1].Stats
+		elapsed := seconds(sample.Time.Sub(rec.Samples[i-1].Time))
+		if elapsed <= 0 {
+			continue
+		}
+		cpuUsage.points = append(cpuUsage.points, point{x, float64(utils.Delta(stats.CPU.UsageUsec, previous.CPU.UsageUsec)) / 1e6 / elapsed})
+		throttled.points = append(throttled.points, point{x, float64(utils.Delta(stats.CPU.ThrottledPeriods, previous.CPU.ThrottledPeriods))})
+		readBytes, writeBytes := core.IOTotals(stats.IO)
+		previousRead, previousWrite := core.IOTotals(previous.IO)
+		reads.points = append(reads.points, point{x, float64(utils.Delta(readBytes, previousRead)) / elapsed})
+		writes.points = append(writes.points, point{x, float64(utils.Delta(writeBytes, previousWrite)) / elapsed})
+	}
+
+	cpu.series = []series{cpuUsage}
+	memory.series = []series{memCurrent}
+	ioRate.series = []series{reads, writes}
+	throttling.series = []series{throttled}
+	pressure.series = []series{cpuPressure, memPressure, ioPressure}
+
+	if rec.Run != nil {
+		resources := rec.Run.Resources
+		if resources.CPU != nil && resources.CPU.Quota != nil && *resources.CPU.Quota > 0 && resources.CPU.Period != nil && *resources.CPU.Period > 0 {
+			cpu.limits = append(cpu.limits, limit{name: "quota", color: "#d62728", value: float64(*resources.CPU.Quota) / float64(*resources.CPU.Period)})
+		}
+		if memoryLimit == 0 && resources.Memory != nil && resources.Memory.Limit != nil && *resources.Memory.Limit > 0 {
+			memoryLimit = uint64(*resources.Memory.Limit)
+		}
+		if resources.BlockIO != nil {
+			for _, device := range resources.BlockIO.ThrottleReadBpsDevice {
+				ioRate.limits = append(ioRate.limits, limit{name: fmt.Sprintf("read limit %d:%d", device.Major, device.Minor), color: "#2ca02c", value: float64(device.Rate)})
+			}
+			for _, device := range resources.BlockIO.ThrottleWriteBpsDevice {
+				ioRate.limits = append(ioRate.limits, limit{name: fmt.Sprintf("write limit %d:%d", device.Major, device.Minor), color: "#d62728", value: float64(device.Rate)})
+			}
+		}
+	}
+	if memoryLimit != 0 {
+		memory.limits = append(memory.limits, limit{name: "limit", color: "#d62728", value: float64(memoryLimit)})
+	}
+
+	// Memory events go on the memory chart, the pids and cgroup events on the throttling one
+	for _, event := range rec.Events {
+		m := marker{x: at(event.Time), label: eventLabel(event), color: "#7f7f7f"}
+		switch {
+		case event.Name == "oom_kill" || event.Name == "oom":
+			m.color = "#d62728"
+			memory.markers = append(memory.markers, m)
+		case event.File == "memory.events":
+			m.color = "#ff7f0e"
+			memory.markers = append(memory.markers, m)
+		default:
+			throttling.markers = append(throttling.markers, m)
+		}
+	}
+
+	return []chart{cpu, memory, ioRate, throttling, pressure}
+}
+
+func eventLabel(event monitor.Event) string {
+	label := fmt.Sprintf("%s %s=%d (%+d)", event.File, event.Name, event.Value, event.Delta)
+	if event.Process != nil {
+		label += fmt.Sprintf(", killed %s (pid %d)", event.Process.Name, event.Process.PID)
+	}
+	return label
+}
+
+type page struct {
+	Name, Command, Start, WallTime, Error string
+	ExitCode                              int
+	Finished                              bool
+	Limits                                []string
+	Samples                               int
+	Charts                                []template.HTML
+	Events                                []pageEvent
+}
+
+type pageEvent struct {
+	Offset, Label string
+}
+
+var pageTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>giogo report{{if .Name}} - {{.Name}}{{end}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 1000px; color: #222; }
+h1 { font-size: 1.4em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+td, th { padding: 2px 12px 2px 0; text-align: left; vertical-align: top; }
+th { color: #555; font-weight: normal; }
+code { font-family: Menlo, Consolas, monospace; }
+svg { width: 100%; height: auto; margin-bottom: 1em; }
+svg .title { font-size: 14px; font-weight: bold; }
+svg .axis { font-size: 11px; fill: #555; }
+svg .grid { stroke: #e5e5e5; }
+svg .series { fill: none; stroke-width: 1.5; }
+svg .limit { stroke-dasharray: 6 4; stroke-width: 1.2; }
+svg .marker { stroke-dasharray: 2 3; stroke-width: 1.2; }
+</style>
+</head>
+<body>
+<h1>giogo report{{if .Name}} for {{.Name}}{{end}}</h1>
+<table>
+<tr><th>Command</th><td><code>{{.Command}}</code></td></tr>
+<tr><th>Start</th><td>{{.Start}}</td></tr>
+{{if .Finished}}<tr><th>Wall time</th><td>{{.WallTime}}</td></tr>
+<tr><th>Exit code</th><td>{{.ExitCode}}</td></tr>
+{{if .Error}}<tr><th>Error</th><td>{{.Error}}</td></tr>{{end}}{{else}}<tr><th>Status</th><td>The recording is incomplete, giogo did not finish writing it</td></tr>{{end}}
+<tr><th>Limits</th><td>{{range .Limits}}{{.}}<br>{{else}}none{{end}}</td></tr>
+<tr><th>Samples</th><td>{{.Samples}}</td></tr>
+</table>
+{{range .Charts}}{{.}}
+{{end}}
+<h2>Events</h2>
+{{if .Events}}<table>
+<tr><th>Time</th><th>Event</th></tr>
+{{range .Events}}<tr><td>{{.Offset}}</td><td>{{.Label}}</td></tr>
+{{end}}</table>{{else}}<p>No events were recorded.</p>{{end}}
+</body>
+</html>
+`))
+
+// WriteHTML renders the recording as a self-contained HTML page, the charts are inline SVG so it works offline
+func WriteHTML(w io.Writer, rec *record.Recording) error {
+	p := page{Samples: len(rec.Samples)}
+	var start time.Time
+	if len(rec.Samples) > 0 {
+		start = rec.Samples[0].Time
+	}
+	if run := rec.Run; run != nil {
+		p.Finished = true
+		p.Name = run.Name
+		p.Command = strings.Join(run.Command, " ")
+		p.WallTime = (time.Duration(run.WallTimeUsec) * time.Microsecond).Round(time.Millisecond).String()
+		p.ExitCode = run.ExitCode
+		p.Error = run.Error
+		p.Limits = Limits(run)
+		start = run.Start
+	}
+	if !start.IsZero() {
+		p.Start = start.Format(time.RFC3339)
+	}
+
+	for _, c := range charts(rec) {
+		p.Charts = append(p.Charts, c.svg())
+	}
+	for _, event := range rec.Events {
+		offset := event.Time.Sub(start).Round(time.Millisecond)
+		p.Events = append(p.Events, pageEvent{Offset: offset.String(), Label: eventLabel(event)})
+	}
+
+	return pageTemplate.Execute(w, p)
+}
+
+// Limits describes the limits applied to the cgroup of a run
+func Limits(run *record.Run) []string {
+	var limits []string
+	resources := run.Resources
+	if cpu := resources.CPU; cpu != nil && cpu.Quota != nil && *cpu.Quota > 0 && cpu.Period != nil && *cpu.Period > 0 {
+		limits = append(limits, fmt.Sprintf("cpu %.2f cores (quota %d/%d)", float64(*cpu.Quota)/float64(*cpu.Period), *cpu.Quota, *cpu.Period))
+	}
+	if memory := resources.Memory; memory != nil && memory.Limit != nil && *memory.Limit > 0 {
+		limits = append(limits, fmt.Sprintf("memory %s", utils.FormatBytes(uint64(*memory.Limit))))
+	}
+	if blockIO := resources.BlockIO; blockIO != nil {
+		for _, device := range blockIO.ThrottleReadBpsDevice {
+			limits = append(limits, fmt.Sprintf("io read %d:%d %s/s", device.Major, device.Minor, utils.FormatBytes(device.Rate)))
+		}
+		for _, device := range blockIO.ThrottleWriteBpsDevice {
+			limits = append(limits, fmt.Sprintf("io write %d:%d %s/s", device.Major, device.Minor, utils.FormatBytes(device.Rate)))
+		}
+	}
+	return limits
+}
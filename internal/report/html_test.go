@@ -0,0 +1,97 @@
+package report_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/monitor"
+	"github.com/pmarchini/giogo/internal/record"
+	"github.com/pmarchini/giogo/internal/report"
+)
+
+func testRecording() *record.Recording {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	quota, period := int64(50000), uint64(100000)
+	limit := int64(64 * 1024 * 1024)
+	return &record.Recording{
+		Interval: time.Second,
+		Samples: []record.Sample{
+			{Time: start, Stats: &core.Stats{CPU: core.CPUStats{UsageUsec: 0}, Memory: core.MemoryStats{Current: 1024 * 1024}}},
+			{Time: start.Add(time.Second), Stats: &core.Stats{
+				CPU:    core.CPUStats{UsageUsec: 500000, ThrottledPeriods: 4},
+				Memory: core.MemoryStats{Current: 32 * 1024 * 1024},
+				IO:     []core.IOStats{{Major: 8, Minor: 0, RBytes: 1024 * 1024}},
+			}},
+		},
+		Events: []monitor.Event{
+			{Time: start.Add(1500 * time.Millisecond), File: "memory.events", Name: "oom_kill", Value: 1, Delta: 1, Process: &monitor.KilledProcess{PID: 42, Name: "<stress>"}},
+		},
+		Run: &record.Run{
+			Name:    "giogo-cgroup-1",
+			Command: []string{"stress", "--vm", "1"},
+			Resources: specs.LinuxResources{
+				CPU:    &specs.LinuxCPU{Quota: &quota, Period: &period},
+				Memory: &specs.LinuxMemory{Limit: &limit},
+				BlockIO: &specs.LinuxBlockIO{
+					ThrottleReadBpsDevice: []specs.LinuxThrottleDevice{{Rate: 2 * 1024 * 1024}},
+				},
+			},
+			Start:        start,
+			WallTimeUsec: 2000000,
+			ExitCode:     137,
+		},
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := report.WriteHTML(buf, testRecording()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	output := buf.String()
+
+	for _, expected := range []string{
+		"<title>giogo report - giogo-cgroup-1</title>",
+		"<code>stress --vm 1</code>",
+		"cpu 0.50 cores (quota 50000/100000)",
+		"memory 64.0m",
+		"io read 0:0 2.0m/s",
+		"CPU usage (cores)",
+		"quota 0.50",
+		"limit 64.0m",
+		"read limit 0:0 2.0m/s",
+		"<td>1.5s</td>",
+		// Process names are escaped
+		"killed &lt;stress&gt; (pid 42)",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected report to contain %q", expected)
+		}
+	}
+	if strings.Contains(output, "<stress>") {
+		t.Errorf("expected process names to be escaped")
+	}
+	// Everything is inline, the page works offline
+	if strings.Contains(output, "<script src") || strings.Contains(output, "<link") {
+		t.Errorf("expected a self-contained page")
+	}
+	if strings.Count(output, "<svg") != 5 {
+		t.Errorf("expected 5 charts, got %d", strings.Count(output, "<svg"))
+	}
+}
+
+func TestWriteHTML_Incomplete(t *testing.T) {
+	rec := testRecording()
+	rec.Run = nil
+	buf := new(bytes.Buffer)
+	if err := report.WriteHTML(buf, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "The recording is incomplete") {
+		t.Errorf("expected the report to flag the incomplete recording")
+	}
+}
@@ -0,0 +1,213 @@
+package summary
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/monitor"
+	"github.com/pmarchini/giogo/internal/utils"
+)
+
+// Format is the output format of the summary
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+)
+
+// ParseFormat parses one of text or json
+func ParseFormat(value string) (Format, error) {
+	switch format := Format(value); format {
+	case FormatText, FormatJSON:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid summary format %q, expected text or json", value)
+	}
+}
+
+// Summary is the resource usage of a finished run, a cgroup-aware `time -v`
+type Summary struct {
+	Name         string      `json:"name"`
+	Command      []string    `json:"command"`
+	WallTimeUsec uint64      `json:"wall_time_usec"`
+	ExitCode     int         `json:"exit_code"`
+	Error        string      `json:"error,omitempty"`
+	Stats        *core.Stats `json:"stats"`
+	Snapshots    []string    `json:"snapshots,omitempty"`
+}
+
+// New creates the summary of a run
+func New(result *core.Result) *Summary {
+	s := &Summary{
+		Name:         result.Name,
+		Command:      result.Command,
+		WallTimeUsec: uint64(result.WallTime.Microseconds()),
+		ExitCode:     result.ExitCode,
+		Stats:        result.Stats,
+		Snapshots:    result.Snapshots,
+	}
+	if result.Err != nil {
+		s.Error = result.Err.Error()
+	}
+	return s
+}
+
+// WriteJSON writes the summary as a single JSON document
+func (s *Summary) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
+
+// WriteText writes the summary in a human readable form
+func (s *Summary) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "giogo summary for %s\n", s.Name)
+	fmt.Fprintf(&b, "  command:          %s\n", strings.Join(s.Command, " "))
+	if s.Stats != nil && len(s.Stats.Labels) > 0 {
+		var labels []string
+		for name, value := range s.Stats.Labels {
+			labels = append(labels, name+"="+value)
+		}
+		sort.Strings(labels)
+		fmt.Fprintf(&b, "  labels:           %s\n", strings.Join(labels, ", "))
+	}
+	fmt.Fprintf(&b, "  wall time:        %v\n", usecToDuration(s.WallTimeUsec))
+	fmt.Fprintf(&b, "  exit code:        %d\n", s.ExitCode)
+	if s.Error != "" {
+		fmt.Fprintf(&b, "  error:            %s\n", s.Error)
+	}
+	if stats := s.Stats; stats != nil {
+		fmt.Fprintf(&b, "  cpu time:         %v (user %v, system %v)\n",
+			usecToDuration(stats.CPU.UsageUsec), usecToDuration(stats.CPU.UserUsec), usecToDuration(stats.CPU.SystemUsec))
+		fmt.Fprintf(&b, "  cpu throttling:   %d of %d periods, %v throttled\n",
+			stats.CPU.ThrottledPeriods, stats.CPU.Periods, usecToDuration(stats.CPU.ThrottledUsec))
+		fmt.Fprintf(&b, "  memory peak:      %s (limit %s)\n", formatPeak(stats.Memory.Peak, utils.FormatBytes), formatLimit(stats.Memory.Limit))
+		fmt.Fprintf(&b, "  memory events:    high %d, max %d, oom %d, oom_kill %d\n",
+			stats.Memory.Events.High, stats.Memory.Events.Max, stats.Memory.Events.OOM, stats.Memory.Events.OOMKill)
+		if ws := stats.Memory.WorkingSet; ws != nil {
+			// Until reclaim reached the working set, the estimate is an upper bound
+			bound := ""
+			if !ws.Converged {
+				bound = ", upper bound"
+			}
+			fmt.Fprintf(&b, "  working set:      %s (peak %s, %s reclaimed, %d refaults%s)\n",
+				utils.FormatBytes(ws.Current), utils.FormatBytes(ws.Peak), utils.FormatBytes(ws.Reclaimed), ws.Refaults, bound)
+		}
+		fmt.Fprintf(&b, "  pids peak:        %s (limit %s)\n", formatPeak(stats.Pids.Peak, func(peak uint64) string { return fmt.Sprintf("%d", peak) }), formatCount(stats.Pids.Limit))
+		for _, resource := range []struct {
+			name     string
+			pressure core.PressureStats
+		}{
+			{"cpu", stats.PSI.CPU},
+			{"memory", stats.PSI.Memory},
+			{"io", stats.PSI.IO},
+		} {
+			fmt.Fprintf(&b, "  %-17s some %s, full %s\n", resource.name+" pressure:",
+				formatPressure(resource.pressure.Some), formatPressure(resource.pressure.Full))
+		}
+		for _, device := range stats.IO {
+			name := fmt.Sprintf("%d:%d", device.Major, device.Minor)
+			if device.Device != "" {
+				name = fmt.Sprintf("%s (%s)", device.Device, name)
+			}
+			fmt.Fprintf(&b, "  io %-14s read %s (%d ops), write %s (%d ops), discard %s (%d ops)\n", name+":",
+				utils.FormatBytes(device.RBytes), device.RIOs, utils.FormatBytes(device.WBytes), device.WIOs, utils.FormatBytes(device.DBytes), device.DIOs)
+			if rates := device.Rates; rates != nil {
+				fmt.Fprintf(&b, "  io %-14s read peak %s, write peak %s\n", name+" rates:",
+					formatRate(rates.PeakRead, device.RBpsMax, rates.ReadSaturatedUsec), formatRate(rates.PeakWrite, device.WBpsMax, rates.WriteSaturatedUsec))
+			}
+		}
+	}
+	if s.Stats != nil && len(s.Stats.Processes) > 0 {
+		// Children below their parent, the biggest CPU consumers first
+		order := monitor.ProcessSort{Column: monitor.ProcessColumnCPU, Descending: true}
+		var table strings.Builder
+		if err := monitor.WriteProcessTable(&table, s.Stats.Processes, order, false); err != nil {
+			return err
+		}
+		b.WriteString("  processes:\n")
+		for _, line := range strings.Split(strings.TrimSuffix(table.String(), "\n"), "\n") {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+	}
+	for _, snapshot := range s.Snapshots {
+		fmt.Fprintf(&b, "  snapshot:         %s\n", snapshot)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func usecToDuration(usec uint64) time.Duration {
+	return (time.Duration(usec) * time.Microsecond).Round(time.Millisecond)
+}
+
+// formatPressure formats the avg10/avg60/avg300 percentages and the total stall time
+func formatPressure(data core.PressureData) string {
+	return fmt.Sprintf("%.2f%%/%.2f%%/%.2f%% (stalled %v)", data.Avg10, data.Avg60, data.Avg300, usecToDuration(data.TotalUsec))
+}
+
+// formatRate formats a peak bandwidth against its throttle, and how long the throttle held the command back
+func formatRate(peak float64, throttle, saturatedUsec uint64) string {
+	rate := utils.FormatBytes(uint64(peak)) + "/s"
+	if throttle == 0 {
+		return rate + " (no throttle)"
+	}
+	return fmt.Sprintf("%s of %s/s (saturated %v)", rate, utils.FormatBytes(throttle), usecToDuration(saturatedUsec))
+}
+
+// formatPeak formats a peak, n/a when the kernel does not track it: memory.peak and pids.peak are read as 0 before Linux 5.19
+func formatPeak(peak uint64, format func(uint64) string) string {
+	if peak == 0 {
+		return "n/a"
+	}
+	return format(peak)
+}
+
+func formatLimit(limit uint64) string {
+	if limit == 0 || limit == math.MaxUint64 {
+		return "max"
+	}
+	return utils.FormatBytes(limit)
+}
+
+func formatCount(limit uint64) string {
+	if limit == 0 || limit == math.MaxUint64 {
+		return "max"
+	}
+	return fmt.Sprintf("%d", limit)
+}
+
+// Reporter writes the summary of the run before the cgroup is deleted
+type Reporter struct {
+	Format Format
+	// Path is the file the summary is written to, stderr when empty so the command output is left untouched
+	Path string
+}
+
+// Report writes the summary of the run
+func (r *Reporter) Report(result *core.Result) error {
+	var w io.Writer = os.Stderr
+	if r.Path != "" {
+		f, err := os.Create(r.Path)
+		if err != nil {
+			return fmt.Errorf("error creating summary file: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	s := New(result)
+	if r.Format == FormatJSON {
+		return s.WriteJSON(w)
+	}
+	return s.WriteText(w)
+}
@@ -0,0 +1,140 @@
+package summary_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/summary"
+)
+
+func testResult() *core.Result {
+	return &core.Result{
+		Name:      "giogo-cgroup-1234",
+		Command:   []string{"make", "test"},
+		WallTime:  3 * time.Second,
+		ExitCode:  2,
+		Err:       errors.New("command exited with error: exit status 2"),
+		Snapshots: []string{"/var/tmp/giogo-cgroup-1234-oom-20240102T030405.000"},
+		Stats: &core.Stats{
+			CPU: core.CPUStats{UsageUsec: 1500000, UserUsec: 1000000, SystemUsec: 500000, Periods: 30, ThrottledPeriods: 10, ThrottledUsec: 250000},
+			Memory: core.MemoryStats{
+				Peak:   256 * 1024 * 1024,
+				Limit:  math.MaxUint64,
+				Events: core.MemoryEventsStats{High: 4, OOMKill: 1},
+				WorkingSet: &core.WorkingSetStats{
+					Current: 96 * 1024 * 1024, Peak: 128 * 1024 * 1024, Reclaimed: 64 * 1024 * 1024, Refaults: 300, Converged: true,
+				},
+			},
+			IO: []core.IOStats{
+				{Major: 8, Minor: 0, RBytes: 1024 * 1024, RIOs: 12, WBytes: 2048, WIOs: 3},
+				{
+					Device: "nvme0n1", Major: 259, Minor: 0, WBytes: 10 * 1024 * 1024, WIOs: 80, DBytes: 4096, DIOs: 1, WBpsMax: 1024 * 1024,
+					Rates: &core.IORateStats{PeakRead: 512, PeakWrite: 1000 * 1024, WriteSaturatedUsec: 9000000},
+				},
+			},
+			Pids:   core.PidsStats{Peak: 7, Limit: 100},
+			Labels: map[string]string{"team": "infra", "job": "1234"},
+			Processes: []core.ProcessStats{
+				{PID: 1234, PPID: 1, Threads: 1, Cmdline: []string{"make", "test"}, CPUUsec: 500000},
+				{PID: 1240, PPID: 1234, Threads: 2, Cmdline: []string{"go", "test"}, CPUUsec: 1000000, Rss: 64 * 1024 * 1024},
+			},
+			PSI: core.PSIStats{
+				Memory: core.PressureStats{
+					Some: core.PressureData{Avg10: 12.5, Avg60: 3.25, Avg300: 0.5, TotalUsec: 1200000},
+				},
+			},
+		},
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, value := range []string{"text", "json"} {
+		if _, err := summary.ParseFormat(value); err != nil {
+			t.Errorf("ParseFormat(%q) unexpected error: %v", value, err)
+		}
+	}
+	if _, err := summary.ParseFormat("yaml"); err == nil {
+		t.Errorf("expected error for unsupported format")
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := summary.New(testResult()).WriteText(buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	output := buf.String()
+	for _, expected := range []string{
+		"giogo summary for giogo-cgroup-1234",
+		"command:          make test",
+		"labels:           job=1234, team=infra",
+		"exit code:        2",
+		"cpu time:         1.5s (user 1s, system 500ms)",
+		"cpu throttling:   10 of 30 periods, 250ms throttled",
+		"memory peak:      256.0m (limit max)",
+		"memory events:    high 4, max 0, oom 0, oom_kill 1",
+		"working set:      96.0m (peak 128.0m, 64.0m reclaimed, 300 refaults)",
+		"pids peak:        7 (limit 100)",
+		"memory pressure:  some 12.50%/3.25%/0.50% (stalled 1.2s), full 0.00%/0.00%/0.00% (stalled 0s)",
+		"io 8:0:",
+		"read 1.0m (12 ops), write 2.0k (3 ops), discard 0 (0 ops)",
+		"io nvme0n1 (259:0): read 0 (0 ops), write 10.0m (80 ops), discard 4.0k (1 ops)",
+		"io nvme0n1 (259:0) rates: read peak 512/s (no throttle), write peak 1000.0k/s of 1.0m/s (saturated 9s)",
+		"  processes:\n    PID   PPID  THREADS  CPU    RSS    PSS  SWAP  READ  WRITE  COMMAND\n",
+		"    1240  1234  2        1s     64.0m  0    0     0     0      \\_ go test\n",
+		"snapshot:         /var/tmp/giogo-cgroup-1234-oom-20240102T030405.000",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected summary to contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestWriteText_PeaksUnavailable(t *testing.T) {
+	result := testResult()
+	result.Stats.Memory.Peak = 0
+	result.Stats.Pids.Peak = 0
+	buf := new(bytes.Buffer)
+	if err := summary.New(result).WriteText(buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	output := buf.String()
+	for _, expected := range []string{"memory peak:      n/a (limit max)", "pids peak:        n/a (limit 100)"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected summary to contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestReporterJSONFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "summary.json")
+	reporter := &summary.Reporter{Format: summary.FormatJSON, Path: path}
+	if err := reporter.Report(testResult()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded summary.Summary
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		t.Fatalf("invalid JSON summary: %v", err)
+	}
+	if decoded.WallTimeUsec != 3000000 || decoded.Stats.Memory.Peak != 256*1024*1024 || decoded.Stats.Pids.Peak != 7 {
+		t.Errorf("unexpected summary: %+v", decoded)
+	}
+	if decoded.Error == "" {
+		t.Errorf("expected the run error in the summary")
+	}
+}
@@ -0,0 +1,139 @@
+package top
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// keySequences maps the escape sequences of the terminal to key names
+var keySequences = []struct {
+	sequence string
+	key      string
+}{
+	{"\x1b[A", "up"},
+	{"\x1b[B", "down"},
+	{"\x1b[C", "right"},
+	{"\x1b[D", "left"},
+	{"\x1bOA", "up"},
+	{"\x1bOB", "down"},
+	{"\x1bOC", "right"},
+	{"\x1bOD", "left"},
+	{"\r", "enter"},
+	{"\n", "enter"},
+	{"\x7f", "backspace"},
+	{"\b", "backspace"},
+	{"\x03", "ctrl-c"},
+	{"\x1b", "esc"},
+}
+
+// ParseKeys splits what the terminal sent into key names: printable characters are their own name, the arrows,
+// enter, backspace, esc and ctrl-c have theirs, anything else is dropped
+func ParseKeys(input []byte) []string {
+	var keys []string
+	s := string(input)
+	for s != "" {
+		matched := false
+		for _, k := range keySequences {
+			if strings.HasPrefix(s, k.sequence) {
+				keys = append(keys, k.key)
+				s = s[len(k.sequence):]
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+		if s[0] >= ' ' && s[0] < 0x7f {
+			keys = append(keys, s[:1])
+		}
+		s = s[1:]
+	}
+	return keys
+}
+
+// Run shows the model on the terminal of out until q is pressed, reading keys from in and sampling the groups
+// every interval. The terminal is put in raw mode and on the alternate screen, both restored on exit.
+func Run(in, out *os.File, sampler *Sampler, model *Model, interval time.Duration) error {
+	restore, err := makeRaw(int(in.Fd()))
+	if err != nil {
+		return fmt.Errorf("top requires a terminal: %v", err)
+	}
+	defer restore()
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+
+	keys := make(chan []string)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := in.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- ParseKeys(buf[:n])
+		}
+	}()
+
+	refresh := func() error {
+		groups, err := sampler.Sample(time.Now())
+		if err != nil {
+			return err
+		}
+		model.SetGroups(groups)
+		return nil
+	}
+	if err := refresh(); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		width, height := 80, 24
+		if ws, err := unix.IoctlGetWinsize(int(out.Fd()), unix.TIOCGWINSZ); err == nil && ws.Col > 0 && ws.Row > 0 {
+			width, height = int(ws.Col), int(ws.Row)
+		}
+		// Raw mode does not translate newlines, every line goes back to the first column
+		screen := strings.ReplaceAll(model.Render(width, height), "\n", "\x1b[K\r\n")
+		fmt.Fprint(out, "\x1b[H"+screen+"\x1b[K\x1b[J")
+
+		select {
+		case <-ticker.C:
+			if err := refresh(); err != nil {
+				return err
+			}
+		case pressed, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			for _, key := range pressed {
+				if model.HandleKey(key) {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// makeRaw disables the echo, the line buffering and the signals of the terminal, so that every key is read as
+// it is pressed, and returns a function restoring the terminal
+func makeRaw(fd int) (func(), error) {
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return nil, err
+	}
+	saved := *termios
+	termios.Lflag &^= unix.ECHO | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Iflag &^= unix.IXON | unix.ICRNL
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, termios); err != nil {
+		return nil, err
+	}
+	return func() { unix.IoctlSetTermios(fd, unix.TCSETS, &saved) }, nil
+}
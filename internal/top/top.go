@@ -0,0 +1,382 @@
+package top
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/monitor"
+	"github.com/pmarchini/giogo/internal/utils"
+)
+
+// DefaultInterval is the time between two refreshes of the view
+const DefaultInterval = time.Second
+
+// Group is a running giogo group as shown by top
+type Group struct {
+	Name   string
+	Dir    string
+	Frozen bool
+	Stats  *core.Stats
+	// CPU is the CPU usage in cores since the previous refresh, CPUQuota the limit in cores, 0 when unlimited
+	CPU, CPUQuota float64
+	// IORead and IOWrite are the bandwidths in bytes per second since the previous refresh,
+	// IOReadMax and IOWriteMax the highest throttle of io.max, 0 when unlimited
+	IORead, IOWrite       float64
+	IOReadMax, IOWriteMax uint64
+}
+
+// Sampler reads the running groups and computes their rates between two samples
+type Sampler struct {
+	// List returns the names of the running groups, Load the manager of one of them
+	List func() ([]string, error)
+	Load func(name string) (core.CgroupManager, error)
+
+	previous map[string]counters
+}
+
+type counters struct {
+	time                 time.Time
+	cpuUsec, read, write uint64
+}
+
+// Sample reads every running group, groups that went away while being read are skipped
+func (s *Sampler) Sample(now time.Time) ([]Group, error) {
+	names, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]counters, len(names))
+	var groups []Group
+	for _, name := range names {
+		manager, err := s.Load(name)
+		if err != nil {
+			continue
+		}
+		stats, err := manager.Stats()
+		if err != nil {
+			continue
+		}
+		group := Group{Name: name, Dir: manager.Path(), Stats: stats}
+		group.Frozen = strings.TrimSpace(readFile(group.Dir, "cgroup.freeze")) == "1"
+		group.CPUQuota = parseCPUMax(readFile(group.Dir, "cpu.max"))
+
+		c := counters{time: now, cpuUsec: stats.CPU.UsageUsec}
+		for _, device := range stats.IO {
+			c.read += device.RBytes
+			c.write += device.WBytes
+			group.IOReadMax = max(group.IOReadMax, device.RBpsMax)
+			group.IOWriteMax = max(group.IOWriteMax, device.WBpsMax)
+		}
+		current[name] = c
+		if previous, ok := s.previous[name]; ok {
+			if elapsed := now.Sub(previous.time).Seconds(); elapsed > 0 {
+				group.CPU = float64(utils.Delta(c.cpuUsec, previous.cpuUsec)) / 1e6 / elapsed
+				group.IORead = float64(utils.Delta(c.read, previous.read)) / elapsed
+				group.IOWrite = float64(utils.Delta(c.write, previous.write)) / elapsed
+			}
+		}
+		groups = append(groups, group)
+	}
+	s.previous = current
+	return groups, nil
+}
+
+func readFile(dir, name string) string {
+	content, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return string(content)
+}
+
+// parseCPUMax parses cpu.max, "$MAX $PERIOD", into cores
+func parseCPUMax(content string) float64 {
+	fields := strings.Fields(content)
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0
+	}
+	quota, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+	period, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || period == 0 {
+		return 0
+	}
+	return quota / period
+}
+
+// Controller acts on a running group, through the same code as the freeze, thaw, kill and set subcommands
+type Controller interface {
+	Freeze(name string) error
+	Thaw(name string) error
+	Kill(name string) error
+	// SetLimit sets a single limit, flag is one of cpu, ram, io-read-max or io-write-max
+	SetLimit(name, flag, value string) error
+}
+
+// limitKeys are the keys adjusting a limit of the selected group
+var limitKeys = map[string]string{"c": "cpu", "m": "ram", "r": "io-read-max", "w": "io-write-max"}
+
+type view int
+
+const (
+	viewGroups view = iota
+	viewProcesses
+)
+
+// Model is the state of the view, updated by the keys and the refreshes
+type Model struct {
+	Controller Controller
+	// ReadProcesses reads the processes of a group given its directory
+	ReadProcesses func(dir string) ([]core.ProcessStats, error)
+
+	groups    []Group
+	selected  string
+	view      view
+	processes []core.ProcessStats
+	// sort is the index of the column of monitor.ProcessColumns the processes are sorted by
+	sort int
+	// prompt is the flag of the limit being typed in, confirmKill is set while the kill awaits confirmation
+	prompt      string
+	input       string
+	confirmKill bool
+	message     string
+}
+
+// SetGroups refreshes the groups, the selection follows the selected group by name
+func (m *Model) SetGroups(groups []Group) {
+	m.groups = groups
+	if m.cursor() < 0 {
+		m.selected = ""
+		if len(groups) > 0 {
+			m.selected = groups[0].Name
+		}
+	}
+	if m.view == viewProcesses {
+		m.readProcesses()
+	}
+}
+
+// cursor returns the index of the selected group, -1 when there is none
+func (m *Model) cursor() int {
+	for i, g := range m.groups {
+		if g.Name == m.selected {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Model) readProcesses() {
+	i := m.cursor()
+	if i < 0 {
+		m.view = viewGroups
+		m.processes = nil
+		return
+	}
+	processes, err := m.ReadProcesses(m.groups[i].Dir)
+	if err != nil {
+		m.message = fmt.Sprintf("error reading the processes of %s: %v", m.selected, err)
+	}
+	m.processes = processes
+}
+
+// HandleKey updates the model with a key, see ParseKeys. It returns true when top must exit.
+func (m *Model) HandleKey(key string) bool {
+	if m.prompt != "" {
+		switch key {
+		case "enter":
+			m.report(m.Controller.SetLimit(m.selected, m.prompt, m.input), fmt.Sprintf("%s of %s set to %s", m.prompt, m.selected, m.input))
+			m.prompt, m.input = "", ""
+		case "esc", "ctrl-c":
+			m.prompt, m.input = "", ""
+		case "backspace":
+			if m.input != "" {
+				m.input = m.input[:len(m.input)-1]
+			}
+		default:
+			if len(key) == 1 {
+				m.input += key
+			}
+		}
+		return false
+	}
+	if m.confirmKill {
+		m.confirmKill = false
+		if key == "y" {
+			m.report(m.Controller.Kill(m.selected), "killed "+m.selected)
+		} else {
+			m.message = "kill cancelled"
+		}
+		return false
+	}
+
+	m.message = ""
+	switch key {
+	case "q", "ctrl-c":
+		return true
+	case "up", "k":
+		if i := m.cursor(); i > 0 && m.view == viewGroups {
+			m.selected = m.groups[i-1].Name
+		}
+	case "down", "j":
+		if i := m.cursor(); i >= 0 && i < len(m.groups)-1 && m.view == viewGroups {
+			m.selected = m.groups[i+1].Name
+		}
+	case "enter":
+		if m.cursor() >= 0 {
+			m.view = viewProcesses
+			m.readProcesses()
+		}
+	case "esc", "backspace", "left":
+		m.view = viewGroups
+	case "s":
+		if m.view == viewProcesses {
+			m.sort = (m.sort + 1) % len(monitor.ProcessColumns)
+		}
+	case "f":
+		if m.cursor() >= 0 {
+			m.report(m.Controller.Freeze(m.selected), "froze "+m.selected)
+		}
+	case "t":
+		if m.cursor() >= 0 {
+			m.report(m.Controller.Thaw(m.selected), "thawed "+m.selected)
+		}
+	case "K":
+		if m.cursor() >= 0 {
+			m.confirmKill = true
+		}
+	default:
+		if flag, ok := limitKeys[key]; ok && m.cursor() >= 0 {
+			m.prompt = flag
+		}
+	}
+	return false
+}
+
+func (m *Model) report(err error, done string) {
+	if err != nil {
+		m.message = err.Error()
+	} else {
+		m.message = done
+	}
+}
+
+// processSort returns the order of the processes, usage columns list the biggest first
+func (m *Model) processSort() monitor.ProcessSort {
+	order, _ := monitor.ParseProcessSort(string(monitor.ProcessColumns[m.sort]))
+	return order
+}
+
+// Render returns the screen, at most height lines of at most width characters
+func (m *Model) Render(width, height int) string {
+	var lines []string
+	if m.view == viewProcesses {
+		lines = append(lines, fmt.Sprintf("giogo top - %s - %d processes, sorted by %s", m.selected, len(m.processes), monitor.ProcessColumns[m.sort]))
+		var table strings.Builder
+		monitor.WriteProcessTable(&table, m.processes, m.processSort(), false)
+		lines = append(lines, strings.Split(strings.TrimSuffix(table.String(), "\n"), "\n")...)
+	} else {
+		lines = append(lines, fmt.Sprintf("giogo top - %d groups", len(m.groups)))
+		lines = append(lines, m.groupTable()...)
+	}
+
+	var status string
+	switch {
+	case m.prompt != "":
+		status = fmt.Sprintf("%s of %s: %s_", m.prompt, m.selected, m.input)
+	case m.confirmKill:
+		status = fmt.Sprintf("kill every process of %s? (y/n)", m.selected)
+	case m.message != "":
+		status = m.message
+	case m.view == viewProcesses:
+		status = "s sort  esc back  f freeze  t thaw  K kill  c cpu  m ram  r io read  w io write  q quit"
+	default:
+		status = "enter processes  f freeze  t thaw  K kill  c cpu  m ram  r io read  w io write  q quit"
+	}
+
+	// Keep the selected group, and the status on the last line, on screen
+	if rows := height - 3; rows > 0 && len(lines) > height-1 {
+		first := 0
+		if i := m.cursor(); m.view == viewGroups && i >= rows {
+			first = i - rows + 1
+		}
+		lines = append(lines[:2:2], lines[2+first:]...)[:height-1]
+	}
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+	lines = append(lines, status)
+	for i, line := range lines {
+		if width > 0 && len(line) > width {
+			lines[i] = line[:width]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// groupTable returns the header and one line per group, the selected one marked with >
+func (m *Model) groupTable() []string {
+	var table strings.Builder
+	tw := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  NAME\tSTATE\tCPU/QUOTA\tMEMORY/LIMIT\tREAD/MAX\tWRITE/MAX\tPSI CPU/MEM/IO\tPIDS")
+	for _, g := range m.groups {
+		marker := " "
+		if g.Name == m.selected {
+			marker = ">"
+		}
+		state := "running"
+		if g.Frozen {
+			state = "frozen"
+		}
+		stats := g.Stats
+		fmt.Fprintf(tw, "%s %s\t%s\t%.1f%%/%s\t%s/%s\t%s/%s\t%s/%s\t%.1f/%.1f/%.1f\t%d/%s\n", marker, g.Name, state,
+			g.CPU*100, formatQuota(g.CPUQuota),
+			utils.FormatBytes(stats.Memory.Current), formatLimit(stats.Memory.Limit, utils.FormatBytes),
+			formatRate(g.IORead), formatThrottle(g.IOReadMax),
+			formatRate(g.IOWrite), formatThrottle(g.IOWriteMax),
+			stats.PSI.CPU.Some.Avg10, stats.PSI.Memory.Some.Avg10, stats.PSI.IO.Some.Avg10,
+			stats.Pids.Current, formatLimit(stats.Pids.Limit, func(n uint64) string { return strconv.FormatUint(n, 10) }))
+	}
+	tw.Flush()
+	return strings.Split(strings.TrimSuffix(table.String(), "\n"), "\n")
+}
+
+func formatQuota(cores float64) string {
+	if cores == 0 {
+		return "max"
+	}
+	return fmt.Sprintf("%.0f%%", cores*100)
+}
+
+// formatLimit formats a memory or pids limit with format, max when unlimited
+func formatLimit(limit uint64, format func(uint64) string) string {
+	if limit == 0 || limit == math.MaxUint64 {
+		return "max"
+	}
+	return format(limit)
+}
+
+// formatRate formats a bandwidth in bytes per second
+func formatRate(bytesPerSec float64) string {
+	if bytesPerSec == 0 {
+		return "0"
+	}
+	return utils.FormatBytes(uint64(bytesPerSec)) + "/s"
+}
+
+// formatThrottle formats an io.max bandwidth, max when unlimited
+func formatThrottle(bytesPerSec uint64) string {
+	if bytesPerSec == 0 {
+		return "max"
+	}
+	return formatRate(float64(bytesPerSec))
+}
@@ -0,0 +1,190 @@
+package top_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmarchini/giogo/internal/core"
+	"github.com/pmarchini/giogo/internal/top"
+)
+
+func TestParseKeys(t *testing.T) {
+	keys := top.ParseKeys([]byte("j\x1b[A\x1b[Bq\r\x7f\x03\x1b\x01K"))
+	expected := []string{"j", "up", "down", "q", "enter", "backspace", "ctrl-c", "esc", "K"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+}
+
+func TestSampler(t *testing.T) {
+	dir := t.TempDir()
+	for file, content := range map[string]string{
+		"cgroup.freeze": "1\n",
+		"cpu.max":       "20000 100000\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	stats := &core.Stats{CPU: core.CPUStats{UsageUsec: 1000000}, IO: []core.IOStats{{RBytes: 4096, RBpsMax: 1048576}, {RBpsMax: 2097152}}}
+	manager := new(core.MockCgroupManager)
+	manager.On("Stats").Return(stats, nil)
+	manager.On("Path").Return(dir)
+	sampler := &top.Sampler{
+		List: func() ([]string, error) { return []string{"giogo-cgroup-1", "giogo-cgroup-gone"}, nil },
+		Load: func(name string) (core.CgroupManager, error) {
+			if name == "giogo-cgroup-gone" {
+				return nil, fmt.Errorf("gone")
+			}
+			return manager, nil
+		},
+	}
+
+	now := time.Now()
+	groups, err := sampler.Sample(now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("expected the group that went away to be skipped, got %+v", groups)
+	}
+	g := groups[0]
+	if !g.Frozen || g.CPUQuota != 0.2 || g.IOReadMax != 2097152 || g.IOWriteMax != 0 || g.CPU != 0 {
+		t.Errorf("unexpected first sample %+v", g)
+	}
+
+	stats.CPU.UsageUsec += 500000
+	stats.IO[0].RBytes += 8192
+	groups, _ = sampler.Sample(now.Add(2 * time.Second))
+	if g := groups[0]; g.CPU != 0.25 || g.IORead != 4096 || g.IOWrite != 0 {
+		t.Errorf("unexpected rates %+v", g)
+	}
+}
+
+type fakeController struct {
+	calls []string
+	err   error
+}
+
+func (f *fakeController) Freeze(name string) error {
+	f.calls = append(f.calls, "freeze "+name)
+	return f.err
+}
+
+func (f *fakeController) Thaw(name string) error {
+	f.calls = append(f.calls, "thaw "+name)
+	return f.err
+}
+
+func (f *fakeController) Kill(name string) error {
+	f.calls = append(f.calls, "kill "+name)
+	return f.err
+}
+
+func (f *fakeController) SetLimit(name, flag, value string) error {
+	f.calls = append(f.calls, fmt.Sprintf("set %s %s=%s", name, flag, value))
+	return f.err
+}
+
+func newGroup(name string) top.Group {
+	return top.Group{Name: name, Dir: "/sys/fs/cgroup/" + name, Stats: &core.Stats{Memory: core.MemoryStats{Limit: 1 << 30}}}
+}
+
+func TestModel(t *testing.T) {
+	controller := &fakeController{}
+	var readDir string
+	model := &top.Model{
+		Controller: controller,
+		ReadProcesses: func(dir string) ([]core.ProcessStats, error) {
+			readDir = dir
+			return []core.ProcessStats{{PID: 42, PPID: 1, Comm: "sleep", Cmdline: []string{"sleep", "60"}}}, nil
+		},
+	}
+	model.SetGroups([]top.Group{newGroup("giogo-cgroup-1"), newGroup("giogo-cgroup-2")})
+
+	for _, key := range []string{"down", "f", "t", "K", "n", "K", "y", "m", "5", "1", "2", "x", "backspace", "m", "enter"} {
+		if model.HandleKey(key) {
+			t.Fatalf("unexpected quit on %q", key)
+		}
+	}
+	expected := []string{
+		"freeze giogo-cgroup-2",
+		"thaw giogo-cgroup-2",
+		"kill giogo-cgroup-2",
+		"set giogo-cgroup-2 ram=512m",
+	}
+	if !reflect.DeepEqual(controller.calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, controller.calls)
+	}
+	if screen := model.Render(200, 10); !strings.Contains(screen, "ram of giogo-cgroup-2 set to 512m") {
+		t.Errorf("expected the result of the last action, got:\n%s", screen)
+	}
+	model.HandleKey("c")
+	model.HandleKey("esc")
+	if len(controller.calls) != 4 {
+		t.Errorf("expected esc to cancel the prompt, got %v", controller.calls)
+	}
+
+	// The selection follows the group by name when the list changes
+	model.SetGroups([]top.Group{newGroup("giogo-cgroup-0"), newGroup("giogo-cgroup-2")})
+	model.HandleKey("enter")
+	if readDir != "/sys/fs/cgroup/giogo-cgroup-2" {
+		t.Errorf("expected the processes of giogo-cgroup-2 to be read, got %s", readDir)
+	}
+	screen := model.Render(200, 10)
+	if !strings.Contains(screen, "giogo-cgroup-2 - 1 processes") || !strings.Contains(screen, "sleep 60") {
+		t.Errorf("expected the processes of the group, got:\n%s", screen)
+	}
+
+	// The failure of an action is shown in place of the key help
+	controller.err = fmt.Errorf("permission denied")
+	model.HandleKey("left")
+	model.HandleKey("f")
+	if screen := model.Render(200, 10); !strings.HasSuffix(screen, "permission denied") {
+		t.Errorf("expected the error on the last line, got:\n%s", screen)
+	}
+	if !model.HandleKey("q") {
+		t.Errorf("expected q to quit")
+	}
+}
+
+func TestModelRender(t *testing.T) {
+	model := &top.Model{}
+	group := newGroup("giogo-cgroup-1")
+	group.CPU, group.CPUQuota = 0.182, 0.2
+	group.IORead, group.IOReadMax = 1024*1024, 2*1024*1024
+	group.Stats.Memory.Current = 256 * 1024 * 1024
+	group.Stats.Pids = core.PidsStats{Current: 3, Limit: 64}
+	group.Stats.PSI.CPU.Some.Avg10 = 12.5
+	model.SetGroups([]top.Group{group})
+
+	lines := strings.Split(model.Render(200, 5), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected the screen to fill 5 lines, got %d", len(lines))
+	}
+	row := strings.Fields(lines[2])
+	expected := []string{">", "giogo-cgroup-1", "running", "18.2%/20%", "256.0m/1.0g", "1.0m/s/2.0m/s", "0/max", "12.5/0.0/0.0", "3/64"}
+	if !reflect.DeepEqual(row, expected) {
+		t.Errorf("expected row %v, got %v", expected, row)
+	}
+
+	// Rows past the height scroll so that the selected group stays visible
+	var groups []top.Group
+	for i := 0; i < 10; i++ {
+		groups = append(groups, newGroup(fmt.Sprintf("giogo-cgroup-%d", i)))
+	}
+	model.SetGroups(groups)
+	for i := 0; i < 9; i++ {
+		model.HandleKey("down")
+	}
+	screen := model.Render(200, 6)
+	if lines := strings.Split(screen, "\n"); len(lines) != 6 || !strings.HasPrefix(lines[4], "> giogo-cgroup-9") {
+		t.Errorf("expected the selected group on screen, got:\n%s", screen)
+	}
+}
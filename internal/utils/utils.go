@@ -1,8 +1,13 @@
 package utils
 
 import (
+	"fmt"
+	"math"
 	"strconv"
 	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
 )
 
 func BytesStringToBytes(s string) (uint64, error) {
@@ -26,3 +31,54 @@ func BytesStringToBytes(s string) (uint64, error) {
 	}
 	return uint64(value * float64(multiplier)), nil
 }
+
+// ParseSignal parses a signal given by name, with or without the SIG prefix, or by number
+func ParseSignal(s string) (syscall.Signal, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if number, err := strconv.Atoi(s); err == nil {
+		if number <= 0 || number > 64 {
+			return 0, fmt.Errorf("invalid signal number %d", number)
+		}
+		return syscall.Signal(number), nil
+	}
+	if !strings.HasPrefix(s, "SIG") {
+		s = "SIG" + s
+	}
+	sig := unix.SignalNum(s)
+	if sig == 0 {
+		return 0, fmt.Errorf("unknown signal %q", s)
+	}
+	return sig, nil
+}
+
+// FormatBytes formats a number of bytes with the same units accepted by BytesStringToBytes (e.g., 1.5g)
+func FormatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return strconv.FormatUint(b, 10)
+	}
+	value := float64(b)
+	for _, suffix := range []string{"k", "m", "g"} {
+		value /= unit
+		if value < unit || suffix == "g" {
+			return fmt.Sprintf("%.1f%s", value, suffix)
+		}
+	}
+	return strconv.FormatUint(b, 10)
+}
+
+// Delta returns the increase of a counter, 0 when it was reset
+func Delta(current, previous uint64) uint64 {
+	if current < previous {
+		return 0
+	}
+	return current - previous
+}
+
+// Percentile interpolates linearly between the closest ranks of sorted values
+func Percentile(sorted []float64, p float64) float64 {
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
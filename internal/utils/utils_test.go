@@ -1,6 +1,7 @@
 package utils_test
 
 import (
+	"syscall"
 	"testing"
 
 	"github.com/pmarchini/giogo/internal/utils"
@@ -33,3 +34,69 @@ func TestBytesStringToBytes(t *testing.T) {
 		}
 	}
 }
+
+func TestParseSignal(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected syscall.Signal
+		wantErr  bool
+	}{
+		{"TERM", syscall.SIGTERM, false},
+		{"sigint", syscall.SIGINT, false},
+		{"SIGKILL", syscall.SIGKILL, false},
+		{"15", syscall.SIGTERM, false},
+		{"0", 0, true},
+		{"NOTASIGNAL", 0, true},
+	}
+
+	for _, tt := range tests {
+		result, err := utils.ParseSignal(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSignal(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && result != tt.expected {
+			t.Errorf("ParseSignal(%q) = %d, expected %d", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		input    uint64
+		expected string
+	}{
+		{512, "512"},
+		{128 * 1024, "128.0k"},
+		{1536 * 1024 * 1024, "1.5g"},
+		{4096 * 1024 * 1024 * 1024, "4096.0g"},
+	}
+
+	for _, tt := range tests {
+		if result := utils.FormatBytes(tt.input); result != tt.expected {
+			t.Errorf("FormatBytes(%d) = %q, expected %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5}
+	tests := []struct {
+		p        float64
+		expected float64
+	}{
+		{0, 1},
+		{50, 3},
+		{90, 4.6},
+		{100, 5},
+	}
+
+	for _, tt := range tests {
+		if result := utils.Percentile(sorted, tt.p); result < tt.expected-1e-9 || result > tt.expected+1e-9 {
+			t.Errorf("Percentile(%v) = %v, expected %v", tt.p, result, tt.expected)
+		}
+	}
+	if result := utils.Delta(10, 20); result != 0 {
+		t.Errorf("Delta(10, 20) = %d, expected 0 for a reset counter", result)
+	}
+}